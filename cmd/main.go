@@ -2,50 +2,390 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
-	"time"
 
 	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
 
 	"wager/config"
 	"wager/internal/app"
+	"wager/internal/cache"
+	"wager/internal/domain"
+	"wager/internal/logging"
+	"wager/internal/metrics"
+	"wager/internal/outbox"
+	"wager/internal/repository"
 	"wager/internal/repository/postgres"
+	"wager/internal/rpc"
+	"wager/internal/service"
+	"wager/internal/stream"
+	"wager/internal/tracing"
+	"wager/internal/webhook"
 )
 
+const usage = `Usage: wager [command] [flags]
+
+Commands:
+    serve     run the http server, this is the default command
+    export    write the wagers or purchases table to csv or jsonl
+    import    read wagers or purchases from csv or jsonl
+    rebuild-projections
+              replay the wager events and rewrite the wagers table from them
+`
+
 func main() {
-	cfg, err := config.Load()
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	configPath := flag.String("config", "", "path of the yaml configuration file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
 	if err != nil {
 		log.Panicf("Cannot load configuration: %s\n", err.Error())
 	}
 
-	dbConfig := fmt.Sprintf("user=%s dbname=%s host=%s port=%d sslmode=disable password=%s",
-		cfg.Database.Username, cfg.Database.Database, cfg.Database.Host,
-		cfg.Database.Port, cfg.Database.Password)
-	log.Printf("Init db with these param %v", dbConfig)
+	logger, level, err := logging.New(cfg.Log)
+	if err != nil {
+		log.Panicf("Cannot create logger: %s\n", err.Error())
+	}
+	defer logger.Sync()
+
+	// the packages which still use the standard logger write through the structured one
+	defer zap.RedirectStdLog(logger)()
+
+	switch cmd := flag.Arg(0); cmd {
+	case "", "serve":
+		serve(cfg, config.NewWatcher(*configPath, cfg, logger), logger, level)
+	case "export":
+		err = runExport(context.Background(), postgres.New(connect(cfg, logger), postgres.WithLogger(logger)), flag.Args()[1:])
+	case "import":
+		err = runImport(context.Background(), postgres.New(connect(cfg, logger), postgres.WithLogger(logger)), flag.Args()[1:])
+	case "rebuild-projections":
+		err = runRebuildProjections(context.Background(), postgres.New(connect(cfg, logger), postgres.WithLogger(logger)), flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatalf("%s failed: %s", flag.Arg(0), err.Error())
+	}
+}
+
+// connect to the database, the database may not be up yet so it is retried until connect_retry_timeout
+func connect(cfg *config.Schema, logger *zap.Logger) *sqlx.DB {
+	logger.Info("Connect to database", zap.Stringer("dsn", cfg.Database))
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Database.ConnectRetryTimeout)
+	defer cancel()
+
+	conn, err := postgres.Connect(ctx, cfg.Database.DSN(), pool(cfg), logger)
+	if err != nil {
+		logger.Panic("Cannot connect to database", logging.Error(err))
+	}
+
+	return conn
+}
+
+func pool(cfg *config.Schema) postgres.Pool {
+	return postgres.Pool{
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.Database.ConnMaxIdleTime,
+	}
+}
+
+// newPublisher is the publisher of the outbox relay, the events are published to the local publishers
+// after the external one
+func newPublisher(cfg *config.Schema, logger *zap.Logger, local ...domain.MarketPublisher) (domain.MarketPublisher, func() error) {
+	switch cfg.Outbox.Publisher {
+	case config.OutboxPublisherFile:
+		p, err := outbox.NewFilePublisher(cfg.Outbox.File)
+		if err != nil {
+			logger.Panic("Cannot open outbox file", zap.String("file", cfg.Outbox.File), logging.Error(err))
+		}
+		return append(outbox.Fanout{p}, local...), p.Close
+	case config.OutboxPublisherNATS:
+		p, err := outbox.NewNATSPublisher(cfg.Outbox.NATSURL, cfg.Outbox.Subject)
+		if err != nil {
+			logger.Panic("Cannot connect to nats", zap.String("url", cfg.Outbox.NATSURL), logging.Error(err))
+		}
+		return append(outbox.Fanout{p}, local...), p.Close
+	default:
+		return outbox.Fanout(local), func() error { return nil }
+	}
+}
+
+// newMiddleware of the wager repository in the order of the configuration
+func newMiddleware(cfg *config.Schema, logger *zap.Logger) []repository.Middleware {
+	middleware := make([]repository.Middleware, 0, len(cfg.Repository.Middleware))
+	for _, name := range cfg.Repository.Middleware {
+		switch name {
+		case config.RepositoryTracing:
+			middleware = append(middleware, repository.Tracing())
+		case config.RepositoryMetrics:
+			middleware = append(middleware, repository.Metrics())
+		case config.RepositoryLogging:
+			middleware = append(middleware, repository.Logging(logger, cfg.Repository.SlowCall))
+		case config.RepositoryRetry:
+			middleware = append(middleware, repository.Retry(cfg.Repository.RetryAttempts,
+				cfg.Repository.RetryBackoff, postgres.IsRetryable))
+		}
+	}
+
+	return middleware
+}
+
+// newCache caches the wager reads of next in the backend of the configuration, it is nil without a backend
+func newCache(cfg *config.Schema, next domain.WagerRepository, logger *zap.Logger) (*cache.Repository, func() error) {
+	var store cache.Store
+	closeStore := func() error { return nil }
+
+	switch cfg.Cache.Backend {
+	case config.CacheBackendMemory:
+		store = cache.NewLRU(cfg.Cache.Size)
+	case config.CacheBackendRedis:
+		r, err := cache.NewRedis(cfg.Cache.RedisURL)
+		if err != nil {
+			logger.Panic("Cannot connect to redis", zap.String("url", config.RedactDSN(cfg.Cache.RedisURL)), logging.Error(err))
+		}
+		store, closeStore = r, r.Close
+	default:
+		return nil, closeStore
+	}
+
+	return cache.NewRepository(next, store, cache.WithTTL(cfg.Cache.TTL), cache.WithLogger(logger)), closeStore
+}
+
+// connectReplicas opens the replicas lazily, a replica which is down is skipped by the repository
+func connectReplicas(cfg *config.Schema, logger *zap.Logger) []*sqlx.DB {
+	replicas := make([]*sqlx.DB, 0, len(cfg.Database.Replicas))
+	for _, dsn := range cfg.Database.Replicas {
+		logger.Info("Open replica", zap.String("dsn", config.RedactDSN(dsn)))
+
+		conn, err := postgres.Open(dsn)
+		if err != nil {
+			logger.Panic("Cannot open replica", zap.String("dsn", config.RedactDSN(dsn)), logging.Error(err))
+		}
+		pool(cfg).Apply(conn)
+		replicas = append(replicas, conn)
+	}
+
+	return replicas
+}
+
+func serve(cfg *config.Schema, watcher *config.Watcher, logger *zap.Logger, level zap.AtomicLevel) {
+	shutdownTracing, err := tracing.Setup(cfg.Tracing)
+	if err != nil {
+		logger.Panic("Cannot set up tracing", logging.Error(err))
+	}
+
+	// the market events of every instance are notified by the database and streamed to the clients
+	hub := stream.NewHub(0, 0)
+	listener := postgres.NewListener(cfg.Database.DSN(), logger)
+	// the streams are reset when events are missed, so their clients read the wagers again
+	listener.Subscribe(func(n postgres.Notification) {
+		switch {
+		case n.Reset:
+			logger.Warn("Market notifications are missed while the listener reconnected, reset the streams")
+			hub.Reset()
+		case n.Truncated:
+			logger.Warn("Market events are left out of a notification, reset the streams", zap.Int("wager_id", n.WagerID))
+			hub.Reset()
+		default:
+			_ = hub.Publish(context.Background(), n.Events...)
+		}
+	})
+
+	repo := postgres.New(connect(cfg, logger),
+		postgres.WithLogger(logger),
+		postgres.WithReplicas(cfg.Database.ReplicaCheckInterval, connectReplicas(cfg, logger)...))
+	if err := metrics.RegisterDBStats("primary", repo.PoolStats); err != nil {
+		panic(err)
+	}
+	if err := metrics.RegisterMarket(repo); err != nil {
+		panic(err)
+	}
 
-	app := app.New(postgres.New(sqlx.MustConnect("postgres", dbConfig)))
+	// the market events are delivered to the webhooks from the deliveries enqueued by the relay
+	allowed, err := webhook.ParseNetworks(cfg.Webhooks.AllowedNetworks)
+	if err != nil {
+		panic(err)
+	}
+	dispatcher := webhook.NewDispatcher(repo,
+		webhook.WithLogger(logger),
+		webhook.WithHTTPClient(webhook.NewHTTPClient(cfg.Webhooks.Timeout, allowed...)),
+		webhook.WithInterval(cfg.Webhooks.Interval, cfg.Webhooks.MaxBackoff),
+		webhook.WithMaxAttempts(cfg.Webhooks.MaxAttempts),
+		webhook.WithBatchSize(cfg.Webhooks.BatchSize))
+
+	opts := []app.Option{
+		app.WithAnalytics(repo),
+		app.WithAudit(repo),
+		app.WithStream(hub),
+		app.WithWebhooks(repo),
+		app.WithIdempotency(repo),
+		app.WithReadYourWrites(cfg.Database.ReadYourWritesWindow),
+		app.WithConfig(cfg),
+		app.WithLogger(logger),
+		app.WithLogLevel(level),
+		app.WithSettings(watcher.App),
+		app.WithDatabaseStatus(repo),
+		app.WithReadinessCheck("database", repo.Ping),
+		app.WithReadinessCheck("schema", repo.CheckSchema),
+		app.WithReadinessCheck("config_watcher", watcher.Check),
+	}
+	if cfg.Service.ValidateRequests || cfg.Service.ValidateResponses {
+		opts = append(opts, app.WithSpecValidation(cfg.Service.ValidateResponses))
+	}
+
+	// the service buys the wagers in the transactions of the repository, the middleware wraps it
+	// and is inside the cache so it only sees the reads which miss it
+	wagers := repository.Chain(service.NewWagerService(repo, metrics.NewUnitOfWork(repo)),
+		newMiddleware(cfg, logger)...)
+	wagerCache, closeCache := newCache(cfg, wagers, logger)
+	var invalidator *cache.Invalidator
+	if wagerCache != nil {
+		wagers = wagerCache
+
+		// the changes of every instance invalidate the cache, the wagers placed may belong in a cached page.
+		// the invalidations are queued so the listener does not wait for the store
+		invalidator = cache.NewInvalidator(wagerCache, cache.DefaultQueueSize, cache.DefaultInvalidateTimeout)
+		listener.Subscribe(func(n postgres.Notification) {
+			switch {
+			case n.Reset:
+				invalidator.Flush()
+			case n.Truncated || len(n.Events) == 0 || n.Events[0].Type == domain.MarketWagerPlaced:
+				invalidator.InvalidatePlaced(n.WagerID)
+			default:
+				invalidator.Invalidate(n.WagerID)
+			}
+		})
+	}
+
+	app := app.New(wagers, opts...)
+	watcher.OnReload(func(cfg *config.Schema) {
+		if err := app.SetLogLevel(cfg.Log.Level); err != nil {
+			logger.Error("Cannot change log level", logging.Error(err))
+		}
+	})
+
+	// reload the settings on SIGHUP and on changes of the config file
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	go func() {
+		if err := watcher.Watch(watchCtx); err != nil {
+			logger.Error("Watch configuration failed", logging.Error(err))
+		}
+	}()
 
 	// run app in another routine
 	go func() {
 		if err := app.Run(cfg.Service.Port); err != nil {
-			log.Printf("app run failed: %s\n", err.Error())
+			logger.Error("App run failed", logging.Error(err))
+		}
+	}()
+
+	// the market events of the outbox are relayed and the notifications are listened to until the service shuts down
+	publisher, closePublisher := newPublisher(cfg, logger, dispatcher)
+	relay := outbox.NewRelay(repo, publisher,
+		outbox.WithLogger(logger),
+		outbox.WithInterval(cfg.Outbox.Interval, cfg.Outbox.MaxBackoff),
+		outbox.WithBatchSize(cfg.Outbox.BatchSize))
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	var relaying sync.WaitGroup
+	relaying.Add(3)
+	go func() {
+		defer relaying.Done()
+		relay.Run(relayCtx)
+	}()
+	go func() {
+		defer relaying.Done()
+		dispatcher.Run(relayCtx)
+	}()
+	go func() {
+		defer relaying.Done()
+		if err := listener.Run(relayCtx); err != nil {
+			logger.Error("Listen to market notifications failed", logging.Error(err))
 		}
 	}()
+	if invalidator != nil {
+		relaying.Add(1)
+		go func() {
+			defer relaying.Done()
+			invalidator.Run(relayCtx)
+		}()
+	}
+
+	// the grpc server shares the repository of the app
+	var rpcServer *rpc.Server
+	if cfg.Service.GRPCPort > 0 {
+		rpcServer = rpc.New(wagers, rpc.WithSettings(watcher.App), rpc.WithCallers(cfg.Service.Callers),
+			rpc.WithStreamTimeout(cfg.Service.GRPCStreamTimeout), rpc.WithLogger(logger))
+		go func() {
+			if err := rpcServer.Run(cfg.Service.GRPCPort); err != nil {
+				logger.Error("Grpc server run failed", logging.Error(err))
+			}
+		}()
+	}
 
 	// graceful shutdown will be handled here
 	// wait for the signal
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT, os.Kill)
 
-	log.Printf("Received signal %s", <-ch)
+	logger.Info("Received signal", zap.Stringer("signal", <-ch))
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Service.ShutdownTimeout)
 	defer cancel()
 
-	if err = app.Close(ctx); err != nil {
+	// both servers turn not ready and keep serving for the drain delay, then they are shut down together.
+	// the repository they share is closed once both are
+	if rpcServer != nil {
+		rpcServer.Drain()
+	}
+	app.Drain(ctx)
+
+	var closing sync.WaitGroup
+	if rpcServer != nil {
+		closing.Add(1)
+		go func() {
+			defer closing.Done()
+			if err := rpcServer.Close(ctx); err != nil {
+				logger.Error("Close grpc server failed", logging.Error(err))
+			}
+		}()
+	}
+	if err := app.Shutdown(ctx); err != nil {
+		logger.Error("Shutdown http app failed", logging.Error(err))
+	}
+	closing.Wait()
+
+	// the messages left in the outbox are relayed after the restart, the leased deliveries
+	// of the webhooks are retried when their lease expires
+	stopRelay()
+	relaying.Wait()
+	if err := closePublisher(); err != nil {
+		logger.Error("Close outbox publisher failed", logging.Error(err))
+	}
+
+	if err := app.Close(ctx); err != nil {
 		panic(err)
 	}
+	if err := closeCache(); err != nil {
+		logger.Error("Close cache failed", logging.Error(err))
+	}
+
+	// the spans of the last requests are flushed after the server is closed
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("Flush traces failed", logging.Error(err))
+	}
 }
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"wager/internal/domain"
+	"wager/internal/repository/postgres"
+)
+
+func runRebuildProjections(ctx context.Context, repo *postgres.Repository, args []string) error {
+	fs := flag.NewFlagSet("rebuild-projections", flag.ExitOnError)
+	verbose := fs.Bool("v", false, "report every rebuilt wager, not only the changed ones")
+	fs.Parse(args)
+
+	rebuilt, changed := 0, 0
+	err := repo.RebuildProjections(ctx, func(wager domain.Wager, isChanged bool) error {
+		rebuilt++
+		if isChanged {
+			changed++
+		}
+
+		if isChanged || *verbose {
+			fmt.Fprintf(os.Stderr, "wager %d: version %d, changed %t\n", wager.ID, wager.Version, isChanged)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "rebuilt %d wagers, %d of them are changed\n", rebuilt, changed)
+	return nil
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+
+	"wager/internal/domain"
+	"wager/internal/repository/postgres"
+)
+
+const (
+	formatCSV   = "csv"
+	formatJSONL = "jsonl"
+
+	tableWagers    = "wagers"
+	tablePurchases = "purchases"
+
+	// importActor is the actor of the audit events of the imported rows
+	importActor = "wager import"
+
+	// an imported row keeps its id, so an import can be checked against its source
+	// and a row imported twice is rejected as a duplicate
+	errMissingID = "id is required and must be greater than 0"
+)
+
+// record is a row of an exported or imported table
+type record interface {
+	columns() []string
+	toCSV() []string
+	fromCSV(values map[string]string) error
+	validate(ctx context.Context) error
+	save(ctx context.Context, repo *postgres.Repository) error
+}
+
+func runExport(ctx context.Context, repo *postgres.Repository, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	table := fs.String("table", tableWagers, "table to export: wagers or purchases")
+	format := fs.String("format", formatCSV, "output format: csv or jsonl")
+	out := fs.String("out", "", "output file, stdout when it is empty")
+	fs.Parse(args)
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc, err := newEncoder(*format, w)
+	if err != nil {
+		return err
+	}
+
+	switch *table {
+	case tableWagers:
+		err = repo.ExportWagers(ctx, func(wager domain.Wager) error {
+			return enc.encode(&wagerRecord{wager})
+		})
+	case tablePurchases:
+		err = repo.ExportPurchases(ctx, func(purchase domain.Purchase) error {
+			return enc.encode(&purchaseRecord{purchase})
+		})
+	default:
+		return fmt.Errorf("unknown table %s", *table)
+	}
+	if err != nil {
+		return err
+	}
+
+	return enc.flush()
+}
+
+func runImport(ctx context.Context, repo *postgres.Repository, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	table := fs.String("table", tableWagers, "table to import: wagers or purchases")
+	format := fs.String("format", formatCSV, "input format: csv or jsonl")
+	in := fs.String("in", "", "input file, stdin when it is empty")
+	fs.Parse(args)
+
+	r := io.Reader(os.Stdin)
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var newRecord func() record
+	switch *table {
+	case tableWagers:
+		newRecord = func() record { return &wagerRecord{} }
+	case tablePurchases:
+		newRecord = func() record { return &purchaseRecord{} }
+	default:
+		return fmt.Errorf("unknown table %s", *table)
+	}
+
+	dec, err := newDecoder(*format, r, newRecord().columns())
+	if err != nil {
+		return err
+	}
+
+	// the changes of the import are audited as made by the import
+	ctx = domain.WithActor(ctx, importActor)
+
+	imported, rejected, err := importRecords(ctx, dec, newRecord, func(ctx context.Context, rec record) error {
+		return rec.save(ctx, repo)
+	}, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.SyncSequences(ctx); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "imported %d rows, rejected %d rows\n", imported, rejected)
+	return nil
+}
+
+// importRecords decodes, validates and saves every row, every rejected row is reported to report
+// and the import goes on with the next row. only the errors of save which are not caused by the row
+// itself stop the import
+func importRecords(ctx context.Context, dec *decoder, newRecord func() record,
+	save func(ctx context.Context, rec record) error, report io.Writer) (imported, rejected int, err error) {
+	for row := 1; ; row++ {
+		rec := newRecord()
+		err := dec.decode(rec)
+		if err == io.EOF {
+			return imported, rejected, nil
+		}
+
+		if err == nil {
+			err = rec.validate(ctx)
+		}
+
+		if err == nil {
+			if err = save(ctx, rec); err != nil && !isRowError(err) {
+				return imported, rejected, fmt.Errorf("row %d: %w", row, err)
+			}
+		}
+
+		if err != nil {
+			rejected++
+			fmt.Fprintf(report, "rejected row %d: %s\n", row, err.Error())
+			continue
+		}
+		imported++
+	}
+}
+
+// isRowError reports whether the database rejects the row because of its data
+// such as a duplicated id or an unknown wager_id
+func isRowError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	class := pqErr.Code.Class()
+	return class == "22" || class == "23" // data exception, integrity constraint violation
+}
+
+type encoder struct {
+	csv     *csv.Writer
+	json    *json.Encoder
+	started bool
+}
+
+func newEncoder(format string, w io.Writer) (*encoder, error) {
+	switch format {
+	case formatCSV:
+		return &encoder{csv: csv.NewWriter(w)}, nil
+	case formatJSONL:
+		return &encoder{json: json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %s", format)
+	}
+}
+
+func (e *encoder) encode(rec record) error {
+	if e.json != nil {
+		return e.json.Encode(rec)
+	}
+
+	if !e.started {
+		e.started = true
+		if err := e.csv.Write(rec.columns()); err != nil {
+			return err
+		}
+	}
+
+	return e.csv.Write(rec.toCSV())
+}
+
+func (e *encoder) flush() error {
+	if e.csv == nil {
+		return nil
+	}
+
+	e.csv.Flush()
+	return e.csv.Error()
+}
+
+type decoder struct {
+	csv     *csv.Reader
+	header  []string
+	scanner *bufio.Scanner
+}
+
+// newDecoder reads the rows of format from r, the header of a csv must only name the columns of the table
+func newDecoder(format string, r io.Reader, columns []string) (*decoder, error) {
+	switch format {
+	case formatCSV:
+		dec := &decoder{csv: csv.NewReader(r)}
+		dec.csv.ReuseRecord = true
+
+		header, err := dec.csv.Read()
+		if err != nil {
+			return nil, fmt.Errorf("read csv header: %w", err)
+		}
+		if err := checkHeader(header, columns); err != nil {
+			return nil, fmt.Errorf("csv header: %w", err)
+		}
+		dec.header = append([]string{}, header...)
+
+		return dec, nil
+	case formatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+		return &decoder{scanner: scanner}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %s", format)
+	}
+}
+
+// checkHeader rejects a header with a column which is unknown or repeated, so a misspelt column
+// is not imported as empty. the id column is required
+func checkHeader(header, columns []string) error {
+	known := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		known[column] = true
+	}
+
+	seen := make(map[string]bool, len(header))
+	for _, column := range header {
+		switch {
+		case !known[column]:
+			return fmt.Errorf("unknown column %q", column)
+		case seen[column]:
+			return fmt.Errorf("column %q is repeated", column)
+		}
+		seen[column] = true
+	}
+
+	if !seen["id"] {
+		return errors.New("column \"id\" is missing")
+	}
+
+	return nil
+}
+
+// decode the next row into rec, io.EOF is returned after the last row
+func (d *decoder) decode(rec record) error {
+	if d.scanner != nil {
+		if !d.scanner.Scan() {
+			if err := d.scanner.Err(); err != nil {
+				return err
+			}
+			return io.EOF
+		}
+
+		// a misspelt field is rejected like a misspelt csv column
+		dec := json.NewDecoder(bytes.NewReader(d.scanner.Bytes()))
+		dec.DisallowUnknownFields()
+		return dec.Decode(rec)
+	}
+
+	values, err := d.csv.Read()
+	if err != nil {
+		return err
+	}
+
+	row := make(map[string]string, len(d.header))
+	for i, column := range d.header {
+		if i < len(values) {
+			row[column] = values[i]
+		}
+	}
+
+	return rec.fromCSV(row)
+}
+
+type wagerRecord struct {
+	domain.Wager
+}
+
+func (r *wagerRecord) columns() []string {
+	return []string{"id", "total_wager_value", "odds", "selling_percentage", "selling_price",
+		"current_selling_price", "percentage_sold", "amount_sold", "placed_at", "status"}
+}
+
+// MarshalJSON writes the wager with its status, which is not in the json of a wager
+func (r *wagerRecord) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Wager.Snapshot())
+}
+
+// UnmarshalJSON reads the wager with its status, a misspelt field is rejected
+func (r *wagerRecord) UnmarshalJSON(data []byte) error {
+	snapshot := domain.WagerSnapshot{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&snapshot); err != nil {
+		return err
+	}
+
+	r.Wager = snapshot.Restore()
+	return nil
+}
+
+func (r *wagerRecord) toCSV() []string {
+	return []string{
+		strconv.Itoa(r.ID),
+		strconv.Itoa(r.TotalWagerValue),
+		strconv.Itoa(r.Odds),
+		strconv.Itoa(r.SellingPercentage),
+		r.SellingPrice.String(),
+		r.CurrentSellingPrice.String(),
+		formatNullInt(r.PercentageSold),
+		formatNullInt(r.AmountSold),
+		r.PlacedAt.Format(time.RFC3339Nano),
+		r.Status,
+	}
+}
+
+func (r *wagerRecord) fromCSV(values map[string]string) error {
+	p := csvParser{values: values}
+
+	r.ID = p.int("id")
+	r.TotalWagerValue = p.int("total_wager_value")
+	r.Odds = p.int("odds")
+	r.SellingPercentage = p.int("selling_percentage")
+	r.SellingPrice = p.decimal("selling_price")
+	r.CurrentSellingPrice = p.decimal("current_selling_price")
+	r.PercentageSold = p.nullInt("percentage_sold")
+	r.AmountSold = p.nullInt("amount_sold")
+	r.PlacedAt = p.time("placed_at")
+	r.Status = values["status"]
+
+	return p.err
+}
+
+func (r *wagerRecord) validate(ctx context.Context) error {
+	if r.ID <= 0 {
+		return errors.New(errMissingID)
+	}
+
+	if r.CurrentSellingPrice.IsZero() {
+		r.CurrentSellingPrice = r.SellingPrice
+	}
+
+	if err := r.Wager.ValidateStatus(); err != nil {
+		return err
+	}
+
+	return r.Wager.Validate(ctx)
+}
+
+func (r *wagerRecord) save(ctx context.Context, repo *postgres.Repository) error {
+	return repo.ImportWager(ctx, r.Wager)
+}
+
+type purchaseRecord struct {
+	domain.Purchase
+}
+
+func (r *purchaseRecord) columns() []string {
+	return []string{"id", "wager_id", "buying_price", "bought_at"}
+}
+
+func (r *purchaseRecord) toCSV() []string {
+	return []string{
+		strconv.Itoa(r.ID),
+		strconv.Itoa(r.WagerID),
+		r.BuyingPrice.String(),
+		r.BoughtAt.Format(time.RFC3339Nano),
+	}
+}
+
+func (r *purchaseRecord) fromCSV(values map[string]string) error {
+	p := csvParser{values: values}
+
+	r.ID = p.int("id")
+	r.WagerID = p.int("wager_id")
+	r.BuyingPrice = p.decimal("buying_price")
+	r.BoughtAt = p.time("bought_at")
+
+	return p.err
+}
+
+func (r *purchaseRecord) validate(ctx context.Context) error {
+	if r.ID <= 0 {
+		return errors.New(errMissingID)
+	}
+
+	return r.Purchase.Validate(ctx)
+}
+
+func (r *purchaseRecord) save(ctx context.Context, repo *postgres.Repository) error {
+	return repo.ImportPurchase(ctx, r.Purchase)
+}
+
+// csvParser keeps the first parsing error so a row can be parsed without checking every column
+type csvParser struct {
+	values map[string]string
+	err    error
+}
+
+func (p *csvParser) int(column string) int {
+	v := p.nullInt(column)
+	if v == nil {
+		return 0
+	}
+
+	return *v
+}
+
+func (p *csvParser) nullInt(column string) *int {
+	s := p.values[column]
+	if s == "" || p.err != nil {
+		return nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		p.err = fmt.Errorf("%s: %w", column, err)
+		return nil
+	}
+
+	return &v
+}
+
+func (p *csvParser) decimal(column string) decimal.Decimal {
+	s := p.values[column]
+	if s == "" || p.err != nil {
+		return decimal.Zero
+	}
+
+	v, err := decimal.NewFromString(s)
+	if err != nil {
+		p.err = fmt.Errorf("%s: %w", column, err)
+	}
+
+	return v
+}
+
+func (p *csvParser) time(column string) time.Time {
+	s := p.values[column]
+	if s == "" || p.err != nil {
+		return time.Time{}
+	}
+
+	v, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		p.err = fmt.Errorf("%s: %w", column, err)
+	}
+
+	return v
+}
+
+func formatNullInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+
+	return strconv.Itoa(*v)
+}
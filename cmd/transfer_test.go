@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"wager/internal/domain"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestTransferRoundTrip(t *testing.T) {
+	wagers := []domain.Wager{
+		{
+			ID:                  1,
+			TotalWagerValue:     10,
+			Odds:                2,
+			SellingPercentage:   50,
+			SellingPrice:        decimal.RequireFromString("10.11"),
+			CurrentSellingPrice: decimal.RequireFromString("9.50"),
+			PercentageSold:      intPtr(20),
+			AmountSold:          intPtr(2),
+			PlacedAt:            time.Date(2020, 10, 1, 12, 30, 0, 123456000, time.UTC),
+			Status:              domain.WagerStatusSettled,
+		},
+		{
+			ID:                  2,
+			TotalWagerValue:     100,
+			Odds:                1,
+			SellingPercentage:   1,
+			SellingPrice:        decimal.RequireFromString("1.5"),
+			CurrentSellingPrice: decimal.RequireFromString("1.5"),
+			PlacedAt:            time.Date(2020, 10, 2, 0, 0, 0, 0, time.UTC),
+			Status:              domain.WagerStatusOpen,
+		},
+	}
+	purchases := []domain.Purchase{
+		{ID: 1, WagerID: 1, BuyingPrice: decimal.RequireFromString("9.75"), BoughtAt: time.Date(2020, 10, 1, 13, 0, 0, 0, time.UTC)},
+		{ID: 2, WagerID: 1, BuyingPrice: decimal.RequireFromString("9.50"), BoughtAt: time.Date(2020, 10, 1, 14, 0, 0, 0, time.UTC)},
+	}
+
+	tcs := []struct {
+		name      string
+		format    string
+		records   []record
+		newRecord func() record
+	}{
+		{
+			name:      "wagers as csv",
+			format:    formatCSV,
+			records:   []record{&wagerRecord{wagers[0]}, &wagerRecord{wagers[1]}},
+			newRecord: func() record { return &wagerRecord{} },
+		},
+		{
+			name:      "wagers as jsonl",
+			format:    formatJSONL,
+			records:   []record{&wagerRecord{wagers[0]}, &wagerRecord{wagers[1]}},
+			newRecord: func() record { return &wagerRecord{} },
+		},
+		{
+			name:      "purchases as csv",
+			format:    formatCSV,
+			records:   []record{&purchaseRecord{purchases[0]}, &purchaseRecord{purchases[1]}},
+			newRecord: func() record { return &purchaseRecord{} },
+		},
+		{
+			name:      "purchases as jsonl",
+			format:    formatJSONL,
+			records:   []record{&purchaseRecord{purchases[0]}, &purchaseRecord{purchases[1]}},
+			newRecord: func() record { return &purchaseRecord{} },
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			enc, err := newEncoder(tc.format, buf)
+			require.NoError(t, err)
+			for _, rec := range tc.records {
+				require.NoError(t, enc.encode(rec))
+			}
+			require.NoError(t, enc.flush())
+
+			dec, err := newDecoder(tc.format, buf, tc.newRecord().columns())
+			require.NoError(t, err)
+
+			saved := []record{}
+			report := &bytes.Buffer{}
+			imported, rejected, err := importRecords(context.Background(), dec, tc.newRecord,
+				func(ctx context.Context, rec record) error {
+					saved = append(saved, rec)
+					return nil
+				}, report)
+			require.NoError(t, err)
+
+			assert.Equal(t, len(tc.records), imported)
+			assert.Zero(t, rejected)
+			assert.Empty(t, report.String())
+			// the decimals are compared by value, e.g. 9.50 is read back from jsonl as 9.5
+			require.Len(t, saved, len(tc.records))
+			for i := range tc.records {
+				assert.Equal(t, tc.records[i].toCSV(), saved[i].toCSV())
+			}
+		})
+	}
+}
+
+func TestImportRejectsRows(t *testing.T) {
+	wagerHeader := "id,total_wager_value,odds,selling_percentage,selling_price,status\n"
+	purchaseHeader := "id,wager_id,buying_price,bought_at\n"
+
+	tcs := []struct {
+		name      string
+		format    string
+		input     string
+		newRecord func() record
+		imported  int
+		report    []string
+	}{
+		{
+			name:      "bad decimal",
+			format:    formatCSV,
+			input:     wagerHeader + "1,10,1,10,1O.00,open\n2,10,1,10,10.00,open\n",
+			newRecord: func() record { return &wagerRecord{} },
+			imported:  1,
+			report:    []string{"rejected row 1: selling_price: "},
+		},
+		{
+			name:      "missing id",
+			format:    formatCSV,
+			input:     wagerHeader + ",10,1,10,10.00,open\n",
+			newRecord: func() record { return &wagerRecord{} },
+			report:    []string{"rejected row 1: " + errMissingID},
+		},
+		{
+			name:      "unknown status",
+			format:    formatCSV,
+			input:     wagerHeader + "1,10,1,10,10.00,sold\n2,10,1,10,10.00,cancelled\n",
+			newRecord: func() record { return &wagerRecord{} },
+			imported:  1,
+			report:    []string{`rejected row 1: status "sold" ` + domain.ErrInvalidStatus},
+		},
+		{
+			name:      "invalid wager",
+			format:    formatCSV,
+			input:     wagerHeader + "1,0,1,10,10.00,open\n",
+			newRecord: func() record { return &wagerRecord{} },
+			report:    []string{"rejected row 1: " + domain.ErrInvalidTotalWagerValue},
+		},
+		{
+			name:      "bad time",
+			format:    formatCSV,
+			input:     purchaseHeader + "1,1,9.00,yesterday\n2,1,9.00,\n",
+			newRecord: func() record { return &purchaseRecord{} },
+			imported:  1,
+			report:    []string{"rejected row 1: bought_at: "},
+		},
+		{
+			name:      "missing wager id",
+			format:    formatCSV,
+			input:     purchaseHeader + "1,,9.00,\n",
+			newRecord: func() record { return &purchaseRecord{} },
+			report:    []string{"rejected row 1: " + domain.ErrInvalidWagerID},
+		},
+		{
+			name:   "wager jsonl rows",
+			format: formatJSONL,
+			input: `{"id":1,"total_wager_value":10,"odds":1,"selling_percentage":10,"selling_price":"10.00","status":"settled"}
+{"id":2,"total_wager_value":10,"odds":1,"selling_percentage":10,"selling_price":"10.00","status":"sold"}
+{"id":3,"total_wager_value":10,"odds":1,"selling_percentage":10,"selling_price":"10.00","state":"open"}
+`,
+			newRecord: func() record { return &wagerRecord{} },
+			imported:  1,
+			report: []string{
+				`rejected row 2: status "sold" ` + domain.ErrInvalidStatus,
+				`rejected row 3: json: unknown field "state"`,
+			},
+		},
+		{
+			name:   "jsonl rows",
+			format: formatJSONL,
+			input: `{"id":1,"wager_id":1,"buying_price":"0.00"}
+{"wager_id":1,"buying_price":"9.00"}
+{"id":3,"wagerid":1,"buying_price":"9.00"}
+not json
+{"id":5,"wager_id":1,"buying_price":"9.00"}
+`,
+			newRecord: func() record { return &purchaseRecord{} },
+			imported:  1,
+			report: []string{
+				"rejected row 1: " + domain.ErrInvalidBuyingPrice,
+				"rejected row 2: " + errMissingID,
+				`rejected row 3: json: unknown field "wagerid"`,
+				"rejected row 4: invalid character",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			dec, err := newDecoder(tc.format, strings.NewReader(tc.input), tc.newRecord().columns())
+			require.NoError(t, err)
+
+			report := &bytes.Buffer{}
+			imported, rejected, err := importRecords(context.Background(), dec, tc.newRecord,
+				func(ctx context.Context, rec record) error { return nil }, report)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.imported, imported)
+			assert.Equal(t, len(tc.report), rejected)
+
+			lines := strings.Split(strings.TrimSpace(report.String()), "\n")
+			require.Len(t, lines, len(tc.report))
+			for i, prefix := range tc.report {
+				assert.True(t, strings.HasPrefix(lines[i], prefix), "%q does not start with %q", lines[i], prefix)
+			}
+		})
+	}
+}
+
+func TestImportStopsOnDatabaseError(t *testing.T) {
+	dec, err := newDecoder(formatCSV, strings.NewReader("id,wager_id,buying_price\n1,1,9.00\n2,1,9.00\n"),
+		(&purchaseRecord{}).columns())
+	require.NoError(t, err)
+
+	saves := 0
+	imported, rejected, err := importRecords(context.Background(), dec, func() record { return &purchaseRecord{} },
+		func(ctx context.Context, rec record) error {
+			saves++
+			return errors.New("connection refused")
+		}, &bytes.Buffer{})
+
+	assert.EqualError(t, err, "row 1: connection refused")
+	assert.Equal(t, 1, saves)
+	assert.Zero(t, imported)
+	assert.Zero(t, rejected)
+}
+
+func TestDecoderHeader(t *testing.T) {
+	columns := (&wagerRecord{}).columns()
+
+	tcs := []struct {
+		name   string
+		header string
+		err    string
+	}{
+		{name: "every column", header: strings.Join(columns, ",")},
+		{name: "some columns", header: "status,id,selling_price"},
+		{name: "unknown column", header: "id,amount_sol", err: `csv header: unknown column "amount_sol"`},
+		{name: "repeated column", header: "id,odds,odds", err: `csv header: column "odds" is repeated`},
+		{name: "no id", header: "odds,status", err: `csv header: column "id" is missing`},
+		{name: "empty", header: "", err: "read csv header: EOF"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newDecoder(formatCSV, strings.NewReader(tc.header), columns)
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+
+	_, err := newDecoder("xml", strings.NewReader(""), columns)
+	assert.EqualError(t, err, "unknown format xml")
+}
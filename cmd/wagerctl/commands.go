@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"wager/pkg/client"
+)
+
+func runPlace(ctx context.Context, c *client.Client, out *printer, args []string) error {
+	fs := newFlagSet("place")
+	total := fs.Int("total", 0, "total_wager_value of the wager")
+	odds := fs.Int("odds", 0, "odds of the wager")
+	percentage := fs.Int("percentage", 0, "selling_percentage of the wager, between 1 and 100")
+	price := fs.String("price", "", "selling_price of the wager")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	sellingPrice, err := decimal.NewFromString(*price)
+	if err != nil {
+		return fmt.Errorf("invalid price %q", *price)
+	}
+
+	wager, err := c.PlaceWager(ctx, client.Wager{
+		TotalWagerValue:   *total,
+		Odds:              *odds,
+		SellingPercentage: *percentage,
+		SellingPrice:      sellingPrice,
+	})
+	if err != nil {
+		return err
+	}
+
+	return out.wagers(wager)
+}
+
+func runBuy(ctx context.Context, c *client.Client, out *printer, args []string) error {
+	fs := newFlagSet("buy")
+	price := fs.String("price", "", "buying_price of the purchase")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	wagerID, err := wagerIDArg(fs)
+	if err != nil {
+		return err
+	}
+
+	buyingPrice, err := decimal.NewFromString(*price)
+	if err != nil {
+		return fmt.Errorf("invalid price %q", *price)
+	}
+
+	purchase, err := c.BuyWager(ctx, wagerID, buyingPrice)
+	if err != nil {
+		return err
+	}
+
+	return out.purchase(purchase)
+}
+
+func runGet(ctx context.Context, c *client.Client, out *printer, args []string) error {
+	fs := newFlagSet("get")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	wagerID, err := wagerIDArg(fs)
+	if err != nil {
+		return err
+	}
+
+	wager, err := c.GetWager(ctx, wagerID)
+	if err != nil {
+		return err
+	}
+
+	return out.wagers(wager)
+}
+
+func runList(ctx context.Context, c *client.Client, out *printer, args []string) error {
+	fs := newFlagSet("list")
+	page := fs.Int("page", 1, "the wagers after this wager id are listed")
+	limit := fs.Int("limit", 20, "number of wagers of a page")
+	all := fs.Bool("all", false, "list all the wagers from page, page by page")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if !*all {
+		wagers, _, err := c.ListWagers(ctx, *page, *limit)
+		if err != nil {
+			return err
+		}
+		return out.wagers(wagers...)
+	}
+
+	wagers := []client.Wager{}
+	it := c.WagersFrom(*page, *limit)
+	for it.Next(ctx) {
+		wagers = append(wagers, it.Wager())
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	return out.wagers(wagers...)
+}
+
+// runWatch polls a wager and prints it whenever its price or its percentage sold changes
+// it stops once the wager is sold out, or on interrupt. the api does not serve the status so a closed wager
+// is watched until the interrupt
+func runWatch(ctx context.Context, c *client.Client, out *printer, args []string) error {
+	fs := newFlagSet("watch")
+	interval := fs.Duration("interval", 2*time.Second, "time between two polls")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	wagerID, err := wagerIDArg(fs)
+	if err != nil {
+		return err
+	}
+
+	if *interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	var last *client.Wager
+	for {
+		wager, err := c.GetWager(ctx, wagerID)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if last == nil || changed(*last, wager) {
+			if err := out.price(time.Now(), wager); err != nil {
+				return err
+			}
+			last = &wager
+		}
+
+		if wager.SoldOut() {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// changed tells whether a poll of watch is worth printing
+func changed(before, after client.Wager) bool {
+	return !before.CurrentSellingPrice.Equal(after.CurrentSellingPrice) ||
+		optional(before.PercentageSold) != optional(after.PercentageSold)
+}
+
+// newFlagSet of a command, the errors of its flags are returned instead of exiting
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ContinueOnError)
+}
+
+// parse the flags of a command, the flag set prints the error and its usage
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errFlags, err)
+	}
+
+	return nil
+}
+
+// wagerIDArg is the only argument of the command, the id of a wager
+func wagerIDArg(fs *flag.FlagSet) (int, error) {
+	if fs.NArg() != 1 {
+		return 0, fmt.Errorf("%s takes the wager id as its only argument", fs.Name())
+	}
+
+	wagerID, err := strconv.Atoi(fs.Arg(0))
+	if err != nil || wagerID <= 0 {
+		return 0, fmt.Errorf("invalid wager id %q", fs.Arg(0))
+	}
+
+	return wagerID, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"wager/pkg/client"
+)
+
+// response of the fake api
+type response struct {
+	status int
+	header map[string]string
+	body   string
+}
+
+// fakeAPI answers every "METHOD /path?query" with its responses in turn, the last one is repeated
+// the bodies of the requests are kept by the same key
+type fakeAPI struct {
+	mu        sync.Mutex
+	responses map[string][]response
+	requests  map[string][]string
+}
+
+func (api *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	key := r.Method + " " + r.URL.RequestURI()
+	body, _ := ioutil.ReadAll(r.Body)
+	api.requests[key] = append(api.requests[key], string(body))
+
+	responses, ok := api.responses[key]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	res := responses[0]
+	if len(responses) > 1 {
+		api.responses[key] = responses[1:]
+	}
+
+	for k, v := range res.header {
+		w.Header().Set(k, v)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if res.status == 0 {
+		res.status = http.StatusOK
+	}
+	w.WriteHeader(res.status)
+	_, _ = w.Write([]byte(res.body))
+}
+
+const (
+	openWager    = `{"id":1,"total_wager_value":100,"odds":2,"selling_percentage":10,"selling_price":"10.5","current_selling_price":"10.5","placed_at":"2020-01-01T00:00:00Z"}`
+	boughtWager  = `{"id":1,"total_wager_value":100,"odds":2,"selling_percentage":10,"selling_price":"10.5","current_selling_price":"9","percentage_sold":10,"amount_sold":10,"placed_at":"2020-01-01T00:00:00Z"}`
+	soldOutWager = `{"id":1,"total_wager_value":100,"odds":2,"selling_percentage":10,"selling_price":"10.5","current_selling_price":"0","percentage_sold":100,"amount_sold":100,"placed_at":"2020-01-01T00:00:00Z"}`
+)
+
+func TestRun(t *testing.T) {
+	tcs := []struct {
+		name      string
+		args      []string
+		output    string
+		responses map[string][]response
+		// requests are the bodies sent by the command
+		requests map[string][]string
+		// out is in the output in this order
+		out     []string
+		wantErr error
+	}{
+		{
+			name:   "place",
+			args:   []string{"place", "-total", "100", "-odds", "2", "-percentage", "10", "-price", "10.5"},
+			output: outputJSON,
+			responses: map[string][]response{
+				"POST /wagers": {{status: http.StatusCreated, body: openWager}},
+			},
+			requests: map[string][]string{
+				"POST /wagers": {`{"total_wager_value":100,"odds":2,"selling_percentage":10,"selling_price":"10.5"}`},
+			},
+			out: []string{`"id": 1`, `"current_selling_price": "10.5"`},
+		},
+		{
+			name: "buy",
+			args: []string{"buy", "-price", "1.5", "1"},
+			responses: map[string][]response{
+				"POST /buy/1": {{status: http.StatusCreated, body: `{"id":7,"wager_id":1,"buying_price":"1.5","bought_at":"2020-01-01T00:00:00Z"}`}},
+			},
+			requests: map[string][]string{
+				"POST /buy/1": {`{"buying_price":"1.5"}`},
+			},
+			out: []string{"ID", "WAGER", "BUYING PRICE", "7", "1", "1.50"},
+		},
+		{
+			name: "get",
+			args: []string{"get", "1"},
+			responses: map[string][]response{
+				"GET /wagers/1": {{body: boughtWager}},
+			},
+			out: []string{"ID", "CURRENT PRICE", "SOLD %", "1", "10.50", "9.00", "10"},
+		},
+		{
+			name: "get not found",
+			args: []string{"get", "2"},
+			responses: map[string][]response{
+				"GET /wagers/2": {{
+					status: http.StatusNotFound,
+					header: map[string]string{client.HeaderRequestID: "request-1"},
+					body:   `{"code":"wager_not_found","error":"wager is not found"}`,
+				}},
+			},
+			wantErr: client.ErrWagerNotFound,
+		},
+		{
+			name:   "list all",
+			args:   []string{"list", "-page", "1", "-limit", "1", "-all"},
+			output: outputJSON,
+			responses: map[string][]response{
+				"GET /wagers?limit=1&page=1": {{header: map[string]string{client.HeaderNextPage: "2"}, body: `[{"id":2}]`}},
+				"GET /wagers?limit=1&page=2": {{body: `[{"id":3}]`}},
+			},
+			out: []string{`"id": 2`, `"id": 3`},
+		},
+		{
+			name: "watch",
+			args: []string{"watch", "-interval", "1ms", "1"},
+			responses: map[string][]response{
+				"GET /wagers/1": {{body: openWager}, {body: openWager}, {body: boughtWager}, {body: soldOutWager}},
+			},
+			// the polls which do not change the wager are not printed, the watch stops once it is sold out
+			out: []string{"current price 10.50", "current price 9.00  sold 10%", "current price 0.00  sold 100%"},
+		},
+		{name: "no command", wantErr: errUsage},
+		{name: "unknown command", args: []string{"sell", "1"}, wantErr: errUsage},
+		{name: "unknown flag", args: []string{"get", "-all", "1"}, wantErr: errFlags},
+		{name: "unknown output", args: []string{"get", "1"}, output: "yaml"},
+		{name: "missing wager id", args: []string{"get"}},
+		{name: "invalid price", args: []string{"buy", "-price", "free", "1"}},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			api := &fakeAPI{responses: tc.responses, requests: map[string][]string{}}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			if tc.output == "" {
+				tc.output = outputTable
+			}
+
+			out := &bytes.Buffer{}
+			err := run(context.Background(), out, "", "", srv.URL, tc.output, time.Second, tc.args)
+			switch {
+			case tc.wantErr != nil:
+				assert.True(t, errors.Is(err, tc.wantErr), err)
+			case tc.responses == nil:
+				assert.Error(t, err)
+			default:
+				require.NoError(t, err)
+			}
+
+			for key, bodies := range tc.requests {
+				require.Len(t, api.requests[key], len(bodies), key)
+				for i, body := range bodies {
+					assert.JSONEq(t, body, api.requests[key][i], key)
+				}
+			}
+
+			rest := out.String()
+			for _, s := range tc.out {
+				i := strings.Index(rest, s)
+				require.True(t, i >= 0, "%q is not in the output after the previous ones:\n%s", s, out.String())
+				rest = rest[i+len(s):]
+			}
+		})
+	}
+}
+
+func TestRunProfile(t *testing.T) {
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		_, _ = w.Write([]byte(openWager))
+	}))
+	defer srv.Close()
+
+	// the credentials of the environment are sent, the token is sent to this host over http
+	os.Setenv("WAGERCTL_TOKEN", "secret")
+	os.Setenv("WAGERCTL_ACTOR", "qa")
+	defer os.Unsetenv("WAGERCTL_TOKEN")
+	defer os.Unsetenv("WAGERCTL_ACTOR")
+
+	require.NoError(t, run(context.Background(), ioutil.Discard, "", "", srv.URL, outputTable, time.Second, []string{"get", "1"}))
+	assert.Equal(t, "Bearer secret", header.Get("Authorization"))
+	assert.Equal(t, "qa", header.Get("X-Actor"))
+}
+
+func TestDescribe(t *testing.T) {
+	err := &client.Error{StatusCode: http.StatusNotFound, Description: "wager is not found", RequestID: "request-1"}
+	assert.Contains(t, describe(err), "(request id request-1)")
+	assert.Equal(t, "failed", describe(errors.New("failed")))
+}
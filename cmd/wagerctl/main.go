@@ -0,0 +1,132 @@
+// Command wagerctl places, buys, lists and watches wagers through the http api
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"wager/pkg/client"
+)
+
+const usage = `Usage: wagerctl [flags] command [command flags] [args]
+
+Commands:
+    place      place a wager
+    buy        buy a wager: buy -price 1.5 WAGER_ID
+    get        get a wager: get WAGER_ID
+    list       list the wagers
+    watch      poll a wager and print its price whenever it changes: watch WAGER_ID
+    profiles   list the profiles of the config file
+
+Flags:
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	configPath := flag.String("config", defaultConfigPath(), "path of the profiles file")
+	profileName := flag.String("profile", os.Getenv("WAGERCTL_PROFILE"), "profile to use, the current profile of the file by default")
+	baseURL := flag.String("url", os.Getenv("WAGERCTL_URL"), "base url of the api, it overrides the profile")
+	output := flag.String("o", outputTable, "output format: table or json")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of every request")
+	flag.Parse()
+
+	// the first interrupt cancels the command, e.g. stops watching
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-ch
+		cancel()
+		signal.Stop(ch)
+	}()
+
+	err := run(ctx, os.Stdout, *configPath, *profileName, *baseURL, *output, *timeout, flag.Args())
+	if errors.Is(err, errUsage) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	// the flag set of the command has printed its usage
+	if errors.Is(err, errFlags) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "wagerctl: %s\n", describe(err))
+		os.Exit(1)
+	}
+}
+
+var (
+	errUsage = errors.New("invalid usage")
+	errFlags = errors.New("invalid flags")
+)
+
+// run the command of args, its results are written to stdout
+func run(ctx context.Context, stdout io.Writer, configPath, profileName, baseURL, output string,
+	timeout time.Duration, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	out, err := newPrinter(output, stdout)
+	if err != nil {
+		return err
+	}
+
+	profiles, err := loadProfiles(configPath)
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "profiles" {
+		return out.profiles(profiles)
+	}
+
+	profile, err := profiles.get(profileName)
+	if err != nil {
+		return err
+	}
+	if baseURL != "" {
+		profile.URL = baseURL
+	}
+
+	c, err := newClient(profile, timeout)
+	if err != nil {
+		return err
+	}
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "place":
+		return runPlace(ctx, c, out, args)
+	case "buy":
+		return runBuy(ctx, c, out, args)
+	case "get":
+		return runGet(ctx, c, out, args)
+	case "list":
+		return runList(ctx, c, out, args)
+	case "watch":
+		return runWatch(ctx, c, out, args)
+	default:
+		return errUsage
+	}
+}
+
+// describe adds the request id to the errors of the api, so they can be found in the logs of the server
+func describe(err error) string {
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) && apiErr.RequestID != "" {
+		return fmt.Sprintf("%s (request id %s)", err.Error(), apiErr.RequestID)
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"wager/pkg/client"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// printer writes the results as a table or as json
+type printer struct {
+	w      io.Writer
+	asJSON bool
+}
+
+func newPrinter(format string, w io.Writer) (*printer, error) {
+	switch format {
+	case outputTable:
+		return &printer{w: w}, nil
+	case outputJSON:
+		return &printer{w: w, asJSON: true}, nil
+	default:
+		return nil, fmt.Errorf("unknown output %s, it must be %s or %s", format, outputTable, outputJSON)
+	}
+}
+
+func (p *printer) json(v interface{}) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// table writes the header and the rows aligned by column
+func (p *printer) table(header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, cell)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
+
+var wagerHeader = []string{
+	"ID", "TOTAL VALUE", "ODDS", "SELLING %", "SELLING PRICE", "CURRENT PRICE", "SOLD %", "AMOUNT SOLD", "PLACED AT",
+}
+
+func wagerRow(w client.Wager) []string {
+	return []string{
+		strconv.Itoa(w.ID),
+		strconv.Itoa(w.TotalWagerValue),
+		strconv.Itoa(w.Odds),
+		strconv.Itoa(w.SellingPercentage),
+		w.SellingPrice.StringFixed(2),
+		w.CurrentSellingPrice.StringFixed(2),
+		optional(w.PercentageSold),
+		optional(w.AmountSold),
+		w.PlacedAt.Local().Format(time.RFC3339),
+	}
+}
+
+func (p *printer) wagers(wagers ...client.Wager) error {
+	if p.asJSON {
+		if len(wagers) == 1 {
+			return p.json(wagers[0])
+		}
+		return p.json(wagers)
+	}
+
+	rows := make([][]string, 0, len(wagers))
+	for _, w := range wagers {
+		rows = append(rows, wagerRow(w))
+	}
+
+	return p.table(wagerHeader, rows)
+}
+
+func (p *printer) purchase(purchase client.Purchase) error {
+	if p.asJSON {
+		return p.json(purchase)
+	}
+
+	return p.table([]string{"ID", "WAGER", "BUYING PRICE", "BOUGHT AT"}, [][]string{{
+		strconv.Itoa(purchase.ID),
+		strconv.Itoa(purchase.WagerID),
+		purchase.BuyingPrice.StringFixed(2),
+		purchase.BoughtAt.Local().Format(time.RFC3339),
+	}})
+}
+
+// price writes a line of watch, json lines are written so the output can be piped
+func (p *printer) price(at time.Time, w client.Wager) error {
+	if p.asJSON {
+		enc := json.NewEncoder(p.w)
+		return enc.Encode(w)
+	}
+
+	_, err := fmt.Fprintf(p.w, "%s  wager %d  current price %s  sold %s%%\n",
+		at.Local().Format(time.RFC3339), w.ID, w.CurrentSellingPrice.StringFixed(2), optional(w.PercentageSold))
+	return err
+}
+
+// profiles writes the profiles without their tokens
+func (p *printer) profiles(f *profileFile) error {
+	type view struct {
+		Name    string `json:"name"`
+		URL     string `json:"url"`
+		Actor   string `json:"actor,omitempty"`
+		Token   bool   `json:"token"`
+		Current bool   `json:"current"`
+	}
+
+	views := []view{}
+	for _, profile := range f.sorted() {
+		views = append(views, view{
+			Name:    profile.Name,
+			URL:     profile.URL,
+			Actor:   profile.Actor,
+			Token:   profile.Token != "",
+			Current: profile.Name == f.CurrentProfile,
+		})
+	}
+
+	if p.asJSON {
+		return p.json(views)
+	}
+
+	rows := make([][]string, 0, len(views))
+	for _, v := range views {
+		current := ""
+		if v.Current {
+			current = "*"
+		}
+		rows = append(rows, []string{current, v.Name, v.URL, v.Actor, strconv.FormatBool(v.Token)})
+	}
+
+	return p.table([]string{"", "NAME", "URL", "ACTOR", "TOKEN"}, rows)
+}
+
+func optional(v *int) string {
+	if v == nil {
+		return "-"
+	}
+
+	return strconv.Itoa(*v)
+}
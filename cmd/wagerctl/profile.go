@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"wager/pkg/client"
+)
+
+const defaultURL = "http://localhost:8080"
+
+type (
+	// profileFile is the file of the profiles, e.g.
+	//
+	//	current_profile: staging
+	//	profiles:
+	//	    staging:
+	//	        url: https://wager.staging.internal
+	//	        token: secret
+	//	        actor: qa
+	profileFile struct {
+		CurrentProfile string              `yaml:"current_profile"`
+		Profiles       map[string]*profile `yaml:"profiles"`
+	}
+
+	// profile is an api to talk to and the credentials for it
+	profile struct {
+		Name  string `yaml:"-"`
+		URL   string `yaml:"url"`
+		Token string `yaml:"token"` // sent as a bearer token, the api key of the caller or a token of the gateway
+		Actor string `yaml:"actor"` // sent as X-Actor, it is the claimed actor of the audit trail
+	}
+)
+
+// defaultConfigPath is $WAGERCTL_CONFIG or wagerctl.yaml in the user config directory
+func defaultConfigPath() string {
+	if path := os.Getenv("WAGERCTL_CONFIG"); path != "" {
+		return path
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "wagerctl", "config.yaml")
+}
+
+// loadProfiles reads the profiles file, a missing file has no profiles
+func loadProfiles(path string) (*profileFile, error) {
+	file := &profileFile{}
+	if path == "" {
+		return file, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return file, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.UnmarshalStrict(data, file); err != nil {
+		return nil, fmt.Errorf("read profiles %s: %w", path, err)
+	}
+
+	for name, p := range file.Profiles {
+		if p == nil {
+			return nil, fmt.Errorf("profile %s is empty", name)
+		}
+		p.Name = name
+
+		if p.Token != "" {
+			if err := checkPrivate(path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return file, nil
+}
+
+// checkPrivate fails when a file which keeps tokens can be read by others than its owner
+func checkPrivate(path string) error {
+	// windows has no permission bits
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("profiles %s keep tokens so they must only be readable by their owner, "+
+			"its permissions are %#o: chmod 600 %s", path, perm, path)
+	}
+
+	return nil
+}
+
+// get the profile by name, the current profile when the name is empty
+// without profiles the api on localhost is used
+func (f *profileFile) get(name string) (profile, error) {
+	if name == "" {
+		name = f.CurrentProfile
+	}
+
+	if name == "" {
+		p := profile{Name: "default", URL: defaultURL}
+		if len(f.Profiles) == 1 {
+			for _, only := range f.Profiles {
+				p = *only
+			}
+		}
+		return p.withEnv(), nil
+	}
+
+	p, ok := f.Profiles[name]
+	if !ok {
+		return profile{}, fmt.Errorf("profile %s is not found", name)
+	}
+
+	return p.withEnv(), nil
+}
+
+// withEnv overrides the credentials of the profile with $WAGERCTL_TOKEN and $WAGERCTL_ACTOR
+func (p profile) withEnv() profile {
+	if p.URL == "" {
+		p.URL = defaultURL
+	}
+	if token := os.Getenv("WAGERCTL_TOKEN"); token != "" {
+		p.Token = token
+	}
+	if actor := os.Getenv("WAGERCTL_ACTOR"); actor != "" {
+		p.Actor = actor
+	}
+
+	return p
+}
+
+// sorted returns the profiles by name
+func (f *profileFile) sorted() []profile {
+	res := make([]profile, 0, len(f.Profiles))
+	for _, p := range f.Profiles {
+		res = append(res, *p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+
+	return res
+}
+
+// newClient of the api of the profile, the token is only sent over https or to this host
+// so it does not go over the network in clear
+func newClient(p profile, timeout time.Duration) (*client.Client, error) {
+	opts := []client.Option{client.WithHTTPClient(&http.Client{Timeout: timeout})}
+	if p.Token != "" {
+		u, err := url.Parse(p.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url %q: %w", p.URL, err)
+		}
+		if u.Scheme != "https" && !loopback(u.Hostname()) {
+			return nil, fmt.Errorf("the token of profile %s is only sent over https, the url is %s", p.Name, p.URL)
+		}
+
+		opts = append(opts, client.WithHeader("Authorization", "Bearer "+p.Token))
+	}
+	if p.Actor != "" {
+		opts = append(opts, client.WithHeader("X-Actor", p.Actor))
+	}
+
+	return client.New(p.URL, opts...), nil
+}
+
+// loopback tells whether the host is this host
+func loopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
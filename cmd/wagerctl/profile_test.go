@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wagerctl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+current_profile: staging
+profiles:
+    local:
+        url: http://localhost:8080
+    staging:
+        url: https://wager.staging.internal
+        token: secret
+        actor: qa
+`), 0600))
+
+	file, err := loadProfiles(path)
+	require.NoError(t, err)
+
+	p, err := file.get("")
+	require.NoError(t, err)
+	assert.Equal(t, profile{Name: "staging", URL: "https://wager.staging.internal", Token: "secret", Actor: "qa"}, p)
+
+	p, err = file.get("local")
+	require.NoError(t, err)
+	assert.Equal(t, profile{Name: "local", URL: "http://localhost:8080"}, p)
+
+	_, err = file.get("production")
+	assert.Error(t, err)
+
+	// the environment overrides the credentials of the profile
+	os.Setenv("WAGERCTL_TOKEN", "other")
+	defer os.Unsetenv("WAGERCTL_TOKEN")
+	p, err = file.get("staging")
+	require.NoError(t, err)
+	assert.Equal(t, "other", p.Token)
+
+	// the tokens can not be read by the others
+	require.NoError(t, os.Chmod(path, 0644))
+	_, err = loadProfiles(path)
+	assert.Error(t, err)
+
+	// without a file the api on localhost is used
+	file, err = loadProfiles(filepath.Join(dir, "missing.yaml"))
+	require.NoError(t, err)
+	p, err = file.get("")
+	require.NoError(t, err)
+	assert.Equal(t, defaultURL, p.URL)
+
+	// a file without tokens can be read by the others, an unknown field is an error
+	require.NoError(t, ioutil.WriteFile(path, []byte("profiles:\n    local:\n        uri: http://localhost\n"), 0644))
+	_, err = loadProfiles(path)
+	assert.Error(t, err)
+}
+
+func TestNewClient(t *testing.T) {
+	tcs := []struct {
+		name    string
+		profile profile
+		wantErr bool
+	}{
+		{name: "https", profile: profile{URL: "https://wager.staging.internal", Token: "secret"}},
+		{name: "localhost", profile: profile{URL: "http://localhost:8080", Token: "secret"}},
+		{name: "loopback", profile: profile{URL: "http://127.0.0.1:8080", Token: "secret"}},
+		{name: "http without token", profile: profile{URL: "http://wager.staging.internal"}},
+		{name: "http with token", profile: profile{URL: "http://wager.staging.internal", Token: "secret"}, wantErr: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newClient(tc.profile, time.Second)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
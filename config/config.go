@@ -2,18 +2,164 @@ package config
 
 import (
 	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
-// Schema of configurations
-type Schema struct {
+const (
+	redacted = "******"
+
+	// maxWagersInBatch fits the audit events of a batch in one insert, an audit event takes
+	// 10 parameters and postgres allows 65535 parameters in a query
+	maxWagersInBatch = 65535 / 10
+)
+
+var (
+	sslModes = map[string]bool{
+		"disable":     true,
+		"allow":       true,
+		"prefer":      true,
+		"require":     true,
+		"verify-ca":   true,
+		"verify-full": true,
+	}
+
+	dsnPassword = regexp.MustCompile(`password=('(\\.|[^'])*'|\S*)`)
+
+	logLevels = map[string]bool{
+		"debug": true,
+		"info":  true,
+		"warn":  true,
+		"error": true,
+	}
+
+	logFormats = map[string]bool{
+		LogFormatJSON:    true,
+		LogFormatConsole: true,
+	}
+
+	tracingExporters = map[string]bool{
+		TracingExporterNone:   true,
+		TracingExporterStdout: true,
+		TracingExporterFile:   true,
+		TracingExporterOTLP:   true,
+	}
+
+	outboxPublishers = map[string]bool{
+		OutboxPublisherInProcess: true,
+		OutboxPublisherFile:      true,
+		OutboxPublisherNATS:      true,
+	}
+
+	repositoryMiddleware = map[string]bool{
+		RepositoryTracing: true,
+		RepositoryMetrics: true,
+		RepositoryLogging: true,
+		RepositoryRetry:   true,
+	}
+
+	cacheBackends = map[string]bool{
+		CacheBackendNone:   true,
+		CacheBackendMemory: true,
+		CacheBackendRedis:  true,
+	}
+)
+
+// formats of the logs
+const (
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+)
+
+// exporters of the traces
+const (
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterFile   = "file"
+	TracingExporterOTLP   = "otlp"
+)
+
+// publishers of the outbox relay
+const (
+	OutboxPublisherInProcess = "inprocess"
+	OutboxPublisherFile      = "file"
+	OutboxPublisherNATS      = "nats"
+)
+
+// middleware of the wager repository
+const (
+	RepositoryTracing = "tracing"
+	RepositoryMetrics = "metrics"
+	RepositoryLogging = "logging"
+	RepositoryRetry   = "retry"
+)
+
+// backends of the wager cache
+const (
+	CacheBackendNone   = "none"
+	CacheBackendMemory = "memory"
+	CacheBackendRedis  = "redis"
+)
+
+type (
+	// Schema of configurations
+	Schema struct {
+		// Service configuration
+		Service Service `json:"service"`
+		// Database configuration
+		Database Database `json:"database"`
+		// App configuration, the settings of the api
+		App App `json:"app"`
+		// Log configuration
+		Log Log `json:"log"`
+		// Tracing configuration
+		Tracing Tracing `json:"tracing"`
+		// Outbox configuration
+		Outbox Outbox `json:"outbox"`
+		// Webhooks configuration
+		Webhooks Webhooks `json:"webhooks"`
+		// Repository configuration
+		Repository Repository `json:"repository"`
+		// Cache configuration
+		Cache Cache `json:"cache"`
+	}
+
 	// Service configuration
 	Service struct {
 		Port int `json:"port"`
-	} `json:"service"`
+		// GRPCPort is the port of the grpc server, 0 turns it off
+		GRPCPort int `json:"grpc_port"`
+		// GRPCStreamTimeout is the longest a grpc stream is served
+		GRPCStreamTimeout time.Duration `json:"grpc_stream_timeout"`
+		ReadTimeout       time.Duration `json:"read_timeout"`
+		WriteTimeout      time.Duration `json:"write_timeout"`
+		ShutdownTimeout   time.Duration `json:"shutdown_timeout"`
+		// DrainDelay is how long the service keeps serving after it turns not ready at shutdown
+		DrainDelay time.Duration `json:"drain_delay"`
+		// ValidateRequests checks the requests against the OpenAPI document before they reach the handlers
+		ValidateRequests bool `json:"validate_requests"`
+		// ValidateResponses checks the responses too, it is meant for tests and staging
+		ValidateResponses bool `json:"validate_responses"`
+		// Callers are the api keys of the callers by their names, see Callers
+		Callers Callers `json:"callers"`
+		// TrustedProxies are the networks in CIDR notation of the proxies whose X-Forwarded-For is trusted,
+		// the client ip is the remote address of the request without them
+		TrustedProxies []string `json:"trusted_proxies"`
+	}
+
+	// Callers are the api keys of the callers by their names. a request which sends the key of a caller
+	// as a bearer token is made by the caller, it is the actor of the audit trail. the requests without
+	// a key are anonymous
+	Callers map[string]string
+
 	// Database configuration
 	Database struct {
 		Host     string `json:"host"`
@@ -21,11 +167,133 @@ type Schema struct {
 		Port     int    `json:"port"`
 		Username string `json:"username"`
 		Password string `json:"password"`
-	} `json:"database"`
+		SSLMode  string `json:"sslmode"`
+		// ConnectTimeout is the timeout of opening a connection
+		ConnectTimeout time.Duration `json:"connect_timeout"`
+		// StatementTimeout aborts the statements running longer, 0 means no timeout
+		StatementTimeout time.Duration `json:"statement_timeout"`
+		// ConnectRetryTimeout is how long the startup keeps retrying to connect
+		ConnectRetryTimeout time.Duration `json:"connect_retry_timeout"`
+		MaxOpenConns        int           `json:"max_open_conns"`
+		MaxIdleConns        int           `json:"max_idle_conns"`
+		ConnMaxLifetime     time.Duration `json:"conn_max_lifetime"`
+		ConnMaxIdleTime     time.Duration `json:"conn_max_idle_time"`
+		// Replicas are the DSNs of the read replicas, read only queries are sent to them
+		Replicas []string `json:"replicas"`
+		// ReplicaCheckInterval is how often the replicas are pinged for failover
+		ReplicaCheckInterval time.Duration `json:"replica_check_interval"`
+		// ReadYourWritesWindow is how long a client reads from the primary after it writes
+		ReadYourWritesWindow time.Duration `json:"read_your_writes_window"`
+	}
+
+	// App configuration, it can be reloaded while the service is running
+	App struct {
+		MaxWagerInPage   int `json:"max_wager_in_page"`
+		MaxWagersInBatch int `json:"max_wagers_in_batch"`
+		// RateLimit is the number of requests per second allowed to a client ip, 0 means no limit
+		RateLimit float64 `json:"rate_limit"`
+		// RateBurst is the number of requests a client ip can make at once
+		RateBurst int      `json:"rate_burst"`
+		Features  Features `json:"features"`
+	}
+
+	// Features are the flags turning the optional endpoints on and off
+	Features struct {
+		BatchWagers    bool `json:"batch_wagers"`
+		BasketPurchase bool `json:"basket_purchase"`
+		Stats          bool `json:"stats"`
+	}
+
+	// Log configuration, the level can be reloaded while the service is running
+	Log struct {
+		Level string `json:"level"`
+		// Format is json or console
+		Format string `json:"format"`
+	}
+
+	// Tracing configuration
+	Tracing struct {
+		// Exporter is one of none, stdout, file and otlp
+		Exporter string `json:"exporter"`
+		// File is where the file exporter writes the spans
+		File string `json:"file"`
+		// Endpoint is the address of the otlp collector
+		Endpoint string `json:"endpoint"`
+		// SampleRatio is the ratio of the traces started here which are recorded
+		SampleRatio float64 `json:"sample_ratio"`
+	}
+
+	// Outbox configuration, the relay of the market events
+	Outbox struct {
+		// Publisher is one of inprocess, file and nats, the events are always delivered to the webhooks
+		Publisher string `json:"publisher"`
+		// File is where the file publisher appends the events
+		File string `json:"file"`
+		// NATSURL is the address of the nats server
+		NATSURL string `json:"nats_url"`
+		// Subject is the prefix of the nats subjects, the events of wager 1 are published to subject.1
+		Subject string `json:"subject"`
+		// Interval is how often the outbox is polled, a failed delivery is retried after it
+		Interval time.Duration `json:"interval"`
+		// MaxBackoff is the longest wait before a failed delivery is retried
+		MaxBackoff time.Duration `json:"max_backoff"`
+		// BatchSize is the number of messages claimed at once
+		BatchSize int `json:"batch_size"`
+	}
+
+	// Webhooks configuration, the deliveries of the market events to the webhooks
+	Webhooks struct {
+		// Interval is how often the deliveries are polled, a failed delivery is retried after it
+		Interval time.Duration `json:"interval"`
+		// MaxBackoff is the longest wait before a failed delivery is retried
+		MaxBackoff time.Duration `json:"max_backoff"`
+		// MaxAttempts is the number of attempts before a delivery is dead
+		MaxAttempts int `json:"max_attempts"`
+		// BatchSize is the number of deliveries posted at once
+		BatchSize int `json:"batch_size"`
+		// Timeout of a delivery
+		Timeout time.Duration `json:"timeout"`
+		// AllowedNetworks are the networks in CIDR notation which the webhooks may post to although they are
+		// loopback, private or link local, the webhooks can not post to them otherwise
+		AllowedNetworks []string `json:"allowed_networks"`
+	}
+
+	// Repository configuration, the middleware of the wager repository
+	Repository struct {
+		// Middleware wraps the repository in order, the first one is the outermost,
+		// they are tracing, metrics, logging and retry. the cache is always outside of them
+		Middleware []string `json:"middleware"`
+		// RetryAttempts is the number of attempts of a call which fails by a serialization failure or a deadlock
+		RetryAttempts int `json:"retry_attempts"`
+		// RetryBackoff is about the wait before the second attempt, it doubles with every attempt
+		RetryBackoff time.Duration `json:"retry_backoff"`
+		// SlowCall is how long a call takes before it is logged as a warning
+		SlowCall time.Duration `json:"slow_call"`
+	}
+
+	// Cache configuration, the cache of the wager reads
+	Cache struct {
+		// Backend is one of none, memory and redis
+		Backend string `json:"backend"`
+		// Size is the number of entries of the memory backend
+		Size int `json:"size"`
+		// TTL is how long an entry is kept
+		TTL time.Duration `json:"ttl"`
+		// RedisURL is the address of the redis server, redis://[:password@]host:port/db
+		RedisURL string `json:"redis_url"`
+	}
+
+	// ValidationError lists every problem of the configuration
+	ValidationError []string
+)
+
+func (e ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e, "; ")
 }
 
-// Load configuration
-func Load() (*Schema, error) {
+// Load configuration, the defaults are overridden by the file at path if it is not empty
+// then by the environment variables, e.g. DATABASE__HOST overrides database.host
+func Load(path string) (*Schema, error) {
 	v := viper.New()
 
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "__"))
@@ -36,9 +304,200 @@ func Load() (*Schema, error) {
 		return nil, err
 	}
 
+	if path != "" {
+		v.SetConfigFile(path)
+		if err := v.MergeInConfig(); err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+	}
+
 	cfg := Schema{}
 	err := v.Unmarshal(&cfg, func(c *mapstructure.DecoderConfig) {
 		c.TagName = "json"
 	})
-	return &cfg, err
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// Validate the configuration, every problem is reported at once
+func (s *Schema) Validate() error {
+	var errs ValidationError
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(s.Service.Port > 0 && s.Service.Port < 1<<16, "service.port must be between 1 and 65535")
+	check(s.Service.GRPCPort >= 0 && s.Service.GRPCPort < 1<<16, "service.grpc_port must be between 0 and 65535")
+	check(s.Service.GRPCPort != s.Service.Port, "service.grpc_port must differ from service.port")
+	check(s.Service.GRPCStreamTimeout > 0, "service.grpc_stream_timeout must be positive")
+	check(s.Service.ReadTimeout >= 0, "service.read_timeout can not be negative")
+	check(s.Service.WriteTimeout >= 0, "service.write_timeout can not be negative")
+	check(s.Service.ShutdownTimeout > 0, "service.shutdown_timeout must be positive")
+	check(s.Service.DrainDelay >= 0 && s.Service.DrainDelay < s.Service.ShutdownTimeout,
+		"service.drain_delay must be less than service.shutdown_timeout")
+	keys := map[string]bool{}
+	for name, key := range s.Service.Callers {
+		check(key != "", "service.callers %q has no key", name)
+		check(key == "" || !keys[key], "service.callers %q has the key of another caller", name)
+		keys[key] = true
+	}
+	for _, cidr := range s.Service.TrustedProxies {
+		_, _, err := net.ParseCIDR(cidr)
+		check(err == nil, "service.trusted_proxies %q is not a CIDR", cidr)
+	}
+
+	check(s.Database.Host != "", "database.host is required")
+	check(s.Database.Database != "", "database.database is required")
+	check(s.Database.Port > 0 && s.Database.Port < 1<<16, "database.port must be between 1 and 65535")
+	check(s.Database.Username != "", "database.username is required")
+	check(sslModes[s.Database.SSLMode], "database.sslmode %q is unknown", s.Database.SSLMode)
+	check(s.Database.ConnectTimeout >= 0, "database.connect_timeout can not be negative")
+	check(s.Database.StatementTimeout >= 0, "database.statement_timeout can not be negative")
+	check(s.Database.ConnectRetryTimeout > 0, "database.connect_retry_timeout must be positive")
+	check(s.Database.MaxOpenConns >= 0, "database.max_open_conns can not be negative")
+	check(s.Database.MaxIdleConns >= 0, "database.max_idle_conns can not be negative")
+	check(s.Database.MaxOpenConns == 0 || s.Database.MaxIdleConns <= s.Database.MaxOpenConns,
+		"database.max_idle_conns can not be greater than database.max_open_conns")
+	check(s.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime can not be negative")
+	check(s.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time can not be negative")
+	check(len(s.Database.Replicas) == 0 || s.Database.ReplicaCheckInterval > 0,
+		"database.replica_check_interval must be positive when there are replicas")
+	check(s.Database.ReadYourWritesWindow >= 0, "database.read_your_writes_window can not be negative")
+
+	check(s.App.MaxWagerInPage > 0, "app.max_wager_in_page must be positive")
+	check(s.App.MaxWagersInBatch > 0 && s.App.MaxWagersInBatch <= maxWagersInBatch,
+		"app.max_wagers_in_batch must be between 1 and %d", maxWagersInBatch)
+	check(s.App.RateLimit >= 0, "app.rate_limit can not be negative")
+	check(s.App.RateLimit == 0 || s.App.RateBurst > 0, "app.rate_burst must be positive when app.rate_limit is set")
+
+	check(logLevels[s.Log.Level], "log.level %q is unknown", s.Log.Level)
+	check(logFormats[s.Log.Format], "log.format %q is unknown", s.Log.Format)
+
+	check(tracingExporters[s.Tracing.Exporter], "tracing.exporter %q is unknown", s.Tracing.Exporter)
+	check(s.Tracing.Exporter != TracingExporterFile || s.Tracing.File != "",
+		"tracing.file is required by the file exporter")
+	check(s.Tracing.Exporter != TracingExporterOTLP || s.Tracing.Endpoint != "",
+		"tracing.endpoint is required by the otlp exporter")
+	check(s.Tracing.SampleRatio >= 0 && s.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+
+	check(outboxPublishers[s.Outbox.Publisher], "outbox.publisher %q is unknown", s.Outbox.Publisher)
+	check(s.Outbox.Publisher != OutboxPublisherFile || s.Outbox.File != "",
+		"outbox.file is required by the file publisher")
+	check(s.Outbox.Publisher != OutboxPublisherNATS || (s.Outbox.NATSURL != "" && s.Outbox.Subject != ""),
+		"outbox.nats_url and outbox.subject are required by the nats publisher")
+	check(s.Outbox.Interval > 0, "outbox.interval must be positive")
+	check(s.Outbox.MaxBackoff >= s.Outbox.Interval, "outbox.max_backoff can not be less than outbox.interval")
+	check(s.Outbox.BatchSize > 0, "outbox.batch_size must be positive")
+
+	check(s.Webhooks.Interval > 0, "webhooks.interval must be positive")
+	check(s.Webhooks.MaxBackoff >= s.Webhooks.Interval, "webhooks.max_backoff can not be less than webhooks.interval")
+	check(s.Webhooks.MaxAttempts > 0, "webhooks.max_attempts must be positive")
+	check(s.Webhooks.BatchSize > 0, "webhooks.batch_size must be positive")
+	check(s.Webhooks.Timeout > 0, "webhooks.timeout must be positive")
+	for _, cidr := range s.Webhooks.AllowedNetworks {
+		_, _, err := net.ParseCIDR(cidr)
+		check(err == nil, "webhooks.allowed_networks %q is not a CIDR", cidr)
+	}
+
+	seen := map[string]bool{}
+	for _, name := range s.Repository.Middleware {
+		check(repositoryMiddleware[name], "repository.middleware %q is unknown", name)
+		check(!seen[name], "repository.middleware %q is repeated", name)
+		seen[name] = true
+	}
+	check(!seen[RepositoryRetry] || s.Repository.RetryAttempts > 0, "repository.retry_attempts must be positive")
+	check(!seen[RepositoryRetry] || s.Repository.RetryBackoff >= 0, "repository.retry_backoff can not be negative")
+	check(!seen[RepositoryLogging] || s.Repository.SlowCall > 0, "repository.slow_call must be positive")
+
+	check(cacheBackends[s.Cache.Backend], "cache.backend %q is unknown", s.Cache.Backend)
+	check(s.Cache.Backend != CacheBackendMemory || s.Cache.Size > 0, "cache.size must be positive")
+	check(s.Cache.Backend != CacheBackendRedis || s.Cache.RedisURL != "",
+		"cache.redis_url is required by the redis backend")
+	check(s.Cache.Backend == CacheBackendNone || s.Cache.TTL > 0, "cache.ttl must be positive")
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// Find returns the caller of the api key, the keys are compared in constant time
+func (c Callers) Find(key string) (string, bool) {
+	caller, found := "", false
+	for name, k := range c {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			caller, found = name, true
+		}
+	}
+
+	return caller, found
+}
+
+// DSN of the database in the key/value format of lib/pq
+func (d Database) DSN() string {
+	params := []string{
+		"user=" + quoteDSN(d.Username),
+		"dbname=" + quoteDSN(d.Database),
+		"host=" + quoteDSN(d.Host),
+		fmt.Sprintf("port=%d", d.Port),
+		"sslmode=" + quoteDSN(d.SSLMode),
+	}
+
+	if d.ConnectTimeout > 0 {
+		// lib/pq takes the connect timeout in seconds
+		params = append(params, fmt.Sprintf("connect_timeout=%d", int((d.ConnectTimeout+time.Second-1)/time.Second)))
+	}
+
+	if d.StatementTimeout > 0 {
+		params = append(params, fmt.Sprintf("statement_timeout=%d", d.StatementTimeout/time.Millisecond))
+	}
+
+	if d.Password != "" {
+		params = append(params, "password="+quoteDSN(d.Password))
+	}
+
+	return strings.Join(params, " ")
+}
+
+// String is the DSN with the password redacted, it is safe to be logged
+func (d Database) String() string {
+	return RedactDSN(d.DSN())
+}
+
+// RedactDSN hides the password of a key/value or url DSN
+func RedactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+
+		q := u.Query()
+		if q.Get("password") != "" {
+			q.Set("password", redacted)
+			u.RawQuery = q.Encode()
+		}
+
+		return u.String()
+	}
+
+	return dsnPassword.ReplaceAllString(dsn, "password="+redacted)
+}
+
+// quoteDSN quotes a value of a key/value DSN when it is needed
+func quoteDSN(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
 }
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLoad(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, 8080, cfg.Service.Port)
+	assert.Equal(t, "disable", cfg.Database.SSLMode)
+	assert.Equal(t, 20, cfg.App.MaxWagerInPage)
+}
+
+func TestLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "wager.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+service:
+    port: 9090
+    callers:
+        gateway: gateway-key
+        backoffice: backoffice-key
+database:
+    sslmode: require
+    password: secret
+`), 0600))
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, 9090, cfg.Service.Port)
+	assert.Equal(t, "require", cfg.Database.SSLMode)
+	assert.Equal(t, "127.0.0.1", cfg.Database.Host)
+	assert.Contains(t, cfg.Database.DSN(), "password=secret")
+	assert.NotContains(t, cfg.Database.String(), "secret")
+
+	caller, ok := cfg.Service.Callers.Find("backoffice-key")
+	assert.True(t, ok)
+	assert.Equal(t, "backoffice", caller)
+	_, ok = cfg.Service.Callers.Find("backoffice")
+	assert.False(t, ok)
+	_, ok = cfg.Service.Callers.Find("")
+	assert.False(t, ok)
+
+	_, err = Load(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+
+	cfg.Service.Port = 0
+	cfg.Service.GRPCStreamTimeout = 0
+	cfg.Database.SSLMode = "sometimes"
+	cfg.App.MaxWagerInPage = 0
+	cfg.App.MaxWagersInBatch = 6554
+	cfg.Database.ConnectRetryTimeout = 0
+	cfg.Tracing.Exporter = TracingExporterFile
+	cfg.Outbox.Publisher = OutboxPublisherNATS
+	cfg.Webhooks.MaxAttempts = 0
+	cfg.Cache.Backend = CacheBackendRedis
+	cfg.Repository.Middleware = []string{RepositoryMetrics, "audit", RepositoryMetrics, RepositoryLogging}
+	cfg.Repository.SlowCall = 0
+	cfg.Service.Callers = Callers{"gateway": "key", "backoffice": "key"}
+	cfg.Service.TrustedProxies = []string{"10.0.0.0/8", "10.0.0.1"}
+
+	err = cfg.Validate()
+	require.Error(t, err)
+
+	errs, ok := err.(ValidationError)
+	require.True(t, ok)
+	assert.Len(t, errs, 15)
+	assert.Contains(t, errs, "app.max_wagers_in_batch must be between 1 and 6553")
+}
+
+func TestRedactDSN(t *testing.T) {
+	tcs := []struct {
+		dsn      string
+		redacted string
+	}{
+		{
+			dsn:      "host=db password=secret user=postgres",
+			redacted: "host=db password=****** user=postgres",
+		},
+		{
+			dsn:      `host=db password='se cr\'et' user=postgres`,
+			redacted: "host=db password=****** user=postgres",
+		},
+		{
+			dsn:      "postgres://postgres:secret@db:5432/wager?sslmode=disable",
+			redacted: "postgres://postgres:%2A%2A%2A%2A%2A%2A@db:5432/wager?sslmode=disable",
+		},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.redacted, RedactDSN(tc.dsn))
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "wager.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+app:
+    max_wager_in_page: 10
+`), 0600))
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+
+	w := NewWatcher(path, cfg, nil)
+	reloaded := 0
+	w.OnReload(func(cfg *Schema) { reloaded++ })
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+service:
+    port: 9090
+app:
+    max_wager_in_page: 30
+log:
+    level: debug
+`), 0600))
+
+	ignored, err := w.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"service.port"}, ignored)
+	assert.Equal(t, 1, reloaded)
+	assert.Equal(t, 30, w.App().MaxWagerInPage)
+	assert.Equal(t, "debug", w.Current().Log.Level)
+	assert.Equal(t, 8080, w.Current().Service.Port)
+
+	// an invalid file keeps the current configuration
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+app:
+    max_wager_in_page: -1
+`), 0600))
+
+	_, err = w.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, 30, w.App().MaxWagerInPage)
+	assert.Equal(t, 1, reloaded)
+
+	// a failed reload is an error and a change which needs a restart is a warning
+	core, logs := observer.New(zap.InfoLevel)
+	w.logger = zap.New(core)
+	w.reload()
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+service:
+    port: 9090
+`), 0600))
+	w.reload()
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 2)
+	assert.Equal(t, zap.ErrorLevel, entries[0].Level)
+	assert.Equal(t, zap.WarnLevel, entries[1].Level)
+	assert.Equal(t, []interface{}{"service.port"}, entries[1].ContextMap()["ignored"])
+}
@@ -3,10 +3,77 @@ package config
 var defaultValue = `
 service:
     port: 8080
+    grpc_port: 9000
+    grpc_stream_timeout: 1m
+    read_timeout: 10s
+    write_timeout: 10s
+    shutdown_timeout: 15s
+    drain_delay: 5s
+    validate_requests: false
+    validate_responses: false
+    callers: {}
+    trusted_proxies: []
 database:
     host: 127.0.0.1
     database: wager
     port: 13000
     username: postgres
-    password:
+    password: ""
+    sslmode: disable
+    connect_timeout: 5s
+    statement_timeout: 0s
+    connect_retry_timeout: 1m
+    max_open_conns: 20
+    max_idle_conns: 10
+    conn_max_lifetime: 30m
+    conn_max_idle_time: 5m
+    replicas: []
+    replica_check_interval: 5s
+    read_your_writes_window: 5s
+app:
+    max_wager_in_page: 20
+    max_wagers_in_batch: 500
+    rate_limit: 0
+    rate_burst: 0
+    features:
+        batch_wagers: true
+        basket_purchase: true
+        stats: true
+log:
+    level: info
+    format: json
+tracing:
+    exporter: none
+    file: ""
+    endpoint: ""
+    sample_ratio: 1
+outbox:
+    publisher: inprocess
+    file: ""
+    nats_url: ""
+    subject: wager.events
+    interval: 100ms
+    max_backoff: 1m
+    batch_size: 100
+webhooks:
+    interval: 1s
+    max_backoff: 1h
+    max_attempts: 12
+    batch_size: 20
+    timeout: 10s
+    allowed_networks: []
+repository:
+    middleware:
+    - tracing
+    - metrics
+    - logging
+    - retry
+    retry_attempts: 3
+    retry_backoff: 10ms
+    slow_call: 500ms
+cache:
+    backend: none
+    size: 10000
+    ttl: 10s
+    redis_url: ""
 `
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+const (
+	// reloadDelay gathers the bursts of file events of a single save into one reload
+	reloadDelay = 100 * time.Millisecond
+)
+
+// Watcher keeps the configuration up to date with its file
+// the file is reloaded on SIGHUP and whenever it changes, only the app section and the log level
+// are applied, the changes of the other sections need a restart and are reported
+type Watcher struct {
+	path    string
+	current atomic.Value // *Schema
+	logger  *zap.Logger
+
+	mu       sync.Mutex
+	onReload []func(cfg *Schema)
+
+	watching int32
+}
+
+// NewWatcher returns a watcher of the configuration loaded from path, nothing is logged when logger is nil
+func NewWatcher(path string, cfg *Schema, logger *zap.Logger) *Watcher {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	w := &Watcher{path: path, logger: logger}
+	w.current.Store(cfg)
+
+	return w
+}
+
+// Current configuration, it is safe for concurrent use
+func (w *Watcher) Current() *Schema {
+	return w.current.Load().(*Schema)
+}
+
+// App settings of the current configuration, it is safe for concurrent use
+func (w *Watcher) App() App {
+	return w.Current().App
+}
+
+// OnReload registers fn to be called with the new configuration after every reload
+func (w *Watcher) OnReload(fn func(cfg *Schema)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.onReload = append(w.onReload, fn)
+}
+
+// Reload the configuration file and apply the reloadable settings atomically
+// it returns the settings which are changed but can not be applied without a restart
+// the current configuration is kept if the new one is invalid
+func (w *Watcher) Reload() ([]string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	loaded, err := Load(w.path)
+	if err != nil {
+		return nil, err
+	}
+
+	old := w.Current()
+	next := *old
+	next.App = loaded.App
+	next.Log = loaded.Log
+	// the logger is built once, its format can not be changed
+	next.Log.Format = old.Log.Format
+	w.current.Store(&next)
+
+	for _, fn := range w.onReload {
+		fn(&next)
+	}
+
+	var ignored []string
+	ignored = append(ignored, diff("service", old.Service, loaded.Service)...)
+	ignored = append(ignored, diff("database", old.Database, loaded.Database)...)
+	ignored = append(ignored, diff("tracing", old.Tracing, loaded.Tracing)...)
+	ignored = append(ignored, diff("outbox", old.Outbox, loaded.Outbox)...)
+	ignored = append(ignored, diff("webhooks", old.Webhooks, loaded.Webhooks)...)
+	ignored = append(ignored, diff("repository", old.Repository, loaded.Repository)...)
+	ignored = append(ignored, diff("cache", old.Cache, loaded.Cache)...)
+	if loaded.Log.Format != old.Log.Format {
+		ignored = append(ignored, "log.format")
+	}
+
+	return ignored, nil
+}
+
+// Check fails when the watcher is not watching, it is the readiness check of the watcher
+func (w *Watcher) Check(ctx context.Context) error {
+	if atomic.LoadInt32(&w.watching) == 0 {
+		return errors.New("configuration watcher is not running")
+	}
+
+	return nil
+}
+
+// Watch reloads the configuration on SIGHUP and on changes of the file until ctx is done
+func (w *Watcher) Watch(ctx context.Context) error {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+	)
+	if w.path != "" {
+		fw, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		defer fw.Close()
+
+		// editors replace the file on save, so its directory is watched instead of the file
+		if err := fw.Add(filepath.Dir(w.path)); err != nil {
+			return err
+		}
+		events, errs = fw.Events, fw.Errors
+	}
+
+	atomic.StoreInt32(&w.watching, 1)
+	defer atomic.StoreInt32(&w.watching, 0)
+
+	var (
+		timer   = time.NewTimer(0)
+		pending = false
+	)
+	<-timer.C
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+
+		case <-sighup:
+			w.logger.Info("Received SIGHUP, reload configuration")
+			w.reload()
+
+		case e := <-events:
+			if filepath.Clean(e.Name) != filepath.Clean(w.path) || e.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			if !pending {
+				pending = true
+				timer.Reset(reloadDelay)
+			}
+
+		case <-timer.C:
+			pending = false
+			w.logger.Info("Configuration file is changed, reload configuration", zap.String("path", w.path))
+			w.reload()
+
+		case err := <-errs:
+			w.logger.Error("Watch configuration file failed", zap.Error(err))
+		}
+	}
+}
+
+func (w *Watcher) reload() {
+	ignored, err := w.Reload()
+	if err != nil {
+		// logging imports config, so the error is not classified here
+		w.logger.Error("Reload configuration failed, keep the current one", zap.Error(err))
+		return
+	}
+
+	if len(ignored) > 0 {
+		w.logger.Warn("Configuration is reloaded, these changes need a restart", zap.Strings("ignored", ignored))
+		return
+	}
+
+	w.logger.Info("Configuration is reloaded")
+}
+
+// diff returns the json names of the fields which differ between two sections
+func diff(section string, a, b interface{}) []string {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+
+	var changed []string
+	for i := 0; i < va.NumField(); i++ {
+		if reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			continue
+		}
+
+		name := strings.Split(va.Type().Field(i).Tag.Get("json"), ",")[0]
+		changed = append(changed, fmt.Sprintf("%s.%s", section, name))
+	}
+
+	return changed
+}
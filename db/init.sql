@@ -1,3 +1,12 @@
+-- init.sql is schema version 1, the numbered migrations of db/migrations are applied on top of it in order
+-- schema_version is checked by the readiness probe, it must match postgres.SchemaVersion
+CREATE TABLE "schema_version" (
+  "version" int NOT NULL,
+  "applied_at" timestamp NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO "schema_version" ("version") VALUES (1);
+
 CREATE TABLE "wagers" (
   "id" SERIAL PRIMARY KEY,
   "odds" int,
@@ -0,0 +1,22 @@
+-- upgrades a database of schema version 1
+-- a database made before the schema was versioned is version 1
+CREATE TABLE IF NOT EXISTS "schema_version" (
+  "version" int NOT NULL,
+  "applied_at" timestamp NOT NULL DEFAULT NOW()
+);
+
+-- outbox holds the market events of the committed changes until the relay delivers them
+-- SKIP LOCKED needs postgres 9.5
+CREATE TABLE "outbox" (
+  "id" BIGSERIAL PRIMARY KEY,
+  "wager_id" int NOT NULL,
+  "events" jsonb NOT NULL,
+  "attempts" int NOT NULL DEFAULT 0,
+  "last_error" text,
+  "available_at" timestamp NOT NULL DEFAULT NOW(),
+  "created_at" timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX "outbox_wager_id_idx" ON "outbox" ("wager_id", "id");
+
+INSERT INTO "schema_version" ("version") VALUES (2);
@@ -0,0 +1,32 @@
+-- upgrades a database of schema version 2
+-- webhooks are the subscriptions of the partners to the market events
+CREATE TABLE "webhooks" (
+  "id" SERIAL PRIMARY KEY,
+  "url" text NOT NULL,
+  "event_types" text[] NOT NULL DEFAULT '{}',
+  "secret" text NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT NOW()
+);
+
+-- webhook_deliveries is the log of the deliveries, an event is delivered once to a webhook
+CREATE TABLE "webhook_deliveries" (
+  "id" BIGSERIAL PRIMARY KEY,
+  "webhook_id" int NOT NULL REFERENCES "webhooks" ("id"),
+  "event_id" text NOT NULL,
+  "event_type" varchar(32) NOT NULL,
+  "wager_id" int NOT NULL,
+  "payload" jsonb NOT NULL,
+  "status" varchar(16) NOT NULL DEFAULT 'pending',
+  "attempts" int NOT NULL DEFAULT 0,
+  "response_status" int,
+  "last_error" text,
+  "next_attempt_at" timestamp NOT NULL DEFAULT NOW(),
+  "created_at" timestamp NOT NULL DEFAULT NOW(),
+  "delivered_at" timestamp,
+  UNIQUE ("webhook_id", "event_id")
+);
+
+CREATE INDEX "webhook_deliveries_pending_idx" ON "webhook_deliveries" ("next_attempt_at") WHERE "status" = 'pending';
+CREATE INDEX "webhook_deliveries_webhook_id_idx" ON "webhook_deliveries" ("webhook_id", "id");
+
+INSERT INTO "schema_version" ("version") VALUES (3);
@@ -0,0 +1,87 @@
+-- upgrades a database of schema version 3, it runs after 2_outbox.sql and 3_webhooks.sql
+-- the tables are only created when they are missing and only the wagers
+-- which have no events are backfilled
+BEGIN;
+
+ALTER TABLE "wagers" ADD COLUMN IF NOT EXISTS "status" varchar(16) NOT NULL DEFAULT 'open';
+ALTER TABLE "wagers" ADD COLUMN IF NOT EXISTS "version" int NOT NULL DEFAULT 1;
+
+-- audit_events is append only, the events of a wager are chained by hash
+CREATE TABLE IF NOT EXISTS "audit_events" (
+  "id" BIGSERIAL PRIMARY KEY,
+  "wager_id" int NOT NULL,
+  "action" varchar(32) NOT NULL,
+  "actor" text NOT NULL,
+  "request_id" text NOT NULL,
+  "before" json,
+  "after" json,
+  "prev_hash" char(64) NOT NULL,
+  "hash" char(64) NOT NULL,
+  "created_at" timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS "audit_events_wager_id_idx" ON "audit_events" ("wager_id", "id");
+
+CREATE OR REPLACE FUNCTION reject_append_only_change() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION '% is append only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS "audit_events_append_only" ON "audit_events";
+CREATE TRIGGER "audit_events_append_only"
+  BEFORE UPDATE OR DELETE ON "audit_events"
+  FOR EACH ROW EXECUTE PROCEDURE reject_append_only_change();
+
+DROP TRIGGER IF EXISTS "audit_events_no_truncate" ON "audit_events";
+CREATE TRIGGER "audit_events_no_truncate"
+  BEFORE TRUNCATE ON "audit_events"
+  FOR EACH STATEMENT EXECUTE PROCEDURE reject_append_only_change();
+
+-- wager_events is the source of truth of the wagers, the wagers table is their projection
+CREATE TABLE IF NOT EXISTS "wager_events" (
+  "id" BIGSERIAL PRIMARY KEY,
+  "wager_id" int NOT NULL,
+  "version" int NOT NULL,
+  "type" varchar(32) NOT NULL,
+  "data" jsonb NOT NULL,
+  "occurred_at" timestamp NOT NULL DEFAULT NOW(),
+  UNIQUE ("wager_id", "version")
+);
+
+DROP TRIGGER IF EXISTS "wager_events_append_only" ON "wager_events";
+CREATE TRIGGER "wager_events_append_only"
+  BEFORE UPDATE OR DELETE ON "wager_events"
+  FOR EACH ROW EXECUTE PROCEDURE reject_append_only_change();
+
+DROP TRIGGER IF EXISTS "wager_events_no_truncate" ON "wager_events";
+CREATE TRIGGER "wager_events_no_truncate"
+  BEFORE TRUNCATE ON "wager_events"
+  FOR EACH STATEMENT EXECUTE PROCEDURE reject_append_only_change();
+
+-- a wager made before the event stream is placed with its current state, like an imported wager,
+-- so its purchases are not replayed on top of it. the row is the projection of this first event,
+-- its version is already 1. the lock keeps the api from placing a wager meanwhile.
+-- placed_at is in the time zone of the server, it is written in UTC
+LOCK TABLE "wagers" IN SHARE ROW EXCLUSIVE MODE;
+
+INSERT INTO "wager_events" ("wager_id", "version", "type", "data", "occurred_at")
+SELECT w."id", 1, 'placed', json_build_object(
+    'id', w."id",
+    'total_wager_value', w."total_wager_value",
+    'odds', w."odds",
+    'selling_percentage', w."selling_percentage",
+    'selling_price', w."selling_price"::text,
+    'current_selling_price', w."current_selling_price"::text,
+    'percentage_sold', w."percentage_sold",
+    'amount_sold', w."amount_sold",
+    'placed_at', to_char(w."placed_at" AT TIME ZONE current_setting('TimeZone') AT TIME ZONE 'UTC',
+      'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+    'status', w."status"
+  )::jsonb, w."placed_at"
+FROM "wagers" w
+WHERE NOT EXISTS (SELECT 1 FROM "wager_events" e WHERE e."wager_id" = w."id");
+
+INSERT INTO "schema_version" ("version") VALUES (4);
+
+COMMIT;
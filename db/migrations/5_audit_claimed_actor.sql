@@ -0,0 +1,6 @@
+-- upgrades a database of schema version 4
+-- the actor of an audit event is the authenticated caller, the X-Actor header is only kept as who the caller
+-- says it acts for. the events written before are left as they are, their hashes do not cover the new column
+ALTER TABLE "audit_events" ADD COLUMN "claimed_actor" text NOT NULL DEFAULT '';
+
+INSERT INTO "schema_version" ("version") VALUES (5);
@@ -0,0 +1,18 @@
+-- upgrades a database of schema version 5
+-- idempotency_keys keeps the responses of the idempotency keys of every caller, a key is written
+-- in the transaction of the writes of its request so they are committed together
+CREATE TABLE "idempotency_keys" (
+  "scope" text NOT NULL,
+  "key" text NOT NULL,
+  "request_hash" bytea NOT NULL,
+  "status" int,
+  "content_type" text,
+  "body" bytea,
+  "created_at" timestamp NOT NULL DEFAULT NOW(),
+  "expires_at" timestamp NOT NULL,
+  PRIMARY KEY ("scope", "key")
+);
+
+CREATE INDEX "idempotency_keys_expires_at_idx" ON "idempotency_keys" ("expires_at");
+
+INSERT INTO "schema_version" ("version") VALUES (6);
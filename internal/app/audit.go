@@ -0,0 +1,83 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"wager/internal/domain"
+	"wager/internal/logging"
+)
+
+const (
+	// headerActor is who the caller says it acts for, it is recorded as the claimed actor and never trusted
+	headerActor = "X-Actor"
+
+	bearerPrefix = "Bearer "
+)
+
+// AuditTrailResponse ...
+type AuditTrailResponse struct {
+	Events   []domain.AuditEvent `json:"events"`
+	Verified bool                `json:"verified"`
+	BrokenAt int64               `json:"broken_at,omitempty"` // id of the first event which breaks the hash chain
+}
+
+// authenticate puts the caller of the api key of the request into its context as the actor, and the X-Actor
+// header as the claimed actor. a request without a key is anonymous, one with an unknown key is rejected.
+// the Authorization header is left to the gateway when there are no callers. the request id is put by requestID
+func (app *App) authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		req := ctx.Request()
+		reqCtx := domain.WithClaimedActor(req.Context(), req.Header.Get(headerActor))
+
+		if auth := req.Header.Get(echo.HeaderAuthorization); auth != "" && len(app.service.Callers) > 0 {
+			caller, ok := "", false
+			if strings.HasPrefix(auth, bearerPrefix) {
+				caller, ok = app.service.Callers.Find(strings.TrimPrefix(auth, bearerPrefix))
+			}
+			if !ok {
+				return ctx.JSON(http.StatusUnauthorized, ErrorResponse{Description: "api key is not valid"})
+			}
+			reqCtx = domain.WithActor(reqCtx, caller)
+		}
+
+		ctx.SetRequest(req.WithContext(reqCtx))
+
+		return next(ctx)
+	}
+}
+
+func (app *App) getAuditTrail(ctx echo.Context) error {
+	if app.audit == nil {
+		return ctx.JSON(http.StatusNotImplemented, ErrorResponse{Description: "audit trail is not available"})
+	}
+
+	wagerID, err := strconv.Atoi(ctx.Param("wager_id"))
+	if err != nil || wagerID <= 0 {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: domain.ErrInvalidWagerID})
+	}
+
+	events, err := app.audit.AuditTrail(ctx.Request().Context(), wagerID)
+	if err != nil {
+		app.logFailure(ctx, http.StatusInternalServerError, "Get audit trail failed", err, zap.Int("wager_id", wagerID))
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Description: err.Error()})
+	}
+
+	if len(events) == 0 {
+		return ctx.JSON(http.StatusNotFound, errorResponse(domain.ErrWagerNotFound))
+	}
+
+	res := AuditTrailResponse{Events: events, Verified: true}
+	if brokenAt, err := domain.VerifyAuditTrail(events); err != nil {
+		app.log(ctx).Error("Audit trail is broken",
+			zap.Int("wager_id", wagerID), zap.Int64("broken_at", brokenAt), logging.Error(err))
+		res.Verified = false
+		res.BrokenAt = brokenAt
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
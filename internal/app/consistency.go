@@ -0,0 +1,58 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"wager/internal/domain"
+)
+
+const (
+	// cookieFreshReadUntil holds the unix millisecond until which the client reads from the primary
+	cookieFreshReadUntil = "wager_fresh_read_until"
+)
+
+// WithReadYourWrites makes a client read from the primary for the window after it places or buys,
+// so it sees its own writes even if the replicas are lagging
+func WithReadYourWrites(window time.Duration) Option {
+	return func(app *App) {
+		app.freshReadWindow = window
+	}
+}
+
+// freshRead marks the request context for fresh reads while the client is in its window
+func freshRead(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		cookie, err := ctx.Cookie(cookieFreshReadUntil)
+		if err != nil {
+			return next(ctx)
+		}
+
+		until, err := strconv.ParseInt(cookie.Value, 10, 64)
+		if err == nil && time.Now().Before(time.Unix(0, until*int64(time.Millisecond))) {
+			req := ctx.Request()
+			ctx.SetRequest(req.WithContext(domain.WithFreshRead(req.Context())))
+		}
+
+		return next(ctx)
+	}
+}
+
+// markWritten starts the fresh read window of the client, it must be called before the response is written
+func (app *App) markWritten(ctx echo.Context) {
+	if app.freshReadWindow <= 0 {
+		return
+	}
+
+	until := time.Now().Add(app.freshReadWindow)
+	ctx.SetCookie(&http.Cookie{
+		Name:     cookieFreshReadUntil,
+		Value:    strconv.FormatInt(until.UnixNano()/int64(time.Millisecond), 10),
+		Path:     "/",
+		Expires:  until,
+		HttpOnly: true,
+	})
+}
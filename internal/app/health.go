@@ -0,0 +1,170 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	healthStatusOK       = "ok"
+	healthStatusDegraded = "degraded"
+	checkStatusFail      = "fail"
+	readyStatusReady     = "ready"
+	readyStatusNotReady  = "not_ready"
+
+	healthPingTimeout = time.Second
+	readyCheckTimeout = 2 * time.Second
+)
+
+// DatabaseStatus reports the state of the database connection
+type DatabaseStatus interface {
+	Ping(ctx context.Context) error
+	PoolStats() sql.DBStats
+}
+
+type (
+	// HealthResponse ...
+	HealthResponse struct {
+		Status   string          `json:"status"`
+		Database *DatabaseHealth `json:"database,omitempty"`
+	}
+
+	// DatabaseHealth is the state of the database connection and its pool
+	DatabaseHealth struct {
+		Status             string        `json:"status"`
+		Error              string        `json:"error,omitempty"`
+		MaxOpenConnections int           `json:"max_open_connections"`
+		OpenConnections    int           `json:"open_connections"`
+		InUse              int           `json:"in_use"`
+		Idle               int           `json:"idle"`
+		WaitCount          int64         `json:"wait_count"`
+		WaitDuration       time.Duration `json:"wait_duration"`
+		MaxIdleClosed      int64         `json:"max_idle_closed"`
+		MaxLifetimeClosed  int64         `json:"max_lifetime_closed"`
+	}
+)
+
+type (
+	// ReadyResponse ...
+	ReadyResponse struct {
+		Status string                 `json:"status"`
+		Checks map[string]CheckResult `json:"checks"`
+	}
+
+	// CheckResult is the result of a readiness check of a dependency
+	CheckResult struct {
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}
+
+	readinessCheck struct {
+		name  string
+		check func(ctx context.Context) error
+	}
+)
+
+// WithReadinessCheck adds a dependency the app needs to serve requests, such as the database
+// or a background worker, the app is not ready while check fails
+func WithReadinessCheck(name string, check func(ctx context.Context) error) Option {
+	return func(app *App) {
+		app.checks = append(app.checks, readinessCheck{name: name, check: check})
+	}
+}
+
+// WithDatabaseStatus reports the database connection in the health check
+func WithDatabaseStatus(db DatabaseStatus) Option {
+	return func(app *App) {
+		app.db = db
+	}
+}
+
+// this is for health check procedure
+// the database is degraded when it does not answer or every connection of the pool is in use
+func (app *App) healthCheck(e echo.Context) error {
+	res := HealthResponse{Status: healthStatusOK}
+	if app.db == nil {
+		return e.JSON(http.StatusOK, res)
+	}
+
+	stats := app.db.PoolStats()
+	db := &DatabaseHealth{
+		Status:             healthStatusOK,
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDuration:       stats.WaitDuration,
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+
+	ctx, cancel := context.WithTimeout(e.Request().Context(), healthPingTimeout)
+	defer cancel()
+
+	if err := app.db.Ping(ctx); err != nil {
+		db.Status = healthStatusDegraded
+		db.Error = err.Error()
+	} else if stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections {
+		db.Status = healthStatusDegraded
+		db.Error = "every connection of the pool is in use"
+	}
+
+	res.Status = db.Status
+	res.Database = db
+
+	return e.JSON(http.StatusOK, res)
+}
+
+// liveCheck only tells the process is up, it never checks the dependencies
+// so a broken dependency does not get the process restarted
+func (app *App) liveCheck(e echo.Context) error {
+	return e.JSON(http.StatusOK, "OK")
+}
+
+// readyCheck runs every readiness check concurrently, the app is ready when all of them pass
+// and it is not draining
+func (app *App) readyCheck(e echo.Context) error {
+	ctx, cancel := context.WithTimeout(e.Request().Context(), readyCheckTimeout)
+	defer cancel()
+
+	results := make([]CheckResult, len(app.checks))
+	var wg sync.WaitGroup
+	for i, c := range app.checks {
+		wg.Add(1)
+		go func(i int, c readinessCheck) {
+			defer wg.Done()
+
+			results[i] = CheckResult{Status: healthStatusOK}
+			if err := c.check(ctx); err != nil {
+				results[i] = CheckResult{Status: checkStatusFail, Error: err.Error()}
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	res := ReadyResponse{Status: readyStatusReady, Checks: make(map[string]CheckResult, len(app.checks)+1)}
+	for i, c := range app.checks {
+		res.Checks[c.name] = results[i]
+		if results[i].Status != healthStatusOK {
+			res.Status = readyStatusNotReady
+		}
+	}
+
+	if atomic.LoadInt32(&app.draining) == 1 {
+		res.Status = readyStatusNotReady
+		res.Checks["shutdown"] = CheckResult{Status: checkStatusFail, Error: "the app is draining"}
+	}
+
+	if res.Status != readyStatusReady {
+		return e.JSON(http.StatusServiceUnavailable, res)
+	}
+
+	return e.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,281 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"wager/internal/domain"
+)
+
+const (
+	// HeaderIdempotencyKey is the header of the key a client sends to retry a write safely
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed is set on the responses which are replayed for a retried key
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	// the responses are kept this long for the retries of a key
+	idempotencyKeyTTL     = 24 * time.Hour
+	idempotencyKeyCleanup = 1024
+	// idempotencyMaxKeys is the most keys which are kept in memory, the new keys are rejected until some expire
+	idempotencyMaxKeys = 100000
+	// idempotencyMaxBody is the largest request with a key
+	idempotencyMaxBody = 4 << 20
+)
+
+// errIdempotencyFull is returned when there are too many keys to keep another one
+var errIdempotencyFull = errors.New("too many idempotency keys, retry later")
+
+// WithIdempotency keeps the responses of the idempotency keys in the repository, so the retries can reach
+// any instance. the writes of a request with a key must be made with the context they are served with,
+// they are committed with its response. the responses are kept in memory by default
+func WithIdempotency(idempotency domain.IdempotencyRepository) Option {
+	return func(app *App) {
+		app.idempotency = idempotency
+	}
+}
+
+// idempotent replays the response of the first request of an Idempotency-Key instead of serving the request again,
+// so a client can retry a write which timed out without placing or buying twice
+// the keys of the callers are kept apart, and a request which comes while the first one is in flight waits for it.
+// the response is sent once it is kept, the server errors are not kept so they can be retried
+func (app *App) idempotent(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		key := ctx.Request().Header.Get(HeaderIdempotencyKey)
+		if key == "" {
+			return next(ctx)
+		}
+
+		if len(key) > maxRequestIDLength {
+			return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: "idempotency key is too long"})
+		}
+
+		fingerprint, status, err := requestFingerprint(ctx)
+		if err != nil {
+			return ctx.JSON(status, ErrorResponse{Description: err.Error()})
+		}
+
+		req, res := ctx.Request(), ctx.Response()
+		writer := res.Writer
+		buffer := &bufferedWriter{ResponseWriter: writer}
+		var handlerErr error
+		served, replayed, err := app.idempotency.Idempotent(req.Context(), domain.IdempotencyKey{
+			Scope:       callerScope(ctx),
+			Key:         key,
+			RequestHash: fingerprint,
+		}, func(txCtx context.Context) (domain.IdempotentResponse, bool, error) {
+			// the response is held back until it is kept, it is sent through echo again below
+			ctx.SetRequest(req.WithContext(txCtx))
+			res.Writer = buffer
+			defer func() {
+				ctx.SetRequest(req)
+				res.Writer = writer
+			}()
+
+			handlerErr = next(ctx)
+			status := buffer.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			return domain.IdempotentResponse{
+				Status:      status,
+				ContentType: writer.Header().Get(echo.HeaderContentType),
+				Body:        buffer.body.Bytes(),
+			}, handlerErr == nil && res.Committed && status < http.StatusInternalServerError, nil
+		})
+		res.Committed = false
+		res.Size = 0
+		if handlerErr != nil {
+			return handlerErr
+		}
+
+		switch {
+		case errors.Is(err, domain.ErrIdempotencyKeyReused):
+			return ctx.JSON(http.StatusUnprocessableEntity, ErrorResponse{Description: err.Error()})
+		case errors.Is(err, errIdempotencyFull):
+			return ctx.JSON(http.StatusServiceUnavailable, ErrorResponse{Description: err.Error()})
+		case err != nil:
+			if req.Context().Err() != nil {
+				return err
+			}
+			app.logFailure(ctx, http.StatusInternalServerError, "Idempotent request failed", err)
+			return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Description: err.Error()})
+		}
+
+		if replayed {
+			header := res.Header()
+			header.Set(HeaderIdempotentReplayed, "true")
+			if served.ContentType != "" {
+				header.Set(echo.HeaderContentType, served.ContentType)
+			}
+		}
+		res.WriteHeader(served.Status)
+		_, err = res.Write(served.Body)
+		return err
+	}
+}
+
+// callerScope keeps the keys of the callers apart, the anonymous callers are told apart by their ip,
+// which is only read from the headers of the trusted proxies, see ipExtractor
+func callerScope(ctx echo.Context) string {
+	if actor := domain.ActorFromContext(ctx.Request().Context()); actor != domain.AnonymousActor {
+		return "caller:" + actor
+	}
+
+	return "ip:" + ctx.RealIP()
+}
+
+// requestFingerprint tells the requests of a key apart, the body is put back for the handler.
+// the status is the one of the response when the body can not be read
+func requestFingerprint(ctx echo.Context) ([]byte, int, error) {
+	req := ctx.Request()
+	body, err := ioutil.ReadAll(http.MaxBytesReader(ctx.Response(), req.Body, idempotencyMaxBody))
+	if err != nil {
+		if len(body) >= idempotencyMaxBody {
+			return nil, http.StatusRequestEntityTooLarge, err
+		}
+		return nil, http.StatusBadRequest, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	sum := sha256.Sum256(append([]byte(req.Method+" "+req.URL.Path+"\n"), body...))
+	return sum[:], 0, nil
+}
+
+// idempotencyStore keeps the responses of up to maxKeys keys in memory, it serves a single instance as the
+// retries must reach the instance which keeps the key, and the writes of a request are not undone with it
+type idempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	calls   int
+	maxKeys int
+}
+
+// idempotencyEntry is the response of a key, it is filled once done is closed
+type idempotencyEntry struct {
+	requestHash []byte
+	expires     time.Time
+	done        chan struct{}
+
+	res domain.IdempotentResponse
+}
+
+func newIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{entries: map[string]*idempotencyEntry{}, maxKeys: idempotencyMaxKeys}
+}
+
+// Idempotent implements domain.IdempotencyRepository, it fails with errIdempotencyFull when a new key can not be kept
+func (s *idempotencyStore) Idempotent(ctx context.Context, key domain.IdempotencyKey,
+	fn domain.IdempotentFunc) (domain.IdempotentResponse, bool, error) {
+	id := key.Scope + "\x00" + key.Key
+
+	for {
+		entry, first, err := s.acquire(id, key.RequestHash, time.Now())
+		if err != nil {
+			return domain.IdempotentResponse{}, false, err
+		}
+		if first {
+			return s.serve(ctx, id, entry, fn)
+		}
+
+		if !bytes.Equal(entry.requestHash, key.RequestHash) {
+			return domain.IdempotentResponse{}, false, domain.ErrIdempotencyKeyReused
+		}
+
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return domain.IdempotentResponse{}, false, ctx.Err()
+		}
+
+		// the first request failed so this one is served instead
+		if entry.res.Status == 0 {
+			continue
+		}
+
+		return entry.res, true, nil
+	}
+}
+
+// serve serves the first request of a key with fn and keeps its response
+func (s *idempotencyStore) serve(ctx context.Context, id string, entry *idempotencyEntry,
+	fn domain.IdempotentFunc) (domain.IdempotentResponse, bool, error) {
+	// the entry is released when fn fails, even when it panics
+	kept := false
+	defer func() {
+		if !kept {
+			s.release(id, entry)
+		}
+	}()
+
+	res, keep, err := fn(ctx)
+	if err != nil || !keep {
+		return res, false, err
+	}
+
+	entry.res = res
+	close(entry.done)
+	kept = true
+
+	return res, false, nil
+}
+
+// acquire returns the entry of the key, first is true when the caller has to serve the request and fill it.
+// it fails with errIdempotencyFull when a new key can not be kept
+func (s *idempotencyStore) acquire(id string, requestHash []byte,
+	now time.Time) (entry *idempotencyEntry, first bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if s.calls%idempotencyKeyCleanup == 0 {
+		s.expire(now)
+	}
+
+	if e, ok := s.entries[id]; ok && now.Before(e.expires) {
+		return e, false, nil
+	}
+
+	if len(s.entries) >= s.maxKeys {
+		if s.expire(now); len(s.entries) >= s.maxKeys {
+			return nil, false, errIdempotencyFull
+		}
+	}
+
+	entry = &idempotencyEntry{
+		requestHash: requestHash,
+		expires:     now.Add(idempotencyKeyTTL),
+		done:        make(chan struct{}),
+	}
+	s.entries[id] = entry
+
+	return entry, true, nil
+}
+
+// expire removes the entries which are expired
+func (s *idempotencyStore) expire(now time.Time) {
+	for k, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+// release forgets the entry of a request which failed, the requests waiting for it are served again
+func (s *idempotencyStore) release(id string, entry *idempotencyEntry) {
+	s.mu.Lock()
+	if s.entries[id] == entry {
+		delete(s.entries, id)
+	}
+	s.mu.Unlock()
+
+	close(entry.done)
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"wager/internal/domain"
+	"wager/internal/logging"
+)
+
+// maxRequestIDLength is the longest request id taken from a client, a longer one is replaced
+const maxRequestIDLength = 128
+
+// WithLogger sets the logger of the app, nothing is logged by default
+func WithLogger(logger *zap.Logger) Option {
+	return func(app *App) {
+		app.logger = logger
+	}
+}
+
+// WithLogLevel is the level of the logger of the app, SetLogLevel changes it
+func WithLogLevel(level zap.AtomicLevel) Option {
+	return func(app *App) {
+		app.logLevel = &level
+	}
+}
+
+// requestID puts the request id of the request into its context and echoes it in the response
+// a request without an id gets a new one
+func requestID(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		req := ctx.Request()
+
+		id := req.Header.Get(echo.HeaderXRequestID)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+
+		ctx.SetRequest(req.WithContext(domain.WithRequestID(req.Context(), id)))
+		ctx.Response().Header().Set(echo.HeaderXRequestID, id)
+
+		return next(ctx)
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// accessLog logs every request once it is served
+func (app *App) accessLog(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		start := time.Now()
+		err := next(ctx)
+		if err != nil {
+			// let echo write the error response so its status is logged
+			ctx.Error(err)
+		}
+
+		res := ctx.Response()
+		fields := []zap.Field{
+			zap.String("method", ctx.Request().Method),
+			zap.String("route", ctx.Path()),
+			zap.String("path", ctx.Request().URL.Path),
+			zap.Int("status", res.Status),
+			zap.Int64("size", res.Size),
+			zap.Duration("latency", time.Since(start)),
+			logging.Error(err),
+		}
+
+		logger := app.log(ctx)
+		switch {
+		case res.Status >= 500:
+			logger.Error("Request failed", fields...)
+		case res.Status >= 400:
+			logger.Info("Request rejected", fields...)
+		default:
+			logger.Info("Request served", fields...)
+		}
+
+		return nil
+	}
+}
+
+// log returns the logger of the request
+func (app *App) log(ctx echo.Context) *zap.Logger {
+	return logging.WithRequest(ctx.Request().Context(), app.logger)
+}
+
+// logFailure logs a failed call of the repository, only the server errors are logged as errors
+func (app *App) logFailure(ctx echo.Context, status int, msg string, err error, fields ...zap.Field) {
+	fields = append(fields, logging.Error(err))
+	if status >= 500 {
+		app.log(ctx).Error(msg, fields...)
+		return
+	}
+
+	app.log(ctx).Info(msg, fields...)
+}
@@ -0,0 +1,545 @@
+package app
+
+// openAPISpec is the OpenAPI 3 document of every route of the app, it is served at /openapi.json
+// the routes of New and this document are checked against each other by the tests
+const openAPISpec = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Wager",
+    "description": "Place wagers and buy them.",
+    "version": "1.0.0"
+  },
+  "paths": {
+    "/health": {
+      "get": {
+        "summary": "Health of the service and its database connection",
+        "operationId": "healthCheck",
+        "responses": {
+          "200": {"description": "Health", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/HealthResponse"}}}}
+        }
+      }
+    },
+    "/live": {
+      "get": {
+        "summary": "The process is up",
+        "operationId": "liveCheck",
+        "responses": {
+          "200": {"description": "Live", "content": {"application/json": {"schema": {"type": "string"}}}}
+        }
+      }
+    },
+    "/ready": {
+      "get": {
+        "summary": "The service can serve requests",
+        "operationId": "readyCheck",
+        "responses": {
+          "200": {"description": "Ready", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ReadyResponse"}}}},
+          "503": {"description": "Not ready", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ReadyResponse"}}}}
+        }
+      }
+    },
+    "/metrics": {
+      "get": {
+        "summary": "Prometheus metrics",
+        "operationId": "metrics",
+        "responses": {
+          "200": {"description": "Metrics in the Prometheus text format", "content": {"text/plain": {"schema": {"type": "string"}}}}
+        }
+      }
+    },
+    "/openapi.json": {
+      "get": {
+        "summary": "This document",
+        "operationId": "openAPI",
+        "responses": {
+          "200": {"description": "OpenAPI document", "content": {"application/json": {"schema": {"type": "object"}}}}
+        }
+      }
+    },
+    "/wagers": {
+      "get": {
+        "summary": "List the wagers after a wager id",
+        "operationId": "getWagers",
+        "parameters": [
+          {"name": "page", "in": "query", "required": true, "description": "the wagers after this wager id are listed", "schema": {"type": "integer", "minimum": 1}},
+          {"name": "limit", "in": "query", "required": true, "description": "at most max_wager_in_page", "schema": {"type": "integer", "minimum": 1}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Wagers",
+            "headers": {"X-Next-Page": {"description": "page of the next wagers, it is missing on the last page", "schema": {"type": "integer"}}},
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Wager"}}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Place a wager",
+        "operationId": "placeWager",
+        "parameters": [
+          {"$ref": "#/components/parameters/IdempotencyKey"}
+        ],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PlaceWager"}}}},
+        "responses": {
+          "201": {"description": "Placed wager", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Wager"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/wagers/batch": {
+      "post": {
+        "summary": "Place many wagers at once",
+        "operationId": "placeWagerBatch",
+        "parameters": [
+          {"$ref": "#/components/parameters/IdempotencyKey"}
+        ],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PlaceWagers"}}}},
+        "responses": {
+          "201": {"description": "Every wager is placed", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PlaceWagersResponse"}}}},
+          "207": {"description": "Some wagers are placed", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PlaceWagersResponse"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/wagers/{wager_id}": {
+      "get": {
+        "summary": "Get a wager",
+        "operationId": "getWager",
+        "parameters": [
+          {"$ref": "#/components/parameters/WagerID"}
+        ],
+        "responses": {
+          "200": {"description": "Wager", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Wager"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/wagers/{wager_id}/audit": {
+      "get": {
+        "summary": "Audit trail of a wager",
+        "operationId": "getAuditTrail",
+        "parameters": [
+          {"$ref": "#/components/parameters/WagerID"}
+        ],
+        "responses": {
+          "200": {"description": "Audit trail", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AuditTrailResponse"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/wagers/stream": {
+      "get": {
+        "summary": "Market events as server sent events, a client resumes with the Last-Event-ID header",
+        "operationId": "streamEvents",
+        "parameters": [
+          {"$ref": "#/components/parameters/EventType"},
+          {"$ref": "#/components/parameters/EventWagerID"},
+          {"$ref": "#/components/parameters/LastEventIDHeader"},
+          {"$ref": "#/components/parameters/LastEventID"}
+        ],
+        "responses": {
+          "200": {"description": "Stream of MarketEvent, a reset event tells that some events are missed", "content": {"text/event-stream": {"schema": {"type": "string"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "501": {"$ref": "#/components/responses/Error"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/wagers/stream/ws": {
+      "get": {
+        "summary": "Market events as json messages over websocket, a slow client is closed with 1013",
+        "operationId": "streamWebSocket",
+        "parameters": [
+          {"$ref": "#/components/parameters/EventType"},
+          {"$ref": "#/components/parameters/EventWagerID"},
+          {"$ref": "#/components/parameters/LastEventID"}
+        ],
+        "responses": {
+          "101": {"description": "Switched to websocket, the messages are MarketEvent"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "501": {"$ref": "#/components/responses/Error"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/webhooks": {
+      "post": {
+        "summary": "Subscribe a url to the market events, the secret which signs the deliveries is only returned here",
+        "operationId": "createWebhook",
+        "parameters": [
+          {"$ref": "#/components/parameters/IdempotencyKey"}
+        ],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CreateWebhook"}}}},
+        "responses": {
+          "201": {"description": "Webhook", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Webhook"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "501": {"$ref": "#/components/responses/Error"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/webhooks/{webhook_id}/deliveries": {
+      "get": {
+        "summary": "Log of the last deliveries of a webhook, the newest first",
+        "operationId": "getWebhookDeliveries",
+        "parameters": [
+          {"$ref": "#/components/parameters/WebhookID"},
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 500, "default": 50}}
+        ],
+        "responses": {
+          "200": {"description": "Deliveries", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/WebhookDelivery"}}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "501": {"$ref": "#/components/responses/Error"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/webhooks/{webhook_id}/deliveries/{delivery_id}/redeliver": {
+      "post": {
+        "summary": "Send a delivery again, a dead one too",
+        "operationId": "redeliverWebhook",
+        "parameters": [
+          {"$ref": "#/components/parameters/WebhookID"},
+          {"name": "delivery_id", "in": "path", "required": true, "schema": {"type": "integer"}}
+        ],
+        "responses": {
+          "202": {"description": "Delivery", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WebhookDelivery"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "501": {"$ref": "#/components/responses/Error"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/buy/{wager_id}": {
+      "post": {
+        "summary": "Buy a wager",
+        "operationId": "buyWager",
+        "parameters": [
+          {"$ref": "#/components/parameters/WagerID"},
+          {"$ref": "#/components/parameters/IdempotencyKey"}
+        ],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/BuyWager"}}}},
+        "responses": {
+          "201": {"description": "Purchase", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Purchase"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/buy/basket": {
+      "post": {
+        "summary": "Buy many wagers at once, either all of them or none",
+        "operationId": "buyBasket",
+        "parameters": [
+          {"$ref": "#/components/parameters/IdempotencyKey"}
+        ],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Basket"}}}},
+        "responses": {
+          "201": {"description": "Purchases", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/BasketResponse"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/stats": {
+      "get": {
+        "summary": "Market statistics by bucket",
+        "operationId": "getStats",
+        "parameters": [
+          {"name": "from", "in": "query", "description": "RFC3339 timestamp or date, 30 days before to by default", "schema": {"type": "string"}},
+          {"name": "to", "in": "query", "description": "RFC3339 timestamp or date, now by default", "schema": {"type": "string"}},
+          {"name": "bucket", "in": "query", "schema": {"type": "string", "enum": ["hour", "day", "week"]}}
+        ],
+        "responses": {
+          "200": {"description": "Statistics", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/MarketStats"}}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "WagerID": {"name": "wager_id", "in": "path", "required": true, "schema": {"type": "integer"}},
+      "WebhookID": {"name": "webhook_id", "in": "path", "required": true, "schema": {"type": "integer"}},
+      "IdempotencyKey": {
+        "name": "Idempotency-Key", "in": "header",
+        "description": "a retry with the same key gets the response of the first request instead of repeating it",
+        "schema": {"type": "string", "maxLength": 128}
+      },
+      "EventType": {
+        "name": "type", "in": "query",
+        "description": "comma separated event types: wager_placed, wager_purchased, price_changed, sold_out",
+        "schema": {"type": "string"}
+      },
+      "EventWagerID": {
+        "name": "wager_id", "in": "query",
+        "description": "comma separated wager ids",
+        "schema": {"type": "string", "pattern": "^[0-9]+(,[0-9]+)*$"}
+      },
+      "LastEventIDHeader": {"name": "Last-Event-ID", "in": "header", "schema": {"type": "string"}},
+      "LastEventID": {
+        "name": "last_event_id", "in": "query",
+        "description": "the Last-Event-ID of the clients which can not set the header",
+        "schema": {"type": "string"}
+      }
+    },
+    "responses": {
+      "Error": {"description": "Error", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ErrorResponse"}}}}
+    },
+    "schemas": {
+      "Decimal": {
+        "description": "decimal as a json number or string, it is returned as a string",
+        "oneOf": [{"type": "number"}, {"type": "string", "pattern": "^-?[0-9]+(\\.[0-9]+)?$"}]
+      },
+      "NullableDecimal": {
+        "nullable": true,
+        "oneOf": [{"type": "number"}, {"type": "string", "pattern": "^-?[0-9]+(\\.[0-9]+)?$"}]
+      },
+      "ErrorResponse": {
+        "type": "object",
+        "required": ["error"],
+        "properties": {
+          "code": {"type": "string", "description": "code of the domain error, e.g. wager_not_found, buying_price_too_high or wager_closed"},
+          "error": {"type": "string"},
+          "results": {"$ref": "#/components/schemas/BatchItemResults"}
+        }
+      },
+      "PlaceWager": {
+        "type": "object",
+        "required": ["total_wager_value", "odds", "selling_percentage", "selling_price"],
+        "properties": {
+          "total_wager_value": {"type": "integer", "minimum": 1},
+          "odds": {"type": "integer", "minimum": 1},
+          "selling_percentage": {"type": "integer", "minimum": 1, "maximum": 100},
+          "selling_price": {"$ref": "#/components/schemas/Decimal"}
+        }
+      },
+      "Wager": {
+        "type": "object",
+        "required": ["id", "total_wager_value", "odds", "selling_percentage", "selling_price", "current_selling_price", "percentage_sold", "amount_sold", "placed_at"],
+        "properties": {
+          "id": {"type": "integer"},
+          "total_wager_value": {"type": "integer"},
+          "odds": {"type": "integer"},
+          "selling_percentage": {"type": "integer"},
+          "selling_price": {"$ref": "#/components/schemas/Decimal"},
+          "current_selling_price": {"$ref": "#/components/schemas/Decimal"},
+          "percentage_sold": {"type": "integer", "nullable": true},
+          "amount_sold": {"type": "integer", "nullable": true},
+          "placed_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "PlaceWagers": {
+        "type": "object",
+        "required": ["wagers"],
+        "properties": {
+          "mode": {"type": "string", "enum": ["all_or_nothing", "partial"]},
+          "wagers": {"type": "array", "minItems": 1, "items": {"$ref": "#/components/schemas/PlaceWager"}}
+        }
+      },
+      "PlaceWagersResponse": {
+        "type": "object",
+        "required": ["results"],
+        "properties": {
+          "results": {"$ref": "#/components/schemas/BatchItemResults"}
+        }
+      },
+      "BatchItemResults": {
+        "type": "array",
+        "items": {
+          "type": "object",
+          "required": ["index", "status"],
+          "properties": {
+            "index": {"type": "integer"},
+            "status": {"type": "integer"},
+            "wager": {"$ref": "#/components/schemas/Wager"},
+            "error": {"type": "string"}
+          }
+        }
+      },
+      "BuyWager": {
+        "type": "object",
+        "required": ["buying_price"],
+        "properties": {
+          "wager_id": {"type": "integer", "description": "the wager of the path, a request with another one is rejected"},
+          "buying_price": {"$ref": "#/components/schemas/Decimal"}
+        }
+      },
+      "Purchase": {
+        "type": "object",
+        "required": ["id", "wager_id", "buying_price", "bought_at"],
+        "properties": {
+          "id": {"type": "integer"},
+          "wager_id": {"type": "integer"},
+          "buying_price": {"$ref": "#/components/schemas/Decimal"},
+          "bought_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Basket": {
+        "type": "object",
+        "required": ["purchases"],
+        "properties": {
+          "purchases": {
+            "type": "array",
+            "minItems": 1,
+            "items": {
+              "type": "object",
+              "required": ["wager_id", "buying_price"],
+              "properties": {
+                "wager_id": {"type": "integer", "minimum": 1},
+                "buying_price": {"$ref": "#/components/schemas/Decimal"}
+              }
+            }
+          }
+        }
+      },
+      "BasketResponse": {
+        "type": "object",
+        "required": ["purchases"],
+        "properties": {
+          "purchases": {"type": "array", "items": {"$ref": "#/components/schemas/Purchase"}}
+        }
+      },
+      "MarketStats": {
+        "type": "object",
+        "required": ["bucket", "wagers_placed", "volume_placed", "purchases", "volume_sold", "average_discount", "sell_through_rate", "seconds_to_first_purchase"],
+        "properties": {
+          "bucket": {"type": "string", "format": "date-time"},
+          "wagers_placed": {"type": "integer"},
+          "volume_placed": {"$ref": "#/components/schemas/Decimal"},
+          "purchases": {"type": "integer"},
+          "volume_sold": {"$ref": "#/components/schemas/Decimal"},
+          "average_discount": {"$ref": "#/components/schemas/NullableDecimal"},
+          "sell_through_rate": {"$ref": "#/components/schemas/NullableDecimal"},
+          "seconds_to_first_purchase": {"$ref": "#/components/schemas/NullableDecimal"}
+        }
+      },
+      "EventTypes": {
+        "type": "array",
+        "description": "an empty list subscribes to every event",
+        "items": {"type": "string", "enum": ["wager_placed", "wager_purchased", "price_changed", "sold_out"]}
+      },
+      "CreateWebhook": {
+        "type": "object",
+        "required": ["url"],
+        "properties": {
+          "url": {"type": "string"},
+          "event_types": {"$ref": "#/components/schemas/EventTypes"},
+          "secret": {"type": "string", "minLength": 16}
+        }
+      },
+      "Webhook": {
+        "type": "object",
+        "required": ["id", "url", "event_types", "created_at"],
+        "properties": {
+          "id": {"type": "integer"},
+          "url": {"type": "string"},
+          "event_types": {"$ref": "#/components/schemas/EventTypes"},
+          "secret": {"type": "string"},
+          "created_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "WebhookDelivery": {
+        "type": "object",
+        "required": ["id", "webhook_id", "event_id", "event_type", "wager_id", "status", "attempts", "next_attempt_at", "created_at"],
+        "properties": {
+          "id": {"type": "integer"},
+          "webhook_id": {"type": "integer"},
+          "event_id": {"type": "string"},
+          "event_type": {"type": "string"},
+          "wager_id": {"type": "integer"},
+          "status": {"type": "string", "enum": ["pending", "delivered", "dead"]},
+          "attempts": {"type": "integer"},
+          "response_status": {"type": "integer", "nullable": true},
+          "last_error": {"type": "string", "nullable": true},
+          "next_attempt_at": {"type": "string", "format": "date-time"},
+          "created_at": {"type": "string", "format": "date-time"},
+          "delivered_at": {"type": "string", "format": "date-time", "nullable": true}
+        }
+      },
+      "AuditTrailResponse": {
+        "type": "object",
+        "required": ["events", "verified"],
+        "properties": {
+          "events": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "required": ["id", "wager_id", "action", "actor", "request_id", "before", "after", "prev_hash", "hash", "created_at"],
+              "properties": {
+                "id": {"type": "integer"},
+                "wager_id": {"type": "integer"},
+                "action": {"type": "string", "enum": ["placed", "purchased"]},
+                "actor": {"type": "string", "description": "Caller of the api key of the request, anonymous without a key"},
+                "claimed_actor": {"type": "string", "description": "X-Actor header of the request, it is not verified"},
+                "request_id": {"type": "string"},
+                "before": {"type": "object", "nullable": true},
+                "after": {"type": "object", "nullable": true},
+                "prev_hash": {"type": "string"},
+                "hash": {"type": "string"},
+                "created_at": {"type": "string", "format": "date-time"}
+              }
+            }
+          },
+          "verified": {"type": "boolean"},
+          "broken_at": {"type": "integer"}
+        }
+      },
+      "HealthResponse": {
+        "type": "object",
+        "required": ["status"],
+        "properties": {
+          "status": {"type": "string", "enum": ["ok", "degraded"]},
+          "database": {
+            "type": "object",
+            "required": ["status"],
+            "properties": {
+              "status": {"type": "string"},
+              "error": {"type": "string"},
+              "max_open_connections": {"type": "integer"},
+              "open_connections": {"type": "integer"},
+              "in_use": {"type": "integer"},
+              "idle": {"type": "integer"},
+              "wait_count": {"type": "integer"},
+              "wait_duration": {"type": "integer", "description": "nanoseconds"},
+              "max_idle_closed": {"type": "integer"},
+              "max_lifetime_closed": {"type": "integer"}
+            }
+          }
+        }
+      },
+      "ReadyResponse": {
+        "type": "object",
+        "required": ["status", "checks"],
+        "properties": {
+          "status": {"type": "string", "enum": ["ready", "not_ready"]},
+          "checks": {
+            "type": "object",
+            "additionalProperties": {
+              "type": "object",
+              "required": ["status"],
+              "properties": {
+                "status": {"type": "string"},
+                "error": {"type": "string"}
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
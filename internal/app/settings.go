@@ -0,0 +1,140 @@
+package app
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"wager/config"
+)
+
+const (
+	// idle buckets are full again, so they are dropped once they have been idle this long
+	rateLimiterIdle    = time.Minute
+	rateLimiterCleanup = 1024
+	// rateLimiterMaxKeys is the most clients which are limited at once, the new ones are rejected until some are idle
+	rateLimiterMaxKeys = 100000
+)
+
+// SetLogLevel changes the level of the logger given by WithLogLevel, it is called when the configuration is reloaded
+func (app *App) SetLogLevel(level string) error {
+	if app.logLevel == nil {
+		return nil
+	}
+	return app.logLevel.UnmarshalText([]byte(level))
+}
+
+func batchWagersEnabled(f config.Features) bool    { return f.BatchWagers }
+func basketPurchaseEnabled(f config.Features) bool { return f.BasketPurchase }
+func statsEnabled(f config.Features) bool          { return f.Stats }
+
+// feature rejects the requests of a route while its feature flag is off
+func (app *App) feature(enabled func(f config.Features) bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if !enabled(app.settings().Features) {
+				return ctx.JSON(http.StatusNotFound, ErrorResponse{Description: "this feature is disabled"})
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+// ipExtractor reads the client ip from the X-Forwarded-For of the trusted proxies, the ip is the remote address
+// of the request without them so a client can not choose its own
+func ipExtractor(trustedProxies []string) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range trustedProxies {
+		// the networks are validated with the config
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			options = append(options, echo.TrustIPRange(network))
+		}
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// rateLimit allows app.rate_limit requests per second with bursts of app.rate_burst to every client ip
+func (app *App) rateLimit(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		settings := app.settings()
+		if settings.RateLimit <= 0 {
+			return next(ctx)
+		}
+
+		if !app.limiter.allow(ctx.RealIP(), settings.RateLimit, settings.RateBurst, time.Now()) {
+			return ctx.JSON(http.StatusTooManyRequests, ErrorResponse{Description: "too many requests"})
+		}
+
+		return next(ctx)
+	}
+}
+
+// rateLimiter is a token bucket per key, the rate is given on every call so it can be reloaded.
+// it keeps up to maxKeys buckets
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+	maxKeys int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: map[string]*bucket{}, maxKeys: rateLimiterMaxKeys}
+}
+
+func (l *rateLimiter) allow(key string, rate float64, burst int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.calls++
+	if l.calls%rateLimiterCleanup == 0 {
+		l.expire(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= l.maxKeys {
+			if l.expire(now); len(l.buckets) >= l.maxKeys {
+				return false
+			}
+		}
+		b = &bucket{tokens: float64(burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// expire drops the buckets which are idle
+func (l *rateLimiter) expire(now time.Time) {
+	for k, b := range l.buckets {
+		if now.Sub(b.last) > rateLimiterIdle {
+			delete(l.buckets, k)
+		}
+	}
+}
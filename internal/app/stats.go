@@ -0,0 +1,78 @@
+package app
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"wager/internal/domain"
+)
+
+const (
+	defaultStatsRange = 30 * 24 * time.Hour
+)
+
+type getStatsRequest struct {
+	From   string `query:"from"`   // RFC3339 timestamp or a date, 30 days before to by default
+	To     string `query:"to"`     // RFC3339 timestamp or a date, now by default
+	Bucket string `query:"bucket"` // hour, day or week, day by default
+}
+
+func (app *App) getStats(ctx echo.Context) error {
+	if app.analytics == nil {
+		return ctx.JSON(http.StatusNotImplemented, ErrorResponse{Description: "stats are not available"})
+	}
+
+	req := getStatsRequest{}
+	if err := bind(ctx, &req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: err.Error()})
+	}
+
+	query := domain.StatsQuery{
+		To:     time.Now().UTC(),
+		Bucket: domain.StatsBucketDay,
+	}
+
+	if req.Bucket != "" {
+		query.Bucket = req.Bucket
+	}
+
+	if req.To != "" {
+		to, err := parseTime(req.To)
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: "to: " + err.Error()})
+		}
+		query.To = to
+	}
+
+	query.From = query.To.Add(-defaultStatsRange)
+	if req.From != "" {
+		from, err := parseTime(req.From)
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: "from: " + err.Error()})
+		}
+		query.From = from
+	}
+
+	if err := validate(ctx, &query); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: err.Error()})
+	}
+
+	stats, err := app.analytics.Stats(ctx.Request().Context(), query)
+	if err != nil {
+		app.logFailure(ctx, http.StatusInternalServerError, "Get stats failed", err)
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Description: err.Error()})
+	}
+
+	return ctx.JSON(http.StatusOK, stats)
+}
+
+// parseTime accepts either a RFC3339 timestamp or a date
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,315 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+
+	"wager/internal/domain"
+	"wager/internal/logging"
+	"wager/internal/stream"
+)
+
+const (
+	// headerLastEventID is sent by the event sources when they reconnect
+	headerLastEventID = "Last-Event-ID"
+
+	// a comment is sent when there is no event for this long, so the proxies keep the stream open
+	streamHeartbeat = 15 * time.Second
+	// the event sources reconnect after this long
+	streamRetry = time.Second
+	// streamWriteWait is the write deadline of the server sent events, it is moved before every write
+	streamWriteWait = 10 * time.Second
+
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+
+	// streamReset is the event sent in place of the events which are missed
+	streamReset = "reset"
+)
+
+// streamRoutes are the routes whose responses are streamed
+var streamRoutes = map[string]bool{
+	"/wagers/stream":    true,
+	"/wagers/stream/ws": true,
+}
+
+// errStreamClosing ends the streams when the app shuts down, the clients reconnect to another instance
+var errStreamClosing = errors.New("server is shutting down")
+
+// connKey is the context key of the connection of a request
+type connKey struct{}
+
+// withConn puts the connection into the context of its requests, it is the ConnContext of the server.
+// the timeouts of the server are for the requests, a stream moves the deadlines of its connection instead
+func withConn(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, conn)
+}
+
+// WithStream serves the market events of the hub as server sent events and over websocket
+func WithStream(hub *stream.Hub) Option {
+	return func(app *App) {
+		app.hub = hub
+	}
+}
+
+// subscribe reads the filter and the last event id of the request, the filter is
+// type=price_changed,sold_out and wager_id=1,2 and the last event id is in the Last-Event-ID header
+// or in the last_event_id query parameter for the clients which can not set it
+func (app *App) subscribe(ctx echo.Context) (*stream.Subscription, error) {
+	filter := stream.Filter{Types: map[string]bool{}, WagerIDs: map[int]bool{}}
+
+	for _, t := range splitQuery(ctx.QueryParam("type")) {
+		known := false
+		for _, eventType := range domain.MarketEventTypes {
+			known = known || eventType == t
+		}
+		if !known {
+			return nil, fmt.Errorf("type must be one of %s", strings.Join(domain.MarketEventTypes, ", "))
+		}
+		filter.Types[t] = true
+	}
+
+	for _, v := range splitQuery(ctx.QueryParam("wager_id")) {
+		wagerID, err := strconv.Atoi(v)
+		if err != nil || wagerID <= 0 {
+			return nil, errors.New(domain.ErrInvalidWagerID)
+		}
+		filter.WagerIDs[wagerID] = true
+	}
+
+	lastEventID := ctx.Request().Header.Get(headerLastEventID)
+	if lastEventID == "" {
+		lastEventID = ctx.QueryParam("last_event_id")
+	}
+
+	return app.hub.Subscribe(filter, lastEventID), nil
+}
+
+func splitQuery(v string) []string {
+	if v == "" {
+		return nil
+	}
+
+	return strings.Split(v, ",")
+}
+
+// streamEvents writes the market events as server sent events until the client leaves or the app shuts down
+// a slow client is sent an error event and the stream ends, it resumes from its last event id
+func (app *App) streamEvents(ctx echo.Context) error {
+	if app.hub == nil {
+		return ctx.JSON(http.StatusNotImplemented, ErrorResponse{Description: "stream is not available"})
+	}
+
+	sub, err := app.subscribe(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: err.Error()})
+	}
+	defer sub.Close()
+
+	// the stream is not bound by the timeouts of the server, its connection is only read for the client
+	// leaving and its write deadline is moved before every write. the connection is not known when the app
+	// is not served by Run, then the stream ends before the write timeout and the client reconnects
+	conn, _ := ctx.Request().Context().Value(connKey{}).(net.Conn)
+	extendWrite := func() {}
+	heartbeatInterval := streamHeartbeat
+	var deadline <-chan time.Time
+	if conn != nil {
+		if err := conn.SetReadDeadline(time.Time{}); err != nil {
+			return nil
+		}
+		extendWrite = func() {
+			conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+		}
+	} else if app.service.WriteTimeout > 0 {
+		timer := time.NewTimer(app.service.WriteTimeout * 9 / 10)
+		defer timer.Stop()
+		deadline = timer.C
+		if heartbeatInterval > app.service.WriteTimeout/3 {
+			heartbeatInterval = app.service.WriteTimeout / 3
+		}
+	}
+
+	res := ctx.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+
+	extendWrite()
+	res.WriteHeader(http.StatusOK)
+	fmt.Fprintf(res, "retry: %d\n\n", streamRetry.Milliseconds())
+	if sub.Reset {
+		writeServerEvent(res, "", streamReset, struct{}{})
+	}
+	for _, event := range sub.Backlog {
+		writeServerEvent(res, event.ID, event.Type, event)
+	}
+	res.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			extendWrite()
+			if !ok {
+				app.log(ctx).Info("Stream is dropped", logging.Error(sub.Err()))
+				writeServerEvent(res, "", "error", ErrorResponse{Description: sub.Err().Error()})
+				res.Flush()
+				return nil
+			}
+			writeServerEvent(res, event.ID, event.Type, event)
+		case <-heartbeat.C:
+			extendWrite()
+			fmt.Fprint(res, ": heartbeat\n\n")
+		case <-app.closing:
+			writeServerEvent(res, "", "error", ErrorResponse{Description: errStreamClosing.Error()})
+			res.Flush()
+			return nil
+		case <-deadline:
+			return nil
+		case <-ctx.Request().Context().Done():
+			return nil
+		}
+		res.Flush()
+	}
+}
+
+// writeServerEvent writes an event of the text/event-stream format
+func writeServerEvent(w http.ResponseWriter, id, event string, data interface{}) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// streamWebSocket writes the market events as json messages over websocket until the client leaves
+// a slow client is closed with 1013 try again later, it resumes from its last event id.
+// the app closes it with 1001 going away when it shuts down
+func (app *App) streamWebSocket(ctx echo.Context) error {
+	if app.hub == nil {
+		return ctx.JSON(http.StatusNotImplemented, ErrorResponse{Description: "stream is not available"})
+	}
+
+	sub, err := app.subscribe(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: err.Error()})
+	}
+	defer sub.Close()
+
+	conn, err := upgrader.Upgrade(ctx.Response(), ctx.Request(), nil)
+	if err != nil {
+		// the upgrader has answered the client already
+		return nil
+	}
+	defer conn.Close()
+
+	// the server does not track the connection once it is upgraded, the app waits for it at shutdown
+	if !app.trackStream() {
+		closeWebSocket(conn, websocket.CloseGoingAway, errStreamClosing)
+		return nil
+	}
+	defer app.streams.Done()
+
+	// the messages of the client are only read for the pongs and the close
+	left := make(chan struct{})
+	go func() {
+		defer close(left)
+		conn.SetReadLimit(1024)
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(v interface{}) error {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		return conn.WriteJSON(v)
+	}
+
+	if sub.Reset {
+		if err := write(domain.MarketEvent{Type: streamReset}); err != nil {
+			return nil
+		}
+	}
+	for _, event := range sub.Backlog {
+		if err := write(event); err != nil {
+			return nil
+		}
+	}
+
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				app.log(ctx).Info("Stream is dropped", logging.Error(sub.Err()))
+				closeWebSocket(conn, websocket.CloseTryAgainLater, sub.Err())
+				return nil
+			}
+			if err := write(event); err != nil {
+				app.log(ctx).Debug("Write to websocket failed", logging.Error(err))
+				return nil
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return nil
+			}
+		case <-app.closing:
+			closeWebSocket(conn, websocket.CloseGoingAway, errStreamClosing)
+			return nil
+		case <-left:
+			return nil
+		}
+	}
+}
+
+// closeWebSocket sends the close message of the code with the error as its reason
+func closeWebSocket(conn *websocket.Conn, code int, err error) {
+	msg := websocket.FormatCloseMessage(code, err.Error())
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+}
+
+// trackStream counts a websocket in flight, it is false once the app shuts down
+func (app *App) trackStream() bool {
+	app.streamsMu.Lock()
+	defer app.streamsMu.Unlock()
+
+	select {
+	case <-app.closing:
+		return false
+	default:
+	}
+	app.streams.Add(1)
+
+	return true
+}
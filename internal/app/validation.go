@@ -0,0 +1,127 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/labstack/echo/v4"
+)
+
+// WithSpecValidation rejects the requests which do not match the OpenAPI document with 400
+// when validateResponses is set the responses are checked too and a mismatch is answered with 500,
+// the responses are buffered for it so it is meant for the tests
+func WithSpecValidation(validateResponses bool) Option {
+	return func(app *App) {
+		app.validateRequests = true
+		app.validateResponses = validateResponses
+	}
+}
+
+// loadSpec parses the OpenAPI document of the app
+func loadSpec() (*openapi3.Swagger, error) {
+	spec, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData([]byte(openAPISpec))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := spec.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+func (app *App) openAPI(ctx echo.Context) error {
+	return ctx.Blob(http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, []byte(openAPISpec))
+}
+
+// validateSpec checks the requests and the responses of the routes in the OpenAPI document
+// the other routes are left to echo
+func (app *App) validateSpec(router *openapi3filter.Router) echo.MiddlewareFunc {
+	options := &openapi3filter.Options{IncludeResponseStatus: true}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+
+			route, params, err := router.FindRoute(req.Method, req.URL)
+			if err != nil {
+				return next(ctx)
+			}
+
+			input := &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: params,
+				Route:      route,
+				Options:    options,
+			}
+
+			if err := openapi3filter.ValidateRequest(req.Context(), input); err != nil {
+				return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: err.Error()})
+			}
+
+			// a streamed response can not be buffered
+			if !app.validateResponses || streamRoutes[ctx.Path()] {
+				return next(ctx)
+			}
+
+			res := ctx.Response()
+			writer := res.Writer
+			buffer := &bufferedWriter{ResponseWriter: writer}
+			res.Writer = buffer
+			defer func() { res.Writer = writer }()
+
+			if err := next(ctx); err != nil {
+				return err
+			}
+
+			status := buffer.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			err = openapi3filter.ValidateResponse(req.Context(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: input,
+				Status:                 status,
+				Header:                 writer.Header(),
+				Body:                   ioutil.NopCloser(bytes.NewReader(buffer.body.Bytes())),
+				Options:                options,
+			})
+
+			// the response is sent through echo again, so its status and size are the ones sent
+			res.Writer = writer
+			res.Committed = false
+			res.Size = 0
+
+			if err != nil {
+				return ctx.JSON(http.StatusInternalServerError, ErrorResponse{
+					Description: fmt.Sprintf("response does not match the spec: %s", err.Error()),
+				})
+			}
+
+			res.WriteHeader(status)
+			_, err = res.Write(buffer.body.Bytes())
+			return err
+		}
+	}
+}
+
+// bufferedWriter holds the response back until it is validated, or until it is kept for an idempotency key
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
@@ -3,113 +3,448 @@ package app
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/getkin/kin-openapi/openapi3filter"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	_ "github.com/lib/pq" // postgresql implementation package in go
+	"go.uber.org/zap"
 
+	"wager/config"
 	"wager/internal/domain"
+	"wager/internal/logging"
+	"wager/internal/metrics"
+	"wager/internal/stream"
+	"wager/internal/tracing"
 )
 
+// defaults of the app settings when the app is not configured
 const (
-	maxWagerInPage = 20
+	maxWagerInPage   = 20
+	maxWagersInBatch = 500
 )
 
 type (
 	// App application struct
 	App struct {
-		e    *echo.Echo
-		repo domain.WagerRepository
+		e         *echo.Echo
+		repo      domain.WagerRepository
+		analytics domain.AnalyticsRepository
+		audit     domain.AuditRepository
+		webhooks  domain.WebhookRepository
+		hub       *stream.Hub
+
+		freshReadWindow time.Duration
+		settings        func() config.App
+		service         config.Service
+		limiter         *rateLimiter
+		idempotency     domain.IdempotencyRepository
+		db              DatabaseStatus
+		checks          []readinessCheck
+		draining        int32
+		// closing is closed once the app shuts down, it ends the streams in flight.
+		// streams counts the websockets, see trackStream
+		closing     chan struct{}
+		streamsMu   sync.Mutex
+		streams     sync.WaitGroup
+		shutdown    sync.Once
+		shutdownErr error
+		logger      *zap.Logger
+		logLevel    *zap.AtomicLevel
+
+		validateRequests  bool
+		validateResponses bool
 	}
+
+	// Option configures the optional dependencies of App
+	Option func(app *App)
 )
 
+// WithAnalytics serves the market statistics from the analytics repository
+func WithAnalytics(analytics domain.AnalyticsRepository) Option {
+	return func(app *App) {
+		app.analytics = analytics
+	}
+}
+
+// WithAudit serves the audit trail of the wagers from the audit repository
+func WithAudit(audit domain.AuditRepository) Option {
+	return func(app *App) {
+		app.audit = audit
+	}
+}
+
+// WithConfig applies the app settings and the http server timeouts
+func WithConfig(cfg *config.Schema) Option {
+	return func(app *App) {
+		settings := cfg.App
+		app.settings = func() config.App { return settings }
+		app.service = cfg.Service
+	}
+}
+
+// WithSettings reads the app settings from settings on every request, so they can be reloaded
+// settings must be safe for concurrent use
+func WithSettings(settings func() config.App) Option {
+	return func(app *App) {
+		app.settings = settings
+	}
+}
+
 // New application
-func New(repo domain.WagerRepository) *App {
+func New(repo domain.WagerRepository, opts ...Option) *App {
 	app := &App{
 		e:    echo.New(),
 		repo: repo,
+		settings: func() config.App {
+			return config.App{
+				MaxWagerInPage:   maxWagerInPage,
+				MaxWagersInBatch: maxWagersInBatch,
+				Features: config.Features{
+					BatchWagers:    true,
+					BasketPurchase: true,
+					Stats:          true,
+				},
+			}
+		},
+		limiter:     newRateLimiter(),
+		closing:     make(chan struct{}),
+		idempotency: newIdempotencyStore(),
+		logger:      zap.NewNop(),
+	}
+
+	for _, opt := range opts {
+		opt(app)
 	}
 
+	app.e.IPExtractor = ipExtractor(app.service.TrustedProxies)
+	app.e.Server.ReadTimeout = app.service.ReadTimeout
+	app.e.Server.WriteTimeout = app.service.WriteTimeout
+	// the streams move the deadlines of their connections, see streamEvents
+	app.e.Server.ConnContext = withConn
+
+	// count and time every request, including the recovered panics
+	app.e.Use(metrics.Middleware)
+
+	// trace every request, the trace context of the caller is continued
+	app.e.Use(tracing.Middleware)
+
+	// every request has an id which is logged and returned to the client
+	app.e.Use(requestID)
+	app.e.Use(app.accessLog)
+
 	// handle recover
 	app.e.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{
 		StackSize: 1 << 10, // 1 KB
 	}))
 
+	// limit the requests of every client ip
+	app.e.Use(app.rateLimit)
+
+	// who makes the change is recorded in the audit trail
+	app.e.Use(app.authenticate)
+
+	// a client reads its own writes even if the replicas are lagging
+	app.e.Use(freshRead)
+
+	// requests and responses are checked against the OpenAPI document
+	if app.validateRequests {
+		spec, err := loadSpec()
+		if err != nil {
+			panic(fmt.Sprintf("invalid OpenAPI document: %s", err.Error()))
+		}
+		app.e.Use(app.validateSpec(openapi3filter.NewRouter().WithSwagger(spec)))
+	}
+
 	// health and live check
 	app.e.GET("/health", app.healthCheck)
 	app.e.GET("/live", app.liveCheck)
+	app.e.GET("/ready", app.readyCheck)
+	app.e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+	app.e.GET("/openapi.json", app.openAPI)
 
 	// init app routing
 	app.e.GET("/wagers", app.getWagers)
-	app.e.POST("/wagers", app.placeWager)
-	app.e.POST("/buy/:wager_id", app.buyWager)
+	app.e.POST("/wagers", app.placeWager, app.idempotent)
+	app.e.GET("/wagers/:wager_id", app.getWager)
+	app.e.POST("/wagers/batch", app.placeWagerBatch, app.feature(batchWagersEnabled), app.idempotent)
+	app.e.POST("/buy/:wager_id", app.buyWager, app.idempotent)
+	app.e.POST("/buy/basket", app.buyBasket, app.feature(basketPurchaseEnabled), app.idempotent)
+	app.e.GET("/stats", app.getStats, app.feature(statsEnabled))
+	app.e.GET("/wagers/:wager_id/audit", app.getAuditTrail)
+	app.e.GET("/wagers/stream", app.streamEvents)
+	app.e.GET("/wagers/stream/ws", app.streamWebSocket)
+	app.e.POST("/webhooks", app.createWebhook, app.idempotent)
+	app.e.GET("/webhooks/:webhook_id/deliveries", app.getWebhookDeliveries)
+	app.e.POST("/webhooks/:webhook_id/deliveries/:delivery_id/redeliver", app.redeliverWebhook)
 
 	return app
 }
 
 // Run application
 func (app *App) Run(port int) error {
-	log.Printf("Start the server at :%d", port)
+	app.logger.Info("Start the server", zap.Int("port", port))
 	return app.e.Start(fmt.Sprintf(":%d", port))
 }
 
-// Close app and all the resources
-func (app *App) Close(ctx context.Context) error {
-	log.Println("Close the app")
-	if err := app.e.Shutdown(ctx); err != nil {
-		// we should panic here, but we have a db dependency, that's why I try to log it out
-		log.Printf("Shutdown http app error: %s\n", err.Error())
+// ServeHTTP serves a request with the app, so the app can be mounted without Run
+func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	app.e.ServeHTTP(w, r)
+}
+
+// Drain turns the readiness down and keeps serving for the drain delay,
+// so the load balancers stop sending requests before the server stops. the delay is waited once
+func (app *App) Drain(ctx context.Context) {
+	if !atomic.CompareAndSwapInt32(&app.draining, 0, 1) {
+		return
 	}
 
-	// close db connection
-	return app.repo.Close(ctx)
+	if delay := app.service.DrainDelay; delay > 0 {
+		app.logger.Info("Drain the app", zap.Duration("delay", delay))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
 }
 
-// this is for health check procedure
-func (app *App) healthCheck(e echo.Context) error {
-	return e.JSON(http.StatusOK, "OK")
+// Shutdown drains the app and stops its server, the streams are ended and the requests in flight are waited
+// for until ctx is done. the repository is left open for the other servers which share it
+func (app *App) Shutdown(ctx context.Context) error {
+	app.shutdown.Do(func() {
+		app.Drain(ctx)
+		app.logger.Info("Shutdown the app")
+		app.streamsMu.Lock()
+		close(app.closing)
+		app.streamsMu.Unlock()
+		app.shutdownErr = app.e.Shutdown(ctx)
+
+		// the server does not wait for the websockets it has handed over
+		done := make(chan struct{})
+		go func() {
+			app.streams.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			if app.shutdownErr == nil {
+				app.shutdownErr = ctx.Err()
+			}
+		}
+	})
+
+	return app.shutdownErr
 }
 
-func (app *App) liveCheck(e echo.Context) error {
-	return e.JSON(http.StatusOK, "OK")
+// Close app and all the resources, the app is shut down first when it is not yet
+func (app *App) Close(ctx context.Context) error {
+	app.logger.Info("Close the app")
+	if err := app.Shutdown(ctx); err != nil {
+		// we should panic here, but we have a db dependency, that's why I try to log it out
+		app.logger.Error("Shutdown http app failed", logging.Error(err))
+	}
+
+	// close db connection
+	return app.repo.Close(ctx)
 }
 
 // ErrorResponse ...
 type ErrorResponse struct {
+	// Code is the code of the domain error, it is set when the request fails by one
+	Code        string `json:"code,omitempty"`
 	Description string `json:"error"`
+	// Results are the outcomes of the wagers of a rejected batch
+	Results []BatchItemResult `json:"results,omitempty"`
 }
 
 func (e *ErrorResponse) Error() string {
 	return e.Description
 }
 
+// errorResponse of a failed call of the repository
+func errorResponse(err error) ErrorResponse {
+	return ErrorResponse{Code: domain.ErrorCode(err), Description: err.Error()}
+}
+
+// errorStatus maps the kind of the repository errors to http status
+func errorStatus(err error) int {
+	switch domain.ErrorKindOf(err) {
+	case domain.ErrorKindNotFound:
+		return http.StatusNotFound
+	case domain.ErrorKindInvalid:
+		return http.StatusBadRequest
+	case domain.ErrorKindConflict:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// bind the request to v in its own span
+func bind(ctx echo.Context, v interface{}) error {
+	spanCtx, span := tracing.Start(ctx.Request().Context(), "app.bind")
+	err := ctx.Bind(v)
+	tracing.End(spanCtx, span, err)
+
+	return err
+}
+
+// validator is a request of the domain which validates itself
+type validator interface {
+	Validate(ctx context.Context) error
+}
+
+// validate the request in its own span
+func validate(ctx echo.Context, v validator) error {
+	spanCtx, span := tracing.Start(ctx.Request().Context(), "app.validate")
+	err := v.Validate(spanCtx)
+	tracing.End(spanCtx, span, err)
+
+	return err
+}
+
 // all the handlers will have the same pattern
 // First bind the request
 // Second validate it
 // Third call repository to persist the data
 
 func (app *App) placeWager(ctx echo.Context) error {
-	log.Printf("Process a place wager request")
-
 	wager := domain.Wager{}
-	if err := ctx.Bind(&wager); err != nil {
+	if err := bind(ctx, &wager); err != nil {
 		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: err.Error()})
 	}
 
-	if err := wager.Validate(ctx.Request().Context()); err != nil {
+	if err := validate(ctx, &wager); err != nil {
 		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: err.Error()})
 	}
 
 	res, err := app.repo.Create(ctx.Request().Context(), wager)
 	if err != nil {
+		app.logFailure(ctx, http.StatusInternalServerError, "Place wager failed", err)
 		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Description: err.Error()})
 	}
 
+	app.log(ctx).Info("Wager is placed", zap.Int("wager_id", res.ID))
+	app.markWritten(ctx)
 	return ctx.JSON(http.StatusCreated, res)
 }
 
+// batch modes of placeWagersRequest
+const (
+	batchModeAllOrNothing = "all_or_nothing"
+	batchModePartial      = "partial"
+)
+
+type (
+	placeWagersRequest struct {
+		Mode   string         `json:"mode"` // all_or_nothing by default
+		Wagers []domain.Wager `json:"wagers"`
+	}
+
+	// BatchItemResult is the outcome of a single wager in a batch
+	BatchItemResult struct {
+		Index  int           `json:"index"`
+		Status int           `json:"status"`
+		Wager  *domain.Wager `json:"wager,omitempty"`
+		Error  string        `json:"error,omitempty"`
+	}
+
+	// PlaceWagersResponse ...
+	PlaceWagersResponse struct {
+		Results []BatchItemResult `json:"results"`
+	}
+)
+
+// placeWagerBatch validates every wager then persists the valid ones in one round trip
+// in all_or_nothing mode a single invalid wager rejects the whole batch
+func (app *App) placeWagerBatch(ctx echo.Context) error {
+	req := placeWagersRequest{}
+	if err := bind(ctx, &req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: err.Error()})
+	}
+
+	if req.Mode == "" {
+		req.Mode = batchModeAllOrNothing
+	}
+
+	if req.Mode != batchModeAllOrNothing && req.Mode != batchModePartial {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{
+			Description: fmt.Sprintf("mode must be %s or %s", batchModeAllOrNothing, batchModePartial),
+		})
+	}
+
+	maxWagers := app.settings().MaxWagersInBatch
+	if len(req.Wagers) == 0 || len(req.Wagers) > maxWagers {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{
+			Description: fmt.Sprintf("wagers must contain between 1 and %d items", maxWagers),
+		})
+	}
+
+	results := make([]BatchItemResult, len(req.Wagers))
+	valid := make([]domain.Wager, 0, len(req.Wagers))
+	validIdx := make([]int, 0, len(req.Wagers))
+	for i := range req.Wagers {
+		results[i].Index = i
+		if err := validate(ctx, &req.Wagers[i]); err != nil {
+			results[i].Status = http.StatusBadRequest
+			results[i].Error = err.Error()
+			continue
+		}
+
+		valid = append(valid, req.Wagers[i])
+		validIdx = append(validIdx, i)
+	}
+
+	if len(valid) < len(req.Wagers) && req.Mode == batchModeAllOrNothing {
+		for _, i := range validIdx {
+			results[i].Status = http.StatusFailedDependency
+			results[i].Error = "batch is rejected because other wagers are invalid"
+		}
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{
+			Description: fmt.Sprintf("batch is rejected because %d wagers are invalid", len(req.Wagers)-len(valid)),
+			Results:     results,
+		})
+	}
+
+	if len(valid) > 0 {
+		created, err := app.repo.CreateBatch(ctx.Request().Context(), valid)
+		if err != nil {
+			app.logFailure(ctx, http.StatusInternalServerError, "Place wager batch failed", err,
+				zap.Int("wagers", len(valid)))
+			return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Description: err.Error()})
+		}
+
+		if len(created) != len(valid) {
+			return ctx.JSON(http.StatusInternalServerError, ErrorResponse{
+				Description: fmt.Sprintf("%d wagers are created out of %d", len(created), len(valid)),
+			})
+		}
+
+		for j, i := range validIdx {
+			results[i].Status = http.StatusCreated
+			results[i].Wager = &created[j]
+		}
+
+		app.log(ctx).Info("Wager batch is placed", zap.Int("wagers", len(created)), zap.String("mode", req.Mode))
+		app.markWritten(ctx)
+	}
+
+	if len(valid) < len(req.Wagers) {
+		return ctx.JSON(http.StatusMultiStatus, PlaceWagersResponse{Results: results})
+	}
+
+	return ctx.JSON(http.StatusCreated, PlaceWagersResponse{Results: results})
+}
+
+// HeaderNextPage is the page of the next wagers, it is not set on the last page
+const HeaderNextPage = "X-Next-Page"
+
 // GetWagersRequest ...
 type getWagersRequest struct {
 	Page  int `json:"page" query:"page"`   // This one should be the wager id
@@ -117,21 +452,19 @@ type getWagersRequest struct {
 }
 
 func (app *App) getWagers(ctx echo.Context) error {
-	log.Printf("Process a get wagers request")
-
 	req := getWagersRequest{}
-	if err := ctx.Bind(&req); err != nil {
+	if err := bind(ctx, &req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: err.Error()})
 	}
-	log.Printf("Start get wagers from %d limit %d", req.Page, req.Limit)
 
 	// In my opinion, we should limit the number of returned wagers
 	//if the limit is less than or equal zero, I change it to max number returned wagers
 	// but the requirement does not say it so I assume I have to reject the large limt
-	// in this case I set max limit to 20
-	if req.Limit <= 0 || req.Limit > maxWagerInPage {
+	// in this case I set max limit to 20 by default
+	maxLimit := app.settings().MaxWagerInPage
+	if req.Limit <= 0 || req.Limit > maxLimit {
 		return ctx.JSON(http.StatusBadRequest, ErrorResponse{
-			Description: fmt.Sprintf("limit must be less than %d", maxWagerInPage),
+			Description: fmt.Sprintf("limit must be less than %d", maxLimit),
 		})
 	}
 
@@ -141,30 +474,85 @@ func (app *App) getWagers(ctx echo.Context) error {
 		})
 	}
 
-	wagers, _, err := app.repo.Get(ctx.Request().Context(), req.Page, req.Limit)
+	wagers, next, err := app.repo.Get(ctx.Request().Context(), req.Page, req.Limit)
 	if err != nil {
+		app.logFailure(ctx, http.StatusInternalServerError, "Get wagers failed", err)
 		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Description: err.Error()})
 	}
 
+	// a short page is the last one
+	if len(wagers) == req.Limit && next > 0 {
+		ctx.Response().Header().Set(HeaderNextPage, strconv.Itoa(next))
+	}
+
 	return ctx.JSON(http.StatusOK, wagers)
 }
 
-func (app *App) buyWager(ctx echo.Context) error {
-	log.Printf("Process buy wager request")
+func (app *App) getWager(ctx echo.Context) error {
+	wagerID, err := strconv.Atoi(ctx.Param("wager_id"))
+	if err != nil || wagerID <= 0 {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: domain.ErrInvalidWagerID})
+	}
 
+	wager, err := app.repo.Find(ctx.Request().Context(), wagerID)
+	if err != nil {
+		app.logFailure(ctx, errorStatus(err), "Get wager failed", err, zap.Int("wager_id", wagerID))
+		return ctx.JSON(errorStatus(err), errorResponse(err))
+	}
+
+	return ctx.JSON(http.StatusOK, wager)
+}
+
+func (app *App) buyWager(ctx echo.Context) error {
 	purchase := domain.Purchase{}
-	if err := ctx.Bind(&purchase); err != nil {
+	if err := bind(ctx, &purchase); err != nil {
 		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: err.Error()})
 	}
 
-	if err := purchase.Validate(ctx.Request().Context()); err != nil {
+	// the wager is the one of the path, the body may name it too but not another one
+	wagerID, err := strconv.Atoi(ctx.Param("wager_id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: domain.ErrInvalidWagerID})
+	}
+	if purchase.WagerID != 0 && purchase.WagerID != wagerID {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: domain.ErrWagerIDMismatch})
+	}
+	purchase.WagerID = wagerID
+
+	if err := validate(ctx, &purchase); err != nil {
 		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: err.Error()})
 	}
 
 	res, err := app.repo.Purchase(ctx.Request().Context(), purchase.WagerID, purchase.BuyingPrice)
 	if err != nil {
-		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Description: err.Error()})
+		app.logFailure(ctx, errorStatus(err), "Buy wager failed", err, zap.Int("wager_id", purchase.WagerID))
+		return ctx.JSON(errorStatus(err), errorResponse(err))
 	}
 
+	app.log(ctx).Info("Wager is purchased", zap.Int("wager_id", res.WagerID), zap.Int("purchase_id", res.ID))
+	app.markWritten(ctx)
 	return ctx.JSON(http.StatusCreated, res)
 }
+
+func (app *App) buyBasket(ctx echo.Context) error {
+	basket := domain.Basket{}
+	if err := bind(ctx, &basket); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: err.Error()})
+	}
+
+	if err := validate(ctx, &basket); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: err.Error()})
+	}
+
+	res, err := app.repo.PurchaseBasket(ctx.Request().Context(), basket.Purchases)
+	if err != nil {
+		app.logFailure(ctx, errorStatus(err), "Buy basket failed", err, zap.Int("purchases", len(basket.Purchases)))
+		return ctx.JSON(errorStatus(err), errorResponse(err))
+	}
+
+	for _, p := range res {
+		app.log(ctx).Info("Wager is purchased", zap.Int("wager_id", p.WagerID), zap.Int("purchase_id", p.ID))
+	}
+	app.markWritten(ctx)
+	return ctx.JSON(http.StatusCreated, domain.Basket{Purchases: res})
+}
@@ -1,24 +1,45 @@
 package app
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/api/global"
+	apitrace "go.opentelemetry.io/otel/api/trace"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 
+	"wager/config"
 	"wager/internal/domain"
 	"wager/internal/domain/mocks"
+	"wager/internal/metrics"
+	"wager/internal/stream"
+	"wager/internal/tracing"
 )
 
 func TestNew(t *testing.T) {
@@ -34,6 +55,36 @@ func TestClose(t *testing.T) {
 	require.NoError(t, app.Close(context.Background()))
 }
 
+func TestSetLogLevel(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+	app := New(&mocks.WagerRepository{}, WithLogLevel(level))
+
+	require.NoError(t, app.SetLogLevel("debug"))
+	assert.Equal(t, zap.DebugLevel, level.Level())
+
+	assert.Error(t, app.SetLogLevel("loud"))
+	assert.Equal(t, zap.DebugLevel, level.Level())
+}
+
+func TestShutdown(t *testing.T) {
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Close", mock.Anything).Return(nil)
+
+	app := New(mockRepo)
+
+	// the app is not ready once it drains, and the repository is left open until it is closed
+	app.Drain(context.Background())
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	require.NoError(t, app.Shutdown(context.Background()))
+	mockRepo.AssertNotCalled(t, "Close", mock.Anything)
+
+	require.NoError(t, app.Close(context.Background()))
+	mockRepo.AssertNumberOfCalls(t, "Close", 1)
+}
+
 func TestRun(t *testing.T) {
 	mockRepo := &mocks.WagerRepository{}
 	mockRepo.On("Close", mock.Anything).Return(nil)
@@ -141,8 +192,10 @@ func TestPlaceWager(t *testing.T) {
 
 func TestBuyWager(t *testing.T) {
 	tcs := []struct {
-		name       string
-		in         domain.Purchase
+		name string
+		in   domain.Purchase
+		// path is the wager id of the path, it is the one of the body by default
+		path       string
 		statusCode int
 		hasErr     bool
 		err        ErrorResponse
@@ -167,6 +220,28 @@ func TestBuyWager(t *testing.T) {
 				Description: domain.ErrInvalidWagerID,
 			},
 		},
+		{
+			name:       "only the path",
+			in:         domain.Purchase{BuyingPrice: decimal.NewFromFloat(11.11)},
+			path:       "1",
+			statusCode: 201,
+		},
+		{
+			name:       "another wager in the body",
+			in:         domain.Purchase{WagerID: 2, BuyingPrice: decimal.NewFromFloat(11.11)},
+			path:       "1",
+			statusCode: 400,
+			hasErr:     true,
+			err:        ErrorResponse{Description: domain.ErrWagerIDMismatch},
+		},
+		{
+			name:       "invalid path",
+			in:         domain.Purchase{BuyingPrice: decimal.NewFromFloat(11.11)},
+			path:       "one",
+			statusCode: 400,
+			hasErr:     true,
+			err:        ErrorResponse{Description: domain.ErrInvalidWagerID},
+		},
 		{
 			name: "invalid buying_price",
 			in: domain.Purchase{
@@ -179,10 +254,42 @@ func TestBuyWager(t *testing.T) {
 				Description: domain.ErrInvalidBuyingPrice,
 			},
 		},
+		{
+			name:       "wager not found",
+			in:         domain.Purchase{WagerID: 2, BuyingPrice: decimal.NewFromFloat(11.11)},
+			statusCode: 404,
+			hasErr:     true,
+			err:        ErrorResponse{Code: domain.ErrorCodeWagerNotFound, Description: domain.ErrWagerNotFound.Error()},
+		},
+		{
+			name:       "buying price too high",
+			in:         domain.Purchase{WagerID: 3, BuyingPrice: decimal.NewFromFloat(11.11)},
+			statusCode: 400,
+			hasErr:     true,
+			err:        ErrorResponse{Code: domain.ErrorCodeBuyingPriceTooHigh, Description: domain.ErrBuyingPriceTooHigh.Error()},
+		},
+		{
+			name:       "wager closed",
+			in:         domain.Purchase{WagerID: 4, BuyingPrice: decimal.NewFromFloat(11.11)},
+			statusCode: 409,
+			hasErr:     true,
+			err:        ErrorResponse{Code: domain.ErrorCodeWagerClosed, Description: domain.ErrWagerClosed.Error()},
+		},
+		{
+			name:       "database fails",
+			in:         domain.Purchase{WagerID: 5, BuyingPrice: decimal.NewFromFloat(11.11)},
+			statusCode: 500,
+			hasErr:     true,
+			err:        ErrorResponse{Description: sql.ErrConnDone.Error()},
+		},
 	}
 
 	mockRepo := &mocks.WagerRepository{}
 	mockRepo.On("Close", mock.Anything).Return(nil)
+	mockRepo.On("Purchase", mock.Anything, 2, mock.Anything).Return(domain.Purchase{}, domain.ErrWagerNotFound)
+	mockRepo.On("Purchase", mock.Anything, 3, mock.Anything).Return(domain.Purchase{}, domain.ErrBuyingPriceTooHigh)
+	mockRepo.On("Purchase", mock.Anything, 4, mock.Anything).Return(domain.Purchase{}, domain.ErrWagerClosed)
+	mockRepo.On("Purchase", mock.Anything, 5, mock.Anything).Return(domain.Purchase{}, sql.ErrConnDone)
 	mockRepo.On("Purchase", mock.Anything, mock.Anything, mock.Anything).Return(domain.Purchase{}, nil)
 
 	app := New(mockRepo)
@@ -194,13 +301,17 @@ func TestBuyWager(t *testing.T) {
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
 			data, _ := json.Marshal(tc.in)
-			wagerID := tc.in.WagerID
-			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/buy/%d", wagerID), bytes.NewBuffer(data))
+			if tc.path == "" {
+				tc.path = strconv.Itoa(tc.in.WagerID)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/buy/"+tc.path, bytes.NewBuffer(data))
 
 			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
 			rec := httptest.NewRecorder()
 			ctx := echo.New().NewContext(req, rec)
+			ctx.SetParamNames("wager_id")
+			ctx.SetParamValues(tc.path)
 
 			app.buyWager(ctx)
 
@@ -276,3 +387,1381 @@ func TestGetWagers(t *testing.T) {
 		})
 	}
 }
+
+func TestGetWager(t *testing.T) {
+	tcs := []struct {
+		name       string
+		wagerID    string
+		statusCode int
+	}{
+		{name: "get wager successfully", wagerID: "1", statusCode: 200},
+		{name: "wager is not found", wagerID: "2", statusCode: 404},
+		{name: "database fails", wagerID: "3", statusCode: 500},
+		{name: "invalid wager id", wagerID: "abc", statusCode: 400},
+		{name: "wager id is not positive", wagerID: "0", statusCode: 400},
+	}
+
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Find", mock.Anything, 1).Return(domain.Wager{ID: 1}, nil)
+	mockRepo.On("Find", mock.Anything, 2).Return(domain.Wager{}, fmt.Errorf("wager 2: %w", domain.ErrWagerNotFound))
+	mockRepo.On("Find", mock.Anything, 3).Return(domain.Wager{}, sql.ErrConnDone)
+
+	app := New(mockRepo)
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			rec := httptest.NewRecorder()
+			ctx := echo.New().NewContext(req, rec)
+			ctx.SetParamNames("wager_id")
+			ctx.SetParamValues(tc.wagerID)
+
+			app.getWager(ctx)
+			assert.Equal(t, tc.statusCode, rec.Code)
+
+			if tc.statusCode == 200 {
+				wager := domain.Wager{}
+				assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &wager))
+				assert.Equal(t, 1, wager.ID)
+			}
+		})
+	}
+}
+
+func TestPlaceWagerBatch(t *testing.T) {
+	validWager := domain.Wager{
+		TotalWagerValue:   10,
+		Odds:              1,
+		SellingPercentage: 10,
+		SellingPrice:      decimal.NewFromFloat(10.11),
+	}
+	invalidWager := domain.Wager{
+		TotalWagerValue:   -1,
+		Odds:              1,
+		SellingPercentage: 10,
+		SellingPrice:      decimal.NewFromFloat(10.11),
+	}
+
+	tcs := []struct {
+		name       string
+		in         placeWagersRequest
+		statusCode int
+		statuses   []int
+	}{
+		{
+			name: "all wagers are placed",
+			in: placeWagersRequest{
+				Wagers: []domain.Wager{validWager, validWager},
+			},
+			statusCode: 201,
+			statuses:   []int{201, 201},
+		},
+		{
+			name: "all or nothing rejects the batch",
+			in: placeWagersRequest{
+				Mode:   batchModeAllOrNothing,
+				Wagers: []domain.Wager{validWager, invalidWager},
+			},
+			statusCode: 400,
+			statuses:   []int{424, 400},
+		},
+		{
+			name: "partial places the valid wagers",
+			in: placeWagersRequest{
+				Mode:   batchModePartial,
+				Wagers: []domain.Wager{invalidWager, validWager},
+			},
+			statusCode: 207,
+			statuses:   []int{400, 201},
+		},
+		{
+			name: "unknown mode",
+			in: placeWagersRequest{
+				Mode:   "some",
+				Wagers: []domain.Wager{validWager},
+			},
+			statusCode: 400,
+		},
+		{
+			name:       "empty batch",
+			in:         placeWagersRequest{},
+			statusCode: 400,
+		},
+	}
+
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Close", mock.Anything).Return(nil)
+	mockRepo.On("CreateBatch", mock.Anything, mock.Anything).Return(
+		func(_ context.Context, wagers []domain.Wager) []domain.Wager { return wagers }, nil)
+
+	app := New(mockRepo)
+	assert.NotNil(t, app)
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			data, _ := json.Marshal(tc.in)
+			req := httptest.NewRequest(http.MethodPost, "/wagers/batch", bytes.NewBuffer(data))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			ctx := echo.New().NewContext(req, rec)
+
+			app.placeWagerBatch(ctx)
+			assert.Equal(t, tc.statusCode, rec.Code)
+
+			if len(tc.statuses) > 0 {
+				var res PlaceWagersResponse
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+				if tc.statusCode == http.StatusBadRequest {
+					// a rejected batch is an error response with the results of its wagers
+					var errRes ErrorResponse
+					require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &errRes))
+					assert.Equal(t, "batch is rejected because 1 wagers are invalid", errRes.Description)
+					res.Results = errRes.Results
+				}
+				require.Len(t, res.Results, len(tc.statuses))
+				for i, status := range tc.statuses {
+					assert.Equal(t, i, res.Results[i].Index)
+					assert.Equal(t, status, res.Results[i].Status)
+				}
+			}
+		})
+	}
+}
+
+func TestBuyBasket(t *testing.T) {
+	tcs := []struct {
+		name       string
+		in         domain.Basket
+		repoErr    error
+		statusCode int
+		hasErr     bool
+		err        ErrorResponse
+	}{
+		{
+			name: "successful basket",
+			in: domain.Basket{Purchases: []domain.Purchase{
+				{WagerID: 2, BuyingPrice: decimal.NewFromFloat(11.11)},
+				{WagerID: 1, BuyingPrice: decimal.NewFromFloat(1.1)},
+			}},
+			statusCode: 201,
+		},
+		{
+			name:       "empty basket",
+			in:         domain.Basket{},
+			statusCode: 400,
+			hasErr:     true,
+			err: ErrorResponse{
+				Description: domain.ErrEmptyBasket,
+			},
+		},
+		{
+			name: "duplicate wager",
+			in: domain.Basket{Purchases: []domain.Purchase{
+				{WagerID: 1, BuyingPrice: decimal.NewFromFloat(11.11)},
+				{WagerID: 1, BuyingPrice: decimal.NewFromFloat(1.1)},
+			}},
+			statusCode: 400,
+			hasErr:     true,
+			err: ErrorResponse{
+				Description: domain.ErrDuplicateBasketWager,
+			},
+		},
+		{
+			name: "wager not found",
+			in: domain.Basket{Purchases: []domain.Purchase{
+				{WagerID: 3, BuyingPrice: decimal.NewFromFloat(11.11)},
+			}},
+			repoErr:    domain.ErrWagerNotFound,
+			statusCode: 404,
+			hasErr:     true,
+			err: ErrorResponse{
+				Code:        domain.ErrorCodeWagerNotFound,
+				Description: domain.ErrWagerNotFound.Error(),
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := &mocks.WagerRepository{}
+			mockRepo.On("PurchaseBasket", mock.Anything, mock.Anything).Return(
+				func(_ context.Context, purchases []domain.Purchase) []domain.Purchase { return purchases }, tc.repoErr)
+
+			app := New(mockRepo)
+
+			data, _ := json.Marshal(tc.in)
+			req := httptest.NewRequest(http.MethodPost, "/buy/basket", bytes.NewBuffer(data))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			ctx := echo.New().NewContext(req, rec)
+
+			app.buyBasket(ctx)
+
+			if tc.hasErr {
+				var errRes ErrorResponse
+				assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &errRes))
+				assert.Equal(t, tc.err, errRes)
+			} else {
+				var res domain.Basket
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+				assert.Len(t, res.Purchases, len(tc.in.Purchases))
+			}
+			assert.Equal(t, tc.statusCode, rec.Code)
+		})
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	tcs := []struct {
+		name       string
+		query      url.Values
+		statusCode int
+		hasErr     bool
+		err        ErrorResponse
+	}{
+		{
+			name:       "default range",
+			query:      url.Values{},
+			statusCode: 200,
+		},
+		{
+			name: "hourly stats",
+			query: url.Values{
+				"from":   []string{"2020-10-01"},
+				"to":     []string{"2020-10-02T00:00:00Z"},
+				"bucket": []string{domain.StatsBucketHour},
+			},
+			statusCode: 200,
+		},
+		{
+			name: "invalid bucket",
+			query: url.Values{
+				"bucket": []string{"month"},
+			},
+			statusCode: 400,
+			hasErr:     true,
+			err: ErrorResponse{
+				Description: domain.ErrInvalidStatsBucket,
+			},
+		},
+		{
+			name: "invalid range",
+			query: url.Values{
+				"from": []string{"2020-10-02"},
+				"to":   []string{"2020-10-01"},
+			},
+			statusCode: 400,
+			hasErr:     true,
+			err: ErrorResponse{
+				Description: domain.ErrInvalidStatsRange,
+			},
+		},
+		{
+			name: "too many buckets",
+			query: url.Values{
+				"from":   []string{"2010-10-01"},
+				"to":     []string{"2020-10-01"},
+				"bucket": []string{domain.StatsBucketHour},
+			},
+			statusCode: 400,
+			hasErr:     true,
+			err: ErrorResponse{
+				Description: domain.ErrTooManyStatsBucket,
+			},
+		},
+	}
+
+	mockAnalytics := &mocks.AnalyticsRepository{}
+	mockAnalytics.On("Stats", mock.Anything, mock.Anything).Return([]domain.MarketStats{}, nil)
+
+	app := New(&mocks.WagerRepository{}, WithAnalytics(mockAnalytics))
+	assert.NotNil(t, app)
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/stats?"+tc.query.Encode(), nil)
+			rec := httptest.NewRecorder()
+			ctx := echo.New().NewContext(req, rec)
+
+			app.getStats(ctx)
+			assert.Equal(t, tc.statusCode, rec.Code)
+
+			if tc.hasErr {
+				var errRes ErrorResponse
+				assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &errRes))
+				assert.Equal(t, tc.err, errRes)
+			}
+		})
+	}
+}
+
+func TestGetAuditTrail(t *testing.T) {
+	chain := func(n int) []domain.AuditEvent {
+		events := make([]domain.AuditEvent, n)
+		prevHash := domain.AuditGenesisHash
+		for i := range events {
+			events[i] = domain.AuditEvent{
+				ID:        int64(i + 1),
+				WagerID:   1,
+				Action:    domain.AuditActionPurchased,
+				Actor:     "tester",
+				After:     json.RawMessage(fmt.Sprintf(`{"id":1,"amount_sold":%d}`, i)),
+				PrevHash:  prevHash,
+				CreatedAt: time.Now(),
+			}
+			events[i].Hash = events[i].ComputeHash()
+			prevHash = events[i].Hash
+		}
+		return events
+	}
+
+	tampered := chain(3)
+	tampered[1].Actor = "someone else"
+
+	tcs := []struct {
+		name       string
+		wagerID    string
+		events     []domain.AuditEvent
+		statusCode int
+		verified   bool
+		brokenAt   int64
+	}{
+		{
+			name:       "verified trail",
+			wagerID:    "1",
+			events:     chain(3),
+			statusCode: 200,
+			verified:   true,
+		},
+		{
+			name:       "tampered trail",
+			wagerID:    "1",
+			events:     tampered,
+			statusCode: 200,
+			brokenAt:   2,
+		},
+		{
+			name:       "unknown wager",
+			wagerID:    "1",
+			statusCode: 404,
+		},
+		{
+			name:       "invalid wager id",
+			wagerID:    "abc",
+			statusCode: 400,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAudit := &mocks.AuditRepository{}
+			mockAudit.On("AuditTrail", mock.Anything, 1).Return(tc.events, nil)
+
+			app := New(&mocks.WagerRepository{}, WithAudit(mockAudit))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			rec := httptest.NewRecorder()
+			ctx := echo.New().NewContext(req, rec)
+			ctx.SetPath("/wagers/:wager_id/audit")
+			ctx.SetParamNames("wager_id")
+			ctx.SetParamValues(tc.wagerID)
+
+			app.getAuditTrail(ctx)
+			assert.Equal(t, tc.statusCode, rec.Code)
+
+			if tc.statusCode == 200 {
+				var res AuditTrailResponse
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+				assert.Equal(t, tc.verified, res.Verified)
+				assert.Equal(t, tc.brokenAt, res.BrokenAt)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	callers := config.Callers{"gateway": "gateway-key"}
+
+	tcs := []struct {
+		name         string
+		callers      config.Callers
+		auth         string
+		statusCode   int
+		actor        string
+		claimedActor string
+	}{
+		{name: "anonymous", callers: callers, statusCode: 201, actor: domain.AnonymousActor, claimedActor: "qa"},
+		{name: "api key", callers: callers, auth: "Bearer gateway-key", statusCode: 201, actor: "gateway", claimedActor: "qa"},
+		{name: "unknown api key", callers: callers, auth: "Bearer qa", statusCode: 401},
+		{name: "not a bearer token", callers: callers, auth: "Basic Z2F0ZXdheS1rZXk=", statusCode: 401},
+		{name: "token of the gateway", auth: "Bearer qa", statusCode: 201, actor: domain.AnonymousActor, claimedActor: "qa"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := config.Load("")
+			require.NoError(t, err)
+			cfg.Service.Callers = tc.callers
+
+			mockRepo := &mocks.WagerRepository{}
+			mockRepo.On("Create", mock.MatchedBy(func(ctx context.Context) bool {
+				return domain.ActorFromContext(ctx) == tc.actor && domain.ClaimedActorFromContext(ctx) == tc.claimedActor
+			}), mock.Anything).Return(domain.Wager{ID: 1}, nil)
+
+			app := New(mockRepo, WithConfig(cfg))
+
+			req := httptest.NewRequest(http.MethodPost, "/wagers",
+				strings.NewReader(`{"total_wager_value":10,"odds":1,"selling_percentage":10,"selling_price":10.11}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(headerActor, "qa")
+			if tc.auth != "" {
+				req.Header.Set(echo.HeaderAuthorization, tc.auth)
+			}
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.statusCode, rec.Code)
+			if tc.statusCode == 201 {
+				mockRepo.AssertExpectations(t)
+			} else {
+				mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Create", mock.Anything, mock.Anything).Return(domain.Wager{ID: 1}, nil)
+	mockRepo.On("Get", mock.MatchedBy(domain.FreshReadFromContext), 1, 10).Return([]domain.Wager{{ID: 1}}, 1, nil)
+	mockRepo.On("Get", mock.Anything, 1, 10).Return([]domain.Wager{}, 0, nil)
+
+	app := New(mockRepo, WithReadYourWrites(time.Minute))
+
+	data, _ := json.Marshal(domain.Wager{
+		TotalWagerValue:   10,
+		Odds:              1,
+		SellingPercentage: 10,
+		SellingPrice:      decimal.NewFromFloat(10.11),
+	})
+	req := httptest.NewRequest(http.MethodPost, "/wagers", bytes.NewBuffer(data))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	app.e.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	var wagers []domain.Wager
+
+	// the writer reads from the primary
+	req = httptest.NewRequest(http.MethodGet, "/wagers?page=1&limit=10", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	app.e.ServeHTTP(rec, req)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &wagers))
+	assert.Len(t, wagers, 1)
+
+	// other clients may read from a replica
+	req = httptest.NewRequest(http.MethodGet, "/wagers?page=1&limit=10", nil)
+	rec = httptest.NewRecorder()
+	app.e.ServeHTTP(rec, req)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &wagers))
+	assert.Len(t, wagers, 0)
+}
+
+func TestReloadableSettings(t *testing.T) {
+	settings := config.App{
+		MaxWagerInPage:   5,
+		MaxWagersInBatch: 1,
+	}
+
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Get", mock.Anything, 1, 10).Return([]domain.Wager{}, 0, nil)
+
+	app := New(mockRepo, WithSettings(func() config.App { return settings }))
+
+	get := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/wagers?page=1&limit=10", nil)
+		rec := httptest.NewRecorder()
+		app.e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, get())
+
+	settings.MaxWagerInPage = 10
+	assert.Equal(t, http.StatusOK, get())
+
+	// the stats feature is off
+	req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+	rec := httptest.NewRecorder()
+	app.e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// only the burst is allowed at once
+	settings.RateLimit = 1
+	settings.RateBurst = 2
+	assert.Equal(t, http.StatusOK, get())
+	assert.Equal(t, http.StatusOK, get())
+	assert.Equal(t, http.StatusTooManyRequests, get())
+}
+
+func TestRateLimitClientIP(t *testing.T) {
+	tcs := []struct {
+		name           string
+		trustedProxies []string
+		statusCode     int
+	}{
+		// a client can not pass for another one by sending X-Forwarded-For
+		{name: "no proxies", statusCode: http.StatusTooManyRequests},
+		{name: "untrusted proxy", trustedProxies: []string{"10.0.0.0/8"}, statusCode: http.StatusTooManyRequests},
+		{name: "trusted proxy", trustedProxies: []string{"192.0.2.0/24"}, statusCode: http.StatusOK},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := config.Load("")
+			require.NoError(t, err)
+			cfg.App.RateLimit = 1
+			cfg.App.RateBurst = 1
+			cfg.Service.TrustedProxies = tc.trustedProxies
+
+			mockRepo := &mocks.WagerRepository{}
+			mockRepo.On("Find", mock.Anything, 1).Return(domain.Wager{ID: 1}, nil)
+			app := New(mockRepo, WithConfig(cfg))
+
+			codes := []int{}
+			for _, ip := range []string{"198.51.100.1", "198.51.100.2"} {
+				// the request comes from 192.0.2.1
+				req := httptest.NewRequest(http.MethodGet, "/wagers/1", nil)
+				req.Header.Set(echo.HeaderXForwardedFor, ip)
+				rec := httptest.NewRecorder()
+				app.ServeHTTP(rec, req)
+				codes = append(codes, rec.Code)
+			}
+			assert.Equal(t, []int{http.StatusOK, tc.statusCode}, codes)
+		})
+	}
+
+	// the buckets are capped, the new clients are rejected until the others are idle
+	limiter := newRateLimiter()
+	limiter.maxKeys = 1
+	now := time.Now()
+	assert.True(t, limiter.allow("a", 1, 1, now))
+	assert.False(t, limiter.allow("b", 1, 1, now))
+	assert.True(t, limiter.allow("b", 1, 1, now.Add(2*rateLimiterIdle)))
+}
+
+type fakeDatabase struct {
+	err   error
+	stats sql.DBStats
+}
+
+func (db *fakeDatabase) Ping(ctx context.Context) error { return db.err }
+func (db *fakeDatabase) PoolStats() sql.DBStats         { return db.stats }
+
+func TestHealthCheck(t *testing.T) {
+	tcs := []struct {
+		name   string
+		db     *fakeDatabase
+		status string
+	}{
+		{
+			name:   "healthy database",
+			db:     &fakeDatabase{stats: sql.DBStats{MaxOpenConnections: 10, InUse: 1}},
+			status: healthStatusOK,
+		},
+		{
+			name:   "unreachable database",
+			db:     &fakeDatabase{err: errors.New("connection refused")},
+			status: healthStatusDegraded,
+		},
+		{
+			name:   "exhausted pool",
+			db:     &fakeDatabase{stats: sql.DBStats{MaxOpenConnections: 10, InUse: 10}},
+			status: healthStatusDegraded,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			app := New(&mocks.WagerRepository{}, WithDatabaseStatus(tc.db))
+
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			rec := httptest.NewRecorder()
+			app.e.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var res HealthResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			assert.Equal(t, tc.status, res.Status)
+			require.NotNil(t, res.Database)
+			assert.Equal(t, tc.db.stats.InUse, res.Database.InUse)
+		})
+	}
+}
+
+func TestReadyCheck(t *testing.T) {
+	var schemaErr error
+
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Close", mock.Anything).Return(nil)
+
+	app := New(mockRepo,
+		WithReadinessCheck("database", func(ctx context.Context) error { return nil }),
+		WithReadinessCheck("schema", func(ctx context.Context) error { return schemaErr }),
+	)
+
+	ready := func() (int, ReadyResponse) {
+		req := httptest.NewRequest(http.MethodGet, "/ready", nil)
+		rec := httptest.NewRecorder()
+		app.e.ServeHTTP(rec, req)
+
+		var res ReadyResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		return rec.Code, res
+	}
+
+	code, res := ready()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, readyStatusReady, res.Status)
+	assert.Len(t, res.Checks, 2)
+
+	schemaErr = errors.New("schema version 0 is older than 1")
+	code, res = ready()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, healthStatusOK, res.Checks["database"].Status)
+	assert.Equal(t, schemaErr.Error(), res.Checks["schema"].Error)
+
+	// the app is not ready once it starts closing
+	schemaErr = nil
+	require.NoError(t, app.Close(context.Background()))
+	code, res = ready()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, checkStatusFail, res.Checks["shutdown"].Status)
+
+	// the liveness does not depend on anything
+	req := httptest.NewRequest(http.MethodGet, "/live", nil)
+	rec := httptest.NewRecorder()
+	app.e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestMetrics(t *testing.T) {
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Purchase", mock.Anything, 1, mock.Anything).
+		Return(domain.Purchase{}, fmt.Errorf("wager 1: %w", domain.ErrBuyingPriceTooHigh))
+
+	app := New(metrics.NewRepository(mockRepo))
+
+	data, _ := json.Marshal(domain.Purchase{WagerID: 1, BuyingPrice: decimal.NewFromFloat(100)})
+	req := httptest.NewRequest(http.MethodPost, "/buy/1", bytes.NewBuffer(data))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	app.e.ServeHTTP(rec, req)
+
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec = httptest.NewRecorder()
+	app.e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	body := rec.Body.String()
+	assert.Contains(t, body, `wager_http_requests_total{method="POST",route="/buy/:wager_id",status="`)
+	assert.Contains(t, body, `wager_purchases_total{outcome="price_too_high"}`)
+	assert.Contains(t, body, `wager_repository_query_duration_seconds_count{method="purchase",success="false"}`)
+}
+
+// spanRecorder keeps the ended spans in memory
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*export.SpanData
+}
+
+func (r *spanRecorder) ExportSpans(ctx context.Context, spans []*export.SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func (r *spanRecorder) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	_, err := tracing.Setup(config.Tracing{Exporter: config.TracingExporterNone})
+	require.NoError(t, err)
+
+	recorder := &spanRecorder{}
+	global.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(recorder)))
+	defer global.SetTracerProvider(apitrace.NoopTracerProvider())
+
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Purchase", mock.Anything, 1, mock.Anything).Return(domain.Purchase{ID: 1, WagerID: 1}, nil)
+
+	app := New(mockRepo)
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	data, _ := json.Marshal(domain.Purchase{WagerID: 1, BuyingPrice: decimal.NewFromFloat(1)})
+	req := httptest.NewRequest(http.MethodPost, "/buy/1", bytes.NewBuffer(data))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	app.e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	// the response carries the trace of the caller
+	assert.Contains(t, rec.Header().Get("traceparent"), traceID)
+
+	names := map[string]bool{}
+	for _, span := range recorder.spans {
+		assert.Equal(t, traceID, span.SpanContext.TraceID.String())
+		names[span.Name] = true
+	}
+	assert.True(t, names["POST /buy/:wager_id"])
+	assert.True(t, names["app.bind"])
+	assert.True(t, names["app.validate"])
+}
+
+func TestRequestLogging(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Purchase", mock.Anything, 1, mock.Anything).Return(domain.Purchase{ID: 7, WagerID: 1}, nil)
+	mockRepo.On("Purchase", mock.Anything, 2, mock.Anything).
+		Return(domain.Purchase{}, fmt.Errorf("wager 2: %w", domain.ErrWagerNotFound))
+
+	app := New(mockRepo, WithLogger(zap.New(core)))
+
+	buy := func(wagerID int, requestID string) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(domain.Purchase{WagerID: wagerID, BuyingPrice: decimal.NewFromFloat(1)})
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/buy/%d", wagerID), bytes.NewBuffer(data))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if requestID != "" {
+			req.Header.Set(echo.HeaderXRequestID, requestID)
+		}
+
+		rec := httptest.NewRecorder()
+		app.e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// the request id of the client is echoed
+	rec := buy(1, "req-1")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "req-1", rec.Header().Get(echo.HeaderXRequestID))
+
+	purchased := logs.FilterMessage("Wager is purchased").All()
+	require.Len(t, purchased, 1)
+	fields := purchased[0].ContextMap()
+	assert.Equal(t, "req-1", fields["request_id"])
+	assert.EqualValues(t, 1, fields["wager_id"])
+	assert.EqualValues(t, 7, fields["purchase_id"])
+
+	served := logs.FilterMessage("Request served").All()
+	require.Len(t, served, 1)
+	assert.Contains(t, served[0].ContextMap(), "latency")
+
+	// a request without an id gets one
+	rec = buy(2, "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get(echo.HeaderXRequestID))
+
+	failed := logs.FilterMessage("Buy wager failed").All()
+	require.Len(t, failed, 1)
+	assert.Equal(t, rec.Header().Get(echo.HeaderXRequestID), failed[0].ContextMap()["request_id"])
+	assert.Equal(t, map[string]interface{}{
+		"message": "wager 2: wager is not found",
+		"class":   "not_found",
+	}, failed[0].ContextMap()["error"])
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	spec, err := loadSpec()
+	require.NoError(t, err)
+
+	app := New(&mocks.WagerRepository{})
+
+	// echo writes the path parameters as :name, OpenAPI as {name}
+	param := regexp.MustCompile(`:(\w+)`)
+
+	routes := map[string]bool{}
+	for _, r := range app.e.Routes() {
+		path := param.ReplaceAllString(r.Path, "{$1}")
+		routes[r.Method+" "+path] = true
+
+		item := spec.Paths.Find(path)
+		if assert.NotNil(t, item, "route %s %s is not in the spec", r.Method, r.Path) {
+			assert.NotNil(t, item.GetOperation(r.Method), "route %s %s is not in the spec", r.Method, r.Path)
+		}
+	}
+
+	for path, item := range spec.Paths {
+		for method := range item.Operations() {
+			assert.True(t, routes[method+" "+path], "%s %s of the spec is not a route", method, path)
+		}
+	}
+}
+
+func TestSpecValidation(t *testing.T) {
+	price := decimal.NewFromFloat(10.5)
+	wager := domain.Wager{
+		ID:                  1,
+		TotalWagerValue:     100,
+		Odds:                2,
+		SellingPercentage:   10,
+		SellingPrice:        price,
+		CurrentSellingPrice: price,
+		PlacedAt:            time.Now(),
+		Status:              domain.WagerStatusOpen,
+	}
+	purchase := domain.Purchase{ID: 1, WagerID: 1, BuyingPrice: price, BoughtAt: time.Now()}
+
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Create", mock.Anything, mock.Anything).Return(wager, nil)
+	mockRepo.On("CreateBatch", mock.Anything, mock.Anything).Return([]domain.Wager{wager}, nil)
+	mockRepo.On("Get", mock.Anything, mock.Anything, mock.Anything).Return([]domain.Wager{wager}, 1, nil)
+	mockRepo.On("Find", mock.Anything, 1).Return(wager, nil)
+	mockRepo.On("Purchase", mock.Anything, 1, mock.Anything).Return(purchase, nil)
+	mockRepo.On("Purchase", mock.Anything, 2, mock.Anything).
+		Return(domain.Purchase{}, fmt.Errorf("wager 2: %w", domain.ErrWagerClosed))
+	mockRepo.On("PurchaseBasket", mock.Anything, mock.Anything).Return([]domain.Purchase{purchase}, nil)
+
+	mockAnalytics := &mocks.AnalyticsRepository{}
+	mockAnalytics.On("Stats", mock.Anything, mock.Anything).Return([]domain.MarketStats{{
+		Bucket:       time.Now().Truncate(24 * time.Hour),
+		WagersPlaced: 1,
+		VolumePlaced: price,
+	}}, nil)
+
+	mockAudit := &mocks.AuditRepository{}
+	event := domain.AuditEvent{
+		ID:        1,
+		WagerID:   1,
+		Action:    domain.AuditActionPlaced,
+		Actor:     "tester",
+		After:     json.RawMessage(`{"id":1}`),
+		PrevHash:  domain.AuditGenesisHash,
+		CreatedAt: time.Now(),
+	}
+	event.Hash = event.ComputeHash()
+	mockAudit.On("AuditTrail", mock.Anything, 1).Return([]domain.AuditEvent{event}, nil)
+
+	app := New(mockRepo,
+		WithAnalytics(mockAnalytics),
+		WithAudit(mockAudit),
+		WithDatabaseStatus(&fakeDatabase{}),
+		WithSpecValidation(true),
+	)
+
+	tcs := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		statusCode int
+	}{
+		{name: "health", method: http.MethodGet, path: "/health", statusCode: 200},
+		{name: "live", method: http.MethodGet, path: "/live", statusCode: 200},
+		{name: "ready", method: http.MethodGet, path: "/ready", statusCode: 200},
+		{name: "metrics", method: http.MethodGet, path: "/metrics", statusCode: 200},
+		{name: "openapi", method: http.MethodGet, path: "/openapi.json", statusCode: 200},
+		{name: "place wager", method: http.MethodPost, path: "/wagers",
+			body: `{"total_wager_value": 100, "odds": 2, "selling_percentage": 10, "selling_price": 10.5}`, statusCode: 201},
+		{name: "place wager without odds", method: http.MethodPost, path: "/wagers",
+			body: `{"total_wager_value": 100, "selling_percentage": 10, "selling_price": 10.5}`, statusCode: 400},
+		{name: "place wager batch", method: http.MethodPost, path: "/wagers/batch",
+			body: `{"wagers": [{"total_wager_value": 100, "odds": 2, "selling_percentage": 10, "selling_price": 10.5}]}`, statusCode: 201},
+		{name: "get wagers", method: http.MethodGet, path: "/wagers?page=1&limit=10", statusCode: 200},
+		{name: "get wager", method: http.MethodGet, path: "/wagers/1", statusCode: 200},
+		{name: "get wagers without limit", method: http.MethodGet, path: "/wagers?page=1", statusCode: 400},
+		{name: "buy wager", method: http.MethodPost, path: "/buy/1", body: `{"buying_price": 10.5}`, statusCode: 201},
+		{name: "buy closed wager", method: http.MethodPost, path: "/buy/2", body: `{"buying_price": 10.5}`, statusCode: 409},
+		{name: "buy basket", method: http.MethodPost, path: "/buy/basket",
+			body: `{"purchases": [{"wager_id": 1, "buying_price": "10.5"}]}`, statusCode: 201},
+		{name: "get stats", method: http.MethodGet, path: "/stats?bucket=day", statusCode: 200},
+		{name: "get audit trail", method: http.MethodGet, path: "/wagers/1/audit", statusCode: 200},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			app.e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.statusCode, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestResponseValidation(t *testing.T) {
+	spec, err := loadSpec()
+	require.NoError(t, err)
+
+	app := New(&mocks.WagerRepository{}, WithSpecValidation(true))
+	validate := app.validateSpec(openapi3filter.NewRouter().WithSwagger(spec))
+
+	// a wager without its fields does not match the spec
+	handler := validate(func(ctx echo.Context) error {
+		return ctx.JSON(http.StatusOK, map[string]string{"id": "1"})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/wagers/1", nil)
+	rec := httptest.NewRecorder()
+	ctx := echo.New().NewContext(req, rec)
+	ctx.SetPath("/wagers/:wager_id")
+	require.NoError(t, handler(ctx))
+
+	// the middlewares before the validation see the status which is sent
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, http.StatusInternalServerError, ctx.Response().Status)
+	assert.Equal(t, int64(rec.Body.Len()), ctx.Response().Size)
+	assert.Contains(t, rec.Body.String(), "response does not match the spec")
+}
+
+// burst are more events of the wager than a client can read while they are published
+func burst(wagerID, n int) []domain.MarketEvent {
+	wagers := make([]domain.Wager, n)
+	for i := range wagers {
+		wagers[i].ID = wagerID
+	}
+
+	return domain.PlacedMarketEvents(wagers...)
+}
+
+// readServerEvent reads the next event of a text/event-stream, the comments are skipped
+func readServerEvent(t *testing.T, r *bufio.Reader) (id, event string, data []byte) {
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "":
+			if event != "" {
+				return id, event, data
+			}
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = []byte(strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	hub := stream.NewHub(16, 2)
+	srv := httptest.NewServer(New(&mocks.WagerRepository{}, WithStream(hub), WithSpecValidation(true)))
+	defer srv.Close()
+
+	sub := hub.Subscribe(stream.Filter{}, "")
+	hub.Publish(context.Background(), domain.PlacedMarketEvents(domain.Wager{ID: 1}, domain.Wager{ID: 2})...)
+	first := <-sub.Events()
+	sub.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/wagers/stream?wager_id=2,3&type=wager_placed,sold_out", nil)
+	require.NoError(t, err)
+	req.Header.Set(headerLastEventID, first.ID)
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get(echo.HeaderContentType))
+
+	r := bufio.NewReader(res.Body)
+
+	// the backlog after the last event id
+	id, event, data := readServerEvent(t, r)
+	assert.Equal(t, domain.MarketWagerPlaced, event)
+	var got domain.MarketEvent
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, id, got.ID)
+	assert.Equal(t, 2, got.WagerID)
+
+	// the live events which match the filter
+	purchase := domain.Purchase{ID: 1, WagerID: 3, BoughtAt: time.Now()}
+	sold := 1
+	before := domain.Wager{ID: 3, TotalWagerValue: 1, CurrentSellingPrice: decimal.NewFromInt(5)}
+	after := domain.Wager{ID: 3, TotalWagerValue: 1, CurrentSellingPrice: decimal.NewFromInt(5), AmountSold: &sold}
+	hub.Publish(context.Background(), domain.PlacedMarketEvents(domain.Wager{ID: 4})...)
+	hub.Publish(context.Background(), domain.PurchasedMarketEvents(purchase, before, after)...)
+
+	_, event, data = readServerEvent(t, r)
+	assert.Equal(t, domain.MarketSoldOut, event)
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, 3, got.WagerID)
+
+	// a slow client is dropped with an error event
+	hub.Publish(context.Background(), burst(2, 1000)...)
+	for {
+		_, event, data = readServerEvent(t, r)
+		if event != domain.MarketWagerPlaced {
+			break
+		}
+	}
+	assert.Equal(t, "error", event)
+	assert.Contains(t, string(data), stream.ErrSlowConsumer.Error())
+
+	// an unknown last event id is answered with a reset
+	req.Header.Set(headerLastEventID, "unknown-1")
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	_, event, _ = readServerEvent(t, bufio.NewReader(res.Body))
+	assert.Equal(t, streamReset, event)
+
+	tcs := []struct {
+		name       string
+		app        *App
+		query      string
+		statusCode int
+	}{
+		{name: "unknown type", app: New(&mocks.WagerRepository{}, WithStream(hub)), query: "?type=unknown", statusCode: http.StatusBadRequest},
+		{name: "invalid wager id", app: New(&mocks.WagerRepository{}, WithStream(hub)), query: "?wager_id=0", statusCode: http.StatusBadRequest},
+		{name: "no stream", app: New(&mocks.WagerRepository{}), statusCode: http.StatusNotImplemented},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, path := range []string{"/wagers/stream", "/wagers/stream/ws"} {
+				rec := httptest.NewRecorder()
+				tc.app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path+tc.query, nil))
+				assert.Equal(t, tc.statusCode, rec.Code, path)
+			}
+		})
+	}
+}
+
+func TestStreamTimeout(t *testing.T) {
+	cfg, err := config.Load("")
+	require.NoError(t, err)
+	cfg.Service.ReadTimeout = 100 * time.Millisecond
+	cfg.Service.WriteTimeout = 100 * time.Millisecond
+
+	// the stream outlives the timeouts of the server it is served by
+	hub := stream.NewHub(16, 2)
+	srv := httptest.NewUnstartedServer(New(&mocks.WagerRepository{}, WithStream(hub), WithConfig(cfg)))
+	srv.Config.ReadTimeout = cfg.Service.ReadTimeout
+	srv.Config.WriteTimeout = cfg.Service.WriteTimeout
+	srv.Config.ConnContext = withConn
+	srv.Start()
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/wagers/stream")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	r := bufio.NewReader(res.Body)
+	time.Sleep(3 * cfg.Service.WriteTimeout)
+	hub.Publish(context.Background(), domain.PlacedMarketEvents(domain.Wager{ID: 1})...)
+	_, event, _ := readServerEvent(t, r)
+	assert.Equal(t, domain.MarketWagerPlaced, event)
+
+	// without the connection the stream ends before the write timeout, the heartbeats are sent before it
+	app := New(&mocks.WagerRepository{}, WithStream(hub), WithConfig(cfg))
+	plain := httptest.NewServer(app)
+	defer plain.Close()
+
+	res, err = http.Get(plain.URL + "/wagers/stream")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), ": heartbeat")
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	hub := stream.NewHub(16, 2)
+	srv := httptest.NewServer(New(&mocks.WagerRepository{}, WithStream(hub)))
+	defer srv.Close()
+
+	hub.Publish(context.Background(), domain.PlacedMarketEvents(domain.Wager{ID: 1})...)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/wagers/stream/ws?last_event_id=unknown-1&wager_id=2", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var event domain.MarketEvent
+	require.NoError(t, conn.ReadJSON(&event))
+	assert.Equal(t, streamReset, event.Type)
+
+	for hub.Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	hub.Publish(context.Background(), domain.PlacedMarketEvents(domain.Wager{ID: 1}, domain.Wager{ID: 2})...)
+	require.NoError(t, conn.ReadJSON(&event))
+	assert.Equal(t, domain.MarketWagerPlaced, event.Type)
+	assert.Equal(t, 2, event.WagerID)
+
+	// a slow client is closed with try again later
+	hub.Publish(context.Background(), burst(2, 1000)...)
+	for err == nil {
+		err = conn.ReadJSON(&event)
+	}
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseTryAgainLater), err)
+}
+
+func TestStreamShutdown(t *testing.T) {
+	hub := stream.NewHub(16, 2)
+	app := New(&mocks.WagerRepository{}, WithStream(hub))
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/wagers/stream")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/wagers/stream/ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	for hub.Subscribers() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the streams end once the app shuts down, so they do not hold the shutdown open
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, app.Shutdown(ctx))
+
+	_, event, data := readServerEvent(t, bufio.NewReader(res.Body))
+	assert.Equal(t, "error", event)
+	assert.Contains(t, string(data), errStreamClosing.Error())
+
+	var got domain.MarketEvent
+	err = conn.ReadJSON(&got)
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+}
+
+func TestCreateWebhook(t *testing.T) {
+	tcs := []struct {
+		name       string
+		body       string
+		statusCode int
+	}{
+		{
+			name:       "generated secret",
+			body:       `{"url": "https://partner.example/hooks", "event_types": ["sold_out"]}`,
+			statusCode: http.StatusCreated,
+		},
+		{
+			name:       "own secret",
+			body:       `{"url": "http://partner.example/hooks", "secret": "0123456789abcdef"}`,
+			statusCode: http.StatusCreated,
+		},
+		{
+			name:       "short secret",
+			body:       `{"url": "https://partner.example/hooks", "secret": "abc"}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "relative url",
+			body:       `{"url": "/hooks"}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown event type",
+			body:       `{"url": "https://partner.example/hooks", "event_types": ["sold"]}`,
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mockWebhooks := &mocks.WebhookRepository{}
+			mockWebhooks.On("CreateWebhook", mock.Anything, mock.Anything).Return(
+				func(ctx context.Context, hook domain.Webhook) domain.Webhook {
+					hook.ID = 1
+					hook.CreatedAt = time.Now()
+					if hook.EventTypes == nil {
+						hook.EventTypes = []string{}
+					}
+					return hook
+				}, nil)
+
+			app := New(&mocks.WagerRepository{}, WithWebhooks(mockWebhooks), WithSpecValidation(true))
+
+			req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+			require.Equal(t, tc.statusCode, rec.Code, rec.Body.String())
+
+			if tc.statusCode == http.StatusCreated {
+				var hook domain.Webhook
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &hook))
+				assert.Equal(t, 1, hook.ID)
+				assert.True(t, len(hook.Secret) >= 16)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	New(&mocks.WagerRepository{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/webhooks/1/deliveries", nil))
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	lastError := "response status 503"
+	dead := domain.WebhookDelivery{
+		ID:             7,
+		WebhookID:      1,
+		EventID:        "3-1",
+		EventType:      domain.MarketSoldOut,
+		WagerID:        2,
+		Status:         domain.WebhookDeliveryDead,
+		Attempts:       12,
+		ResponseStatus: &status,
+		LastError:      &lastError,
+		NextAttemptAt:  time.Now(),
+		CreatedAt:      time.Now(),
+	}
+	redelivered := dead
+	redelivered.Status = domain.WebhookDeliveryPending
+
+	mockWebhooks := &mocks.WebhookRepository{}
+	mockWebhooks.On("WebhookDeliveries", mock.Anything, 1, defaultDeliveriesInPage).Return([]domain.WebhookDelivery{dead}, nil)
+	mockWebhooks.On("WebhookDeliveries", mock.Anything, 1, 10).Return([]domain.WebhookDelivery{}, nil)
+	mockWebhooks.On("WebhookDeliveries", mock.Anything, 2, mock.Anything).
+		Return(nil, fmt.Errorf("webhook 2: %w", domain.ErrWebhookNotFound))
+	mockWebhooks.On("RedeliverWebhook", mock.Anything, 1, int64(7)).Return(redelivered, nil)
+	mockWebhooks.On("RedeliverWebhook", mock.Anything, 1, int64(8)).
+		Return(domain.WebhookDelivery{}, fmt.Errorf("delivery 8: %w", domain.ErrWebhookDeliveryNotFound))
+
+	app := New(&mocks.WagerRepository{}, WithWebhooks(mockWebhooks), WithSpecValidation(true))
+
+	tcs := []struct {
+		name       string
+		method     string
+		path       string
+		statusCode int
+		status     string
+	}{
+		{name: "log", method: http.MethodGet, path: "/webhooks/1/deliveries", statusCode: http.StatusOK, status: domain.WebhookDeliveryDead},
+		{name: "log with limit", method: http.MethodGet, path: "/webhooks/1/deliveries?limit=10", statusCode: http.StatusOK},
+		{name: "limit too large", method: http.MethodGet, path: "/webhooks/1/deliveries?limit=1000", statusCode: http.StatusBadRequest},
+		{name: "unknown webhook", method: http.MethodGet, path: "/webhooks/2/deliveries", statusCode: http.StatusNotFound},
+		{name: "redeliver", method: http.MethodPost, path: "/webhooks/1/deliveries/7/redeliver", statusCode: http.StatusAccepted, status: domain.WebhookDeliveryPending},
+		{name: "unknown delivery", method: http.MethodPost, path: "/webhooks/1/deliveries/8/redeliver", statusCode: http.StatusNotFound},
+		{name: "invalid delivery id", method: http.MethodPost, path: "/webhooks/1/deliveries/abc/redeliver", statusCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+			require.Equal(t, tc.statusCode, rec.Code, rec.Body.String())
+
+			switch tc.method {
+			case http.MethodGet:
+				if tc.status != "" {
+					var deliveries []domain.WebhookDelivery
+					require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &deliveries))
+					require.Len(t, deliveries, 1)
+					assert.Equal(t, tc.status, deliveries[0].Status)
+				}
+			case http.MethodPost:
+				if tc.status != "" {
+					var delivery domain.WebhookDelivery
+					require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &delivery))
+					assert.Equal(t, tc.status, delivery.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyLimits(t *testing.T) {
+	t.Run("too many keys", func(t *testing.T) {
+		store := newIdempotencyStore()
+		store.maxKeys = 1
+		now := time.Now()
+
+		_, first, err := store.acquire("a", nil, now)
+		require.NoError(t, err)
+		assert.True(t, first)
+
+		_, _, err = store.acquire("b", nil, now)
+		assert.Equal(t, errIdempotencyFull, err)
+
+		// the expired keys make room for the new ones
+		_, first, err = store.acquire("b", nil, now.Add(idempotencyKeyTTL+time.Second))
+		require.NoError(t, err)
+		assert.True(t, first)
+	})
+
+	t.Run("request too large", func(t *testing.T) {
+		app := New(&mocks.WagerRepository{})
+
+		body := bytes.Repeat([]byte(" "), idempotencyMaxBody+1)
+		req := httptest.NewRequest(http.MethodPost, "/wagers", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(HeaderIdempotencyKey, "key")
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+}
+
+func TestIdempotency(t *testing.T) {
+	cfg, err := config.Load("")
+	require.NoError(t, err)
+	cfg.Service.Callers = config.Callers{"gateway": "gateway-key", "backoffice": "backoffice-key"}
+
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Purchase", mock.Anything, 1, mock.Anything).
+		Return(domain.Purchase{ID: 7, WagerID: 1, BuyingPrice: decimal.NewFromFloat(1.5)}, nil)
+	mockRepo.On("Purchase", mock.Anything, 2, mock.Anything).Return(domain.Purchase{}, sql.ErrConnDone)
+
+	app := New(mockRepo, WithConfig(cfg))
+
+	buy := func(wagerID int, price, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/buy/%d", wagerID),
+			strings.NewReader(fmt.Sprintf(`{"buying_price":%s}`, price)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(HeaderIdempotencyKey, "key")
+		if apiKey != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+apiKey)
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := buy(1, "1.5", "gateway-key")
+	require.Equal(t, http.StatusCreated, first.Code, first.Body.String())
+	assert.Empty(t, first.Header().Get(HeaderIdempotentReplayed))
+
+	// the retry is replayed
+	retry := buy(1, "1.5", "gateway-key")
+	require.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, retry.Header().Get(echo.HeaderContentType))
+	mockRepo.AssertNumberOfCalls(t, "Purchase", 1)
+
+	// the key can not be sent with another request
+	reused := buy(1, "2.5", "gateway-key")
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+
+	// the keys of another caller are apart
+	other := buy(1, "2.5", "backoffice-key")
+	require.Equal(t, http.StatusCreated, other.Code)
+	assert.Empty(t, other.Header().Get(HeaderIdempotentReplayed))
+	mockRepo.AssertNumberOfCalls(t, "Purchase", 2)
+
+	// the server errors are served again
+	assert.Equal(t, http.StatusInternalServerError, buy(2, "1.5", "").Code)
+	assert.Equal(t, http.StatusInternalServerError, buy(2, "1.5", "").Code)
+	mockRepo.AssertNumberOfCalls(t, "Purchase", 4)
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"wager/internal/domain"
+	"wager/internal/webhook"
+)
+
+const (
+	// defaultDeliveriesInPage and maxDeliveriesInPage are the limits of the delivery log
+	defaultDeliveriesInPage = 50
+	maxDeliveriesInPage     = 500
+)
+
+type (
+	createWebhookRequest struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+		// Secret signs the deliveries, one is generated when it is empty
+		Secret string `json:"secret"`
+	}
+
+	getWebhookDeliveriesRequest struct {
+		Limit int `query:"limit"`
+	}
+)
+
+// WithWebhooks serves the webhook subscriptions and their delivery log from the webhook repository
+func WithWebhooks(webhooks domain.WebhookRepository) Option {
+	return func(app *App) {
+		app.webhooks = webhooks
+	}
+}
+
+// createWebhook subscribes a url to the market events, the secret is only returned here
+func (app *App) createWebhook(ctx echo.Context) error {
+	if app.webhooks == nil {
+		return ctx.JSON(http.StatusNotImplemented, ErrorResponse{Description: "webhooks are not available"})
+	}
+
+	req := createWebhookRequest{}
+	if err := bind(ctx, &req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: err.Error()})
+	}
+
+	hook := domain.Webhook{URL: req.URL, EventTypes: req.EventTypes, Secret: req.Secret}
+	if err := hook.Validate(); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: err.Error()})
+	}
+
+	if hook.Secret == "" {
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			app.logFailure(ctx, http.StatusInternalServerError, "Generate webhook secret failed", err)
+			return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Description: err.Error()})
+		}
+		hook.Secret = secret
+	}
+
+	hook, err := app.webhooks.CreateWebhook(ctx.Request().Context(), hook)
+	if err != nil {
+		app.logFailure(ctx, http.StatusInternalServerError, "Create webhook failed", err)
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Description: err.Error()})
+	}
+
+	return ctx.JSON(http.StatusCreated, hook)
+}
+
+// getWebhookDeliveries is the log of the last deliveries of a webhook, the newest first
+func (app *App) getWebhookDeliveries(ctx echo.Context) error {
+	if app.webhooks == nil {
+		return ctx.JSON(http.StatusNotImplemented, ErrorResponse{Description: "webhooks are not available"})
+	}
+
+	webhookID, err := strconv.Atoi(ctx.Param("webhook_id"))
+	if err != nil || webhookID <= 0 {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: domain.ErrInvalidWebhookID})
+	}
+
+	req := getWebhookDeliveriesRequest{}
+	if err := bind(ctx, &req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: err.Error()})
+	}
+
+	if req.Limit == 0 {
+		req.Limit = defaultDeliveriesInPage
+	}
+	if req.Limit < 0 || req.Limit > maxDeliveriesInPage {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{
+			Description: fmt.Sprintf("limit must be between 1 and %d", maxDeliveriesInPage),
+		})
+	}
+
+	deliveries, err := app.webhooks.WebhookDeliveries(ctx.Request().Context(), webhookID, req.Limit)
+	if err != nil {
+		app.logFailure(ctx, errorStatus(err), "Get webhook deliveries failed", err, zap.Int("webhook_id", webhookID))
+		return ctx.JSON(errorStatus(err), errorResponse(err))
+	}
+
+	return ctx.JSON(http.StatusOK, deliveries)
+}
+
+// redeliverWebhook sends a delivery again, a dead one too
+func (app *App) redeliverWebhook(ctx echo.Context) error {
+	if app.webhooks == nil {
+		return ctx.JSON(http.StatusNotImplemented, ErrorResponse{Description: "webhooks are not available"})
+	}
+
+	webhookID, err := strconv.Atoi(ctx.Param("webhook_id"))
+	if err != nil || webhookID <= 0 {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: domain.ErrInvalidWebhookID})
+	}
+
+	deliveryID, err := strconv.ParseInt(ctx.Param("delivery_id"), 10, 64)
+	if err != nil || deliveryID <= 0 {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Description: domain.ErrInvalidDeliveryID})
+	}
+
+	delivery, err := app.webhooks.RedeliverWebhook(ctx.Request().Context(), webhookID, deliveryID)
+	if err != nil {
+		app.logFailure(ctx, errorStatus(err), "Redeliver webhook failed", err,
+			zap.Int("webhook_id", webhookID), zap.Int64("delivery_id", deliveryID))
+		return ctx.JSON(errorStatus(err), errorResponse(err))
+	}
+
+	return ctx.JSON(http.StatusAccepted, delivery)
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// defaults of the invalidator
+const (
+	DefaultQueueSize         = 1024
+	DefaultInvalidateTimeout = time.Second
+)
+
+type (
+	// Invalidator invalidates the cache for the changes of the other instances in its own goroutine,
+	// so the notifications are not held up by the store. when its queue is full the invalidations
+	// are dropped and the cache is flushed instead
+	Invalidator struct {
+		cache   *Repository
+		queue   chan invalidation
+		timeout time.Duration
+		// overflow is 1 when an invalidation is dropped
+		overflow int32
+	}
+
+	invalidation struct {
+		wagerIDs []int
+		placed   bool
+		flush    bool
+	}
+)
+
+// NewInvalidator of the cache with a queue of size invalidations, an invalidation runs for timeout at most
+func NewInvalidator(cache *Repository, size int, timeout time.Duration) *Invalidator {
+	return &Invalidator{
+		cache:   cache,
+		queue:   make(chan invalidation, size),
+		timeout: timeout,
+	}
+}
+
+// Invalidate the entries of the wagers which are changed, it does not wait for them to be invalidated
+func (i *Invalidator) Invalidate(wagerIDs ...int) {
+	i.enqueue(invalidation{wagerIDs: wagerIDs})
+}
+
+// InvalidatePlaced invalidates the entries of the new wagers and the pages they belong in,
+// it does not wait for them to be invalidated
+func (i *Invalidator) InvalidatePlaced(wagerIDs ...int) {
+	i.enqueue(invalidation{wagerIDs: wagerIDs, placed: true})
+}
+
+// Flush every entry, it does not wait for them to be flushed
+func (i *Invalidator) Flush() {
+	i.enqueue(invalidation{flush: true})
+}
+
+// Run the invalidations until ctx is done
+func (i *Invalidator) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case inv := <-i.queue:
+			if atomic.CompareAndSwapInt32(&i.overflow, 1, 0) {
+				i.cache.logger.Warn("Cache invalidations are dropped, flush the cache")
+				inv = invalidation{flush: true}
+			}
+			i.run(ctx, inv)
+		}
+	}
+}
+
+func (i *Invalidator) enqueue(inv invalidation) {
+	select {
+	case i.queue <- inv:
+	default:
+		atomic.StoreInt32(&i.overflow, 1)
+	}
+}
+
+func (i *Invalidator) run(ctx context.Context, inv invalidation) {
+	ctx, cancel := context.WithTimeout(ctx, i.timeout)
+	defer cancel()
+
+	switch {
+	case inv.flush:
+		i.cache.Flush(ctx)
+	case inv.placed:
+		i.cache.InvalidatePlaced(ctx, inv.wagerIDs...)
+	default:
+		i.cache.Invalidate(ctx, inv.wagerIDs...)
+	}
+}
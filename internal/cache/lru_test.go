@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	c := NewLRU(2)
+	c.now = func() time.Time { return now }
+
+	require.NoError(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+	require.NoError(t, c.Set(ctx, "b", []byte("2"), time.Second))
+
+	// a is used last so b is evicted
+	_, ok, _ := c.Get(ctx, "a")
+	assert.True(t, ok)
+	require.NoError(t, c.Set(ctx, "c", []byte("3"), time.Minute))
+
+	_, ok, _ = c.Get(ctx, "b")
+	assert.False(t, ok)
+	value, ok, _ := c.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+	assert.Equal(t, 2, c.Len())
+
+	// an expired entry is dropped when it is read
+	now = now.Add(2 * time.Minute)
+	_, ok, _ = c.Get(ctx, "a")
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.Len())
+
+	require.NoError(t, c.Set(ctx, "x:1", []byte("1"), time.Minute))
+	require.NoError(t, c.Delete(ctx, "x:1", "missing"))
+	_, ok, _ = c.Get(ctx, "x:1")
+	assert.False(t, ok)
+
+	require.NoError(t, c.Set(ctx, "x:2", []byte("2"), time.Minute))
+	require.NoError(t, c.Set(ctx, "y:1", []byte("1"), time.Minute))
+	require.NoError(t, c.Flush(ctx, "x:"))
+	_, ok, _ = c.Get(ctx, "x:2")
+	assert.False(t, ok)
+	_, ok, _ = c.Get(ctx, "y:1")
+	assert.True(t, ok)
+}
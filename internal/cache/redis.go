@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// flushBatch is the number of keys scanned and deleted at once by Flush
+const flushBatch = 500
+
+// Redis is a store shared by the instances of the service
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to the redis server at url, redis://[:password@]host:port/db
+func NewRedis(url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Redis{client: redis.NewClient(opts)}, nil
+}
+
+// Get the value of key
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := r.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+// Set the value of key for ttl
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, key, value, ttl).Err()
+}
+
+// Delete the keys
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return r.client.Del(ctx, keys...).Err()
+}
+
+// Flush deletes the keys which start with prefix, they are scanned so the server is not blocked
+func (r *Redis) Flush(ctx context.Context, prefix string) error {
+	iter := r.client.Scan(ctx, 0, prefix+"*", flushBatch).Iterator()
+
+	keys := make([]string, 0, flushBatch)
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == flushBatch {
+			if err := r.Delete(ctx, keys...); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	return r.Delete(ctx, keys...)
+}
+
+// Ping the redis server
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// Close the connections to the redis server
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
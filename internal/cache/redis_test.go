@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedis(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := miniredis.Run()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	r, err := NewRedis("redis://" + srv.Addr() + "/0")
+	require.NoError(t, err)
+	defer r.Close()
+	require.NoError(t, r.Ping(ctx))
+
+	require.NoError(t, r.Set(ctx, "a", []byte("1"), time.Second))
+	value, ok, err := r.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+
+	srv.FastForward(2 * time.Second)
+	_, ok, err = r.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, r.Set(ctx, "b", []byte("2"), time.Minute))
+	require.NoError(t, r.Delete(ctx, "b", "missing"))
+	assert.False(t, srv.Exists("b"))
+
+	// more keys than a batch are flushed, the other keys are kept
+	for i := 0; i < flushBatch+10; i++ {
+		require.NoError(t, r.Set(ctx, "x:"+strconv.Itoa(i), []byte("1"), time.Minute))
+	}
+	require.NoError(t, r.Set(ctx, "y:1", []byte("1"), time.Minute))
+	require.NoError(t, r.Flush(ctx, "x:"))
+	assert.Equal(t, []string{"y:1"}, srv.Keys())
+
+	srv.SetError("down")
+	_, _, err = r.Get(ctx, "y:1")
+	assert.Error(t, err)
+}
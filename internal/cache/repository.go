@@ -0,0 +1,495 @@
+// Package cache keeps the wagers read from the repository, so the hot wagers are not read from the database every time
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"wager/internal/domain"
+	"wager/internal/logging"
+	"wager/internal/metrics"
+)
+
+const (
+	// DefaultTTL is how long an entry is kept, a change of another instance which is not notified is seen after it
+	DefaultTTL = 10 * time.Second
+	// DefaultLoadTimeout is how long a missing entry is loaded at most, whatever the reads waiting for it are
+	DefaultLoadTimeout = 5 * time.Second
+
+	// Prefix of the keys of the cache, the store may be shared with other keys
+	Prefix = "wager:cache:"
+
+	// maxIndexedPages is the number of pages indexed before the expired ones are dropped from the index
+	maxIndexedPages = 10000
+)
+
+type (
+	// Store keeps the entries of the cache, it is safe for concurrent use
+	Store interface {
+		// Get the value of key, ok is false when it is missing or expired
+		Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+		// Set the value of key for ttl
+		Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+		// Delete the keys
+		Delete(ctx context.Context, keys ...string) error
+		// Flush deletes the keys which start with prefix
+		Flush(ctx context.Context, prefix string) error
+	}
+
+	// Repository reads the wagers and the pages of wagers through the cache, a page only keeps
+	// the ids of its wagers so a purchase only invalidates its wager and a new wager only
+	// invalidates the pages it belongs in. the concurrent reads of a missing key are loaded once
+	Repository struct {
+		next        domain.WagerRepository
+		store       Store
+		ttl         time.Duration
+		loadTimeout time.Duration
+		logger      *zap.Logger
+		group       singleflight.Group
+
+		mu sync.Mutex
+		// wagerGen and pageGen change with every invalidation, a value loaded meanwhile may be stale so it is not kept
+		wagerGen uint64
+		pageGen  uint64
+		// pages are the spans of the pages cached by this instance
+		pages map[string]pageSpan
+	}
+
+	// Option configures the cache
+	Option func(r *Repository)
+
+	// page is a cached page, the wagers are cached on their own
+	page struct {
+		IDs  []int
+		Next int
+	}
+
+	// pageSpan are the ids a page can hold, a new wager belongs in it when its id is after the cursor and
+	// before the last wager of the page or the page is not full
+	pageSpan struct {
+		cursor    int
+		last      int
+		full      bool
+		expiresAt time.Time
+	}
+)
+
+// WithTTL keeps the entries for ttl
+func WithTTL(ttl time.Duration) Option {
+	return func(r *Repository) {
+		r.ttl = ttl
+	}
+}
+
+// WithLoadTimeout loads a missing entry for timeout at most, the load is shared by the concurrent reads
+// so it is not canceled with the read which started it
+func WithLoadTimeout(timeout time.Duration) Option {
+	return func(r *Repository) {
+		r.loadTimeout = timeout
+	}
+}
+
+// WithLogger logs the failures of the store, nothing is logged by default
+func WithLogger(logger *zap.Logger) Option {
+	return func(r *Repository) {
+		r.logger = logger
+	}
+}
+
+// NewRepository caches the reads of next in store
+func NewRepository(next domain.WagerRepository, store Store, opts ...Option) *Repository {
+	r := &Repository{
+		next:        next,
+		store:       store,
+		ttl:         DefaultTTL,
+		loadTimeout: DefaultLoadTimeout,
+		logger:      zap.NewNop(),
+		pages:       map[string]pageSpan{},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Create a wager, the pages it belongs in are invalidated
+func (r *Repository) Create(ctx context.Context, wager domain.Wager) (domain.Wager, error) {
+	res, err := r.next.Create(ctx, wager)
+	if err == nil {
+		r.InvalidatePlaced(ctx, res.ID)
+	}
+
+	return res, err
+}
+
+// CreateBatch creates the wagers at once, the pages they belong in are invalidated
+func (r *Repository) CreateBatch(ctx context.Context, wagers []domain.Wager) ([]domain.Wager, error) {
+	res, err := r.next.CreateBatch(ctx, wagers)
+	if err == nil {
+		ids := make([]int, 0, len(res))
+		for _, wager := range res {
+			ids = append(ids, wager.ID)
+		}
+		r.InvalidatePlaced(ctx, ids...)
+	}
+
+	return res, err
+}
+
+// Find a wager through the cache, a fresh read goes to the repository
+func (r *Repository) Find(ctx context.Context, wagerID int) (domain.Wager, error) {
+	if domain.FreshReadFromContext(ctx) {
+		return r.next.Find(ctx, wagerID)
+	}
+
+	key := wagerKey(wagerID)
+	if wager, ok := r.getWager(ctx, key); ok {
+		metrics.ObserveCache("wager", true)
+		return wager, nil
+	}
+	metrics.ObserveCache("wager", false)
+
+	v, err := r.load(ctx, key, func(ctx context.Context) (interface{}, error) {
+		gen := r.generation()
+
+		wager, err := r.next.Find(ctx, wagerID)
+		if err != nil {
+			return wager, err
+		}
+
+		r.setWagers(ctx, gen, wager)
+		return wager, nil
+	})
+	if err != nil {
+		return domain.Wager{}, err
+	}
+
+	return v.(domain.Wager), nil
+}
+
+// Get a page of wagers through the cache, a fresh read goes to the repository
+func (r *Repository) Get(ctx context.Context, wagerID, limit int) ([]domain.Wager, int, error) {
+	if domain.FreshReadFromContext(ctx) {
+		return r.next.Get(ctx, wagerID, limit)
+	}
+
+	key := pageKey(wagerID, limit)
+	if wagers, next, ok := r.getPage(ctx, key); ok {
+		metrics.ObserveCache("page", true)
+		return wagers, next, nil
+	}
+	metrics.ObserveCache("page", false)
+
+	v, err := r.load(ctx, key, func(ctx context.Context) (interface{}, error) {
+		gen := r.generation()
+
+		wagers, next, err := r.next.Get(ctx, wagerID, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		r.setWagers(ctx, gen, wagers...)
+		r.setPage(ctx, gen, key, wagerID, limit, wagers, next)
+		return loadedPage{wagers: wagers, next: next}, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	loaded := v.(loadedPage)
+	return loaded.wagers, loaded.next, nil
+}
+
+// Purchase a wager, its entry is invalidated even when the purchase fails since it may be committed
+func (r *Repository) Purchase(ctx context.Context, wagerID int, buyingPrice decimal.Decimal) (domain.Purchase, error) {
+	defer r.Invalidate(ctx, wagerID)
+
+	return r.next.Purchase(ctx, wagerID, buyingPrice)
+}
+
+// PurchaseBasket buys the wagers at once, their entries are invalidated
+func (r *Repository) PurchaseBasket(ctx context.Context, purchases []domain.Purchase) ([]domain.Purchase, error) {
+	ids := make([]int, 0, len(purchases))
+	for _, p := range purchases {
+		ids = append(ids, p.WagerID)
+	}
+	defer r.Invalidate(ctx, ids...)
+
+	return r.next.PurchaseBasket(ctx, purchases)
+}
+
+// Close the repository
+func (r *Repository) Close(ctx context.Context) error {
+	return r.next.Close(ctx)
+}
+
+// Invalidate the entries of the wagers which are changed
+func (r *Repository) Invalidate(ctx context.Context, wagerIDs ...int) {
+	if len(wagerIDs) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	r.wagerGen++
+	r.mu.Unlock()
+
+	keys := make([]string, 0, len(wagerIDs))
+	for _, id := range wagerIDs {
+		keys = append(keys, wagerKey(id))
+	}
+
+	if err := r.store.Delete(ctx, keys...); err != nil {
+		r.logger.Error("Invalidate cached wagers failed", zap.Ints("wager_ids", wagerIDs), logging.Error(err))
+	}
+}
+
+// InvalidatePlaced invalidates the entries of the new wagers and the pages they belong in
+func (r *Repository) InvalidatePlaced(ctx context.Context, wagerIDs ...int) {
+	if len(wagerIDs) == 0 {
+		return
+	}
+
+	now := time.Now()
+	var keys []string
+
+	r.mu.Lock()
+	r.pageGen++
+	for key, span := range r.pages {
+		if !now.Before(span.expiresAt) {
+			delete(r.pages, key)
+			continue
+		}
+
+		for _, id := range wagerIDs {
+			if id > span.cursor && (!span.full || id < span.last) {
+				keys = append(keys, key)
+				delete(r.pages, key)
+				break
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	r.Invalidate(ctx, wagerIDs...)
+
+	if len(keys) == 0 {
+		return
+	}
+
+	if err := r.store.Delete(ctx, keys...); err != nil {
+		r.logger.Error("Invalidate cached pages failed", zap.Ints("wager_ids", wagerIDs), logging.Error(err))
+	}
+}
+
+// Flush every entry, the changes of the wagers may have been missed
+func (r *Repository) Flush(ctx context.Context) {
+	r.mu.Lock()
+	r.wagerGen++
+	r.pageGen++
+	r.pages = map[string]pageSpan{}
+	r.mu.Unlock()
+
+	if err := r.store.Flush(ctx, Prefix); err != nil {
+		r.logger.Error("Flush cache failed", logging.Error(err))
+	}
+}
+
+type (
+	// loadedPage is a page loaded from the repository, it is shared by the concurrent reads
+	loadedPage struct {
+		wagers []domain.Wager
+		next   int
+	}
+
+	// generation of the invalidations
+	generation struct {
+		wager uint64
+		page  uint64
+	}
+)
+
+// load the entry of key once for the concurrent reads, the load keeps the values of ctx but not its
+// cancellation so a read which gives up does not fail the others
+func (r *Repository) load(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	res := r.group.DoChan(key, func() (interface{}, error) {
+		loadCtx, cancel := context.WithTimeout(detached{parent: ctx}, r.loadTimeout)
+		defer cancel()
+
+		return fn(loadCtx)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case loaded := <-res:
+		return loaded.Val, loaded.Err
+	}
+}
+
+// detached keeps the values of its parent, e.g. the request id and the span, without its deadline and cancellation
+type detached struct {
+	parent context.Context
+}
+
+func (d detached) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (d detached) Done() <-chan struct{}             { return nil }
+func (d detached) Err() error                        { return nil }
+func (d detached) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+func (r *Repository) generation() generation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return generation{wager: r.wagerGen, page: r.pageGen}
+}
+
+// getWager reads a cached wager, a failure of the store is a miss
+func (r *Repository) getWager(ctx context.Context, key string) (domain.Wager, bool) {
+	wager := domain.Wager{}
+
+	data, ok, err := r.store.Get(ctx, key)
+	if err != nil {
+		r.logger.Warn("Read cache failed", zap.String("key", key), logging.Error(err))
+		return wager, false
+	}
+	if !ok {
+		return wager, false
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&wager); err != nil {
+		r.logger.Warn("Decode cached wager failed", zap.String("key", key), logging.Error(err))
+		return wager, false
+	}
+
+	return wager, true
+}
+
+// getPage reads a cached page, it is a miss when one of its wagers is not cached anymore
+func (r *Repository) getPage(ctx context.Context, key string) ([]domain.Wager, int, bool) {
+	data, ok, err := r.store.Get(ctx, key)
+	if err != nil {
+		r.logger.Warn("Read cache failed", zap.String("key", key), logging.Error(err))
+		return nil, 0, false
+	}
+	if !ok {
+		return nil, 0, false
+	}
+
+	p := page{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&p); err != nil {
+		r.logger.Warn("Decode cached page failed", zap.String("key", key), logging.Error(err))
+		return nil, 0, false
+	}
+
+	if len(p.IDs) == 0 {
+		return nil, p.Next, true
+	}
+
+	wagers := make([]domain.Wager, 0, len(p.IDs))
+	for _, id := range p.IDs {
+		wager, ok := r.getWager(ctx, wagerKey(id))
+		if !ok {
+			return nil, 0, false
+		}
+		wagers = append(wagers, wager)
+	}
+
+	return wagers, p.Next, true
+}
+
+// setWagers caches the wagers unless a wager is invalidated since gen,
+// the wagers are deleted again when an invalidation runs meanwhile
+func (r *Repository) setWagers(ctx context.Context, gen generation, wagers ...domain.Wager) {
+	if r.generation().wager != gen.wager {
+		return
+	}
+	defer func() {
+		if r.generation().wager == gen.wager {
+			return
+		}
+
+		keys := make([]string, 0, len(wagers))
+		for _, wager := range wagers {
+			keys = append(keys, wagerKey(wager.ID))
+		}
+		if err := r.store.Delete(ctx, keys...); err != nil {
+			r.logger.Error("Invalidate cached wagers failed", logging.Error(err))
+		}
+	}()
+
+	for _, wager := range wagers {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(wager); err != nil {
+			r.logger.Warn("Encode wager failed", zap.Int("wager_id", wager.ID), logging.Error(err))
+			return
+		}
+
+		if err := r.store.Set(ctx, wagerKey(wager.ID), buf.Bytes(), r.ttl); err != nil {
+			r.logger.Warn("Write cache failed", zap.Int("wager_id", wager.ID), logging.Error(err))
+			return
+		}
+	}
+}
+
+// setPage caches the ids of the page and indexes its span unless a page is invalidated since gen,
+// the page is deleted again when an invalidation runs meanwhile
+func (r *Repository) setPage(ctx context.Context, gen generation, key string, cursor, limit int,
+	wagers []domain.Wager, next int) {
+	p := page{IDs: make([]int, 0, len(wagers)), Next: next}
+	for _, wager := range wagers {
+		p.IDs = append(p.IDs, wager.ID)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(p); err != nil {
+		r.logger.Warn("Encode page failed", zap.String("key", key), logging.Error(err))
+		return
+	}
+
+	// the span is indexed before the page is written, so an invalidation from now on deletes it
+	r.mu.Lock()
+	if r.pageGen != gen.page {
+		r.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	if len(r.pages) >= maxIndexedPages {
+		for k, span := range r.pages {
+			if !now.Before(span.expiresAt) {
+				delete(r.pages, k)
+			}
+		}
+	}
+	r.pages[key] = pageSpan{cursor: cursor, last: next, full: len(wagers) == limit, expiresAt: now.Add(r.ttl)}
+	r.mu.Unlock()
+
+	if err := r.store.Set(ctx, key, buf.Bytes(), r.ttl); err != nil {
+		r.logger.Warn("Write cache failed", zap.String("key", key), logging.Error(err))
+		return
+	}
+
+	if r.generation().page != gen.page {
+		if err := r.store.Delete(ctx, key); err != nil {
+			r.logger.Error("Invalidate cached page failed", zap.String("key", key), logging.Error(err))
+		}
+	}
+}
+
+func wagerKey(wagerID int) string {
+	return Prefix + "wager:" + strconv.Itoa(wagerID)
+}
+
+func pageKey(wagerID, limit int) string {
+	return fmt.Sprintf("%spage:%d:%d", Prefix, wagerID, limit)
+}
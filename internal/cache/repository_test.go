@@ -0,0 +1,259 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"wager/internal/domain"
+	"wager/internal/domain/mocks"
+)
+
+func wager(id int) domain.Wager {
+	return domain.Wager{
+		ID:                  id,
+		TotalWagerValue:     100,
+		Odds:                2,
+		SellingPercentage:   50,
+		SellingPrice:        decimal.NewFromInt(60),
+		CurrentSellingPrice: decimal.NewFromInt(60),
+		PlacedAt:            time.Now().UTC().Truncate(time.Second),
+		Status:              "open",
+		Version:             id,
+	}
+}
+
+func TestFind(t *testing.T) {
+	ctx := context.Background()
+	next := &mocks.WagerRepository{}
+	r := NewRepository(next, NewLRU(0))
+
+	next.On("Find", mock.Anything, 1).Return(wager(1), nil).Once()
+
+	for i := 0; i < 3; i++ {
+		res, err := r.Find(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, wager(1), res)
+	}
+
+	// a fresh read and a read after a purchase go to the repository
+	next.On("Find", mock.Anything, 1).Return(wager(1), nil).Twice()
+	_, err := r.Find(domain.WithFreshRead(ctx), 1)
+	require.NoError(t, err)
+
+	next.On("Purchase", mock.Anything, 1, decimal.NewFromInt(1)).Return(domain.Purchase{}, nil).Once()
+	_, err = r.Purchase(ctx, 1, decimal.NewFromInt(1))
+	require.NoError(t, err)
+	_, err = r.Find(ctx, 1)
+	require.NoError(t, err)
+
+	// a missing wager is not cached
+	next.On("Find", mock.Anything, 2).Return(domain.Wager{}, domain.ErrWagerNotFound).Twice()
+	for i := 0; i < 2; i++ {
+		_, err = r.Find(ctx, 2)
+		assert.Equal(t, domain.ErrWagerNotFound, err)
+	}
+
+	next.AssertExpectations(t)
+}
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+	next := &mocks.WagerRepository{}
+	r := NewRepository(next, NewLRU(0))
+
+	full := []domain.Wager{wager(1), wager(2)}
+	tail := []domain.Wager{wager(4)}
+	next.On("Get", mock.Anything, 0, 2).Return(full, 2, nil).Once()
+	next.On("Get", mock.Anything, 2, 2).Return(tail, 4, nil).Once()
+
+	get := func(cursor int) []domain.Wager {
+		wagers, _, err := r.Get(ctx, cursor, 2)
+		require.NoError(t, err)
+		return wagers
+	}
+
+	assert.Equal(t, full, get(0))
+	assert.Equal(t, tail, get(2))
+	assert.Equal(t, full, get(0))
+	assert.Equal(t, tail, get(2))
+
+	// the wagers of a page are read from the cache too
+	res, err := r.Find(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, wager(2), res)
+
+	// a purchase keeps the page and reads its wager again
+	next.On("Purchase", mock.Anything, 1, decimal.NewFromInt(1)).Return(domain.Purchase{}, nil).Once()
+	_, err = r.Purchase(ctx, 1, decimal.NewFromInt(1))
+	require.NoError(t, err)
+
+	next.On("Get", mock.Anything, 0, 2).Return(full, 2, nil).Once()
+	assert.Equal(t, full, get(0))
+
+	// a new wager only invalidates the pages it belongs in, the tail page here
+	next.On("Create", mock.Anything, mock.Anything).Return(wager(5), nil).Once()
+	_, err = r.Create(ctx, domain.Wager{})
+	require.NoError(t, err)
+
+	tail = []domain.Wager{wager(4), wager(5)}
+	next.On("Get", mock.Anything, 2, 2).Return(tail, 5, nil).Once()
+	assert.Equal(t, full, get(0))
+	assert.Equal(t, tail, get(2))
+
+	// a wager which is committed late belongs in a full page before its last wager
+	next.On("CreateBatch", mock.Anything, mock.Anything).Return([]domain.Wager{wager(3)}, nil).Once()
+	_, err = r.CreateBatch(ctx, []domain.Wager{{}})
+	require.NoError(t, err)
+
+	next.On("Get", mock.Anything, 2, 2).Return([]domain.Wager{wager(3), wager(4)}, 4, nil).Once()
+	assert.Equal(t, full, get(0))
+	assert.Equal(t, []domain.Wager{wager(3), wager(4)}, get(2))
+
+	// everything is read again after a flush
+	r.Flush(ctx)
+	next.On("Get", mock.Anything, 0, 2).Return(full, 2, nil).Once()
+	assert.Equal(t, full, get(0))
+
+	next.AssertExpectations(t)
+}
+
+func TestSingleflight(t *testing.T) {
+	ctx := context.Background()
+	next := &mocks.WagerRepository{}
+	r := NewRepository(next, NewLRU(0))
+
+	var loads int32
+	release := make(chan struct{})
+	next.On("Find", mock.Anything, 1).Return(func(context.Context, int) domain.Wager {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return wager(1)
+	}, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			res, err := r.Find(ctx, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, res.ID)
+		}()
+	}
+
+	// the first read is loading when the others join it
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+}
+
+func TestInvalidateWhileLoading(t *testing.T) {
+	ctx := context.Background()
+	next := &mocks.WagerRepository{}
+	r := NewRepository(next, NewLRU(0))
+
+	// the wager is purchased after it is read from the database and before it is cached
+	next.On("Find", mock.Anything, 1).Return(func(context.Context, int) domain.Wager {
+		r.Invalidate(ctx, 1)
+		return wager(1)
+	}, nil).Once()
+	_, err := r.Find(ctx, 1)
+	require.NoError(t, err)
+
+	next.On("Find", mock.Anything, 1).Return(wager(1), nil).Once()
+	_, err = r.Find(ctx, 1)
+	require.NoError(t, err)
+
+	next.AssertExpectations(t)
+}
+
+func TestSingleflightCanceled(t *testing.T) {
+	next := &mocks.WagerRepository{}
+	r := NewRepository(next, NewLRU(0))
+
+	release := make(chan struct{})
+	next.On("Find", mock.Anything, 1).Return(func(ctx context.Context, _ int) domain.Wager {
+		<-release
+		return wager(1)
+	}, func(ctx context.Context, _ int) error {
+		return ctx.Err()
+	}).Once()
+
+	// the read which starts the load gives up, the read which joined it still gets the wager
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := r.Find(ctx, 1)
+		first <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	second := make(chan domain.Wager, 1)
+	go func() {
+		res, err := r.Find(context.Background(), 1)
+		assert.NoError(t, err)
+		second <- res
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-first)
+
+	close(release)
+	assert.Equal(t, wager(1), <-second)
+	next.AssertExpectations(t)
+}
+
+func TestInvalidator(t *testing.T) {
+	ctx := context.Background()
+	next := &mocks.WagerRepository{}
+	store := NewLRU(0)
+	r := NewRepository(next, store)
+	next.On("Find", mock.Anything, mock.Anything).Return(func(_ context.Context, id int) domain.Wager {
+		return wager(id)
+	}, nil)
+
+	cached := func(id int) bool {
+		_, ok, _ := store.Get(ctx, wagerKey(id))
+		return ok
+	}
+	for id := 1; id <= 3; id++ {
+		_, err := r.Find(ctx, id)
+		require.NoError(t, err)
+	}
+
+	// the invalidations are queued, the one which does not fit is dropped and the cache is flushed instead
+	inv := NewInvalidator(r, 1, time.Second)
+	inv.Invalidate(1)
+	inv.Invalidate(2)
+	assert.True(t, cached(1))
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		inv.Run(runCtx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	require.Eventually(t, func() bool { return !cached(1) && !cached(2) && !cached(3) }, time.Second, time.Millisecond)
+
+	_, err := r.Find(ctx, 3)
+	require.NoError(t, err)
+	inv.Invalidate(3)
+	require.Eventually(t, func() bool { return !cached(3) }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// buckets of StatsQuery
+const (
+	StatsBucketHour = "hour"
+	StatsBucketDay  = "day"
+	StatsBucketWeek = "week"
+)
+
+const (
+	maxStatsBuckets = 1000
+)
+
+const (
+	ErrInvalidStatsBucket = "bucket must be hour, day or week"
+	ErrInvalidStatsRange  = "from must be before to"
+	ErrTooManyStatsBucket = "the date range has too many buckets"
+)
+
+type (
+	// StatsQuery selects the date range and the bucket size of market statistics
+	StatsQuery struct {
+		From   time.Time `json:"from"`
+		To     time.Time `json:"to"`
+		Bucket string    `json:"bucket"`
+	}
+
+	// MarketStats is the aggregated market statistics of a bucket
+	// wagers are counted in the bucket they are placed, purchases in the bucket they are bought
+	MarketStats struct {
+		Bucket                 time.Time           `json:"bucket" db:"bucket"`
+		WagersPlaced           int                 `json:"wagers_placed" db:"wagers_placed"`
+		VolumePlaced           decimal.Decimal     `json:"volume_placed" db:"volume_placed"`
+		Purchases              int                 `json:"purchases" db:"purchases"`
+		VolumeSold             decimal.Decimal     `json:"volume_sold" db:"volume_sold"`
+		AverageDiscount        decimal.NullDecimal `json:"average_discount" db:"average_discount"`
+		SellThroughRate        decimal.NullDecimal `json:"sell_through_rate" db:"sell_through_rate"`
+		SecondsToFirstPurchase decimal.NullDecimal `json:"seconds_to_first_purchase" db:"seconds_to_first_purchase"`
+	}
+
+	// MarketTotals is the current state of the whole market
+	MarketTotals struct {
+		OpenWagers int             `json:"open_wagers" db:"open_wagers"`
+		VolumeSold decimal.Decimal `json:"volume_sold" db:"volume_sold"`
+	}
+)
+
+// Validate stats query
+func (q *StatsQuery) Validate(ctx context.Context) error {
+	var size time.Duration
+	switch q.Bucket {
+	case StatsBucketHour:
+		size = time.Hour
+	case StatsBucketDay:
+		size = 24 * time.Hour
+	case StatsBucketWeek:
+		size = 7 * 24 * time.Hour
+	default:
+		return errors.New(ErrInvalidStatsBucket)
+	}
+
+	if !q.From.Before(q.To) {
+		return errors.New(ErrInvalidStatsRange)
+	}
+
+	if q.To.Sub(q.From)/size > maxStatsBuckets {
+		return errors.New(ErrTooManyStatsBucket)
+	}
+
+	return nil
+}
+
+// AnalyticsRepository runs the aggregated read only queries
+// it is kept apart from WagerRepository so the analytics can be served by another database
+type AnalyticsRepository interface {
+	Stats(ctx context.Context, query StatsQuery) ([]MarketStats, error)
+	MarketTotals(ctx context.Context) (MarketTotals, error)
+}
@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// actions of AuditEvent
+const (
+	AuditActionPlaced    = "placed"
+	AuditActionPurchased = "purchased"
+)
+
+// AuditGenesisHash is the previous hash of the first event of a wager
+var AuditGenesisHash = strings.Repeat("0", sha256.Size*2)
+
+type (
+	// AuditEvent is an immutable record of a change of a wager
+	// the events of a wager are chained by hash, changing or removing one breaks the chain
+	AuditEvent struct {
+		ID      int64  `json:"id" db:"id"`
+		WagerID int    `json:"wager_id" db:"wager_id"`
+		Action  string `json:"action" db:"action"`
+		// Actor is the authenticated caller, ClaimedActor is who the caller says it acts for, it is not verified
+		Actor        string          `json:"actor" db:"actor"`
+		ClaimedActor string          `json:"claimed_actor,omitempty" db:"claimed_actor"`
+		RequestID    string          `json:"request_id" db:"request_id"`
+		Before       json.RawMessage `json:"before" db:"before"`
+		After        json.RawMessage `json:"after" db:"after"`
+		PrevHash     string          `json:"prev_hash" db:"prev_hash"`
+		Hash         string          `json:"hash" db:"hash"`
+		CreatedAt    time.Time       `json:"created_at" db:"created_at"`
+	}
+)
+
+// ComputeHash returns the hex sha256 of the event content chained to PrevHash
+func (e *AuditEvent) ComputeHash() string {
+	// a json array keeps the fields apart whatever they contain
+	fields := []interface{}{
+		e.PrevHash,
+		e.WagerID,
+		e.Action,
+		e.Actor,
+		e.RequestID,
+		string(e.Before),
+		string(e.After),
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+	// the events written before the claimed actor are hashed without it
+	if e.ClaimedActor != "" {
+		fields = append(fields, e.ClaimedActor)
+	}
+	content, _ := json.Marshal(fields)
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyAuditTrail checks the hash chain of the events of a wager in the order they are written
+// it returns the id of the first event which breaks the chain
+func VerifyAuditTrail(events []AuditEvent) (int64, error) {
+	prevHash := AuditGenesisHash
+	for _, e := range events {
+		if e.PrevHash != prevHash {
+			return e.ID, fmt.Errorf("audit event %d does not follow the previous event", e.ID)
+		}
+
+		if e.Hash != e.ComputeHash() {
+			return e.ID, fmt.Errorf("audit event %d does not match its hash", e.ID)
+		}
+
+		prevHash = e.Hash
+	}
+
+	return 0, nil
+}
+
+// AuditRepository reads the audit events
+// the events are written by WagerRepository in the same transaction as the change
+type AuditRepository interface {
+	AuditTrail(ctx context.Context, wagerID int) ([]AuditEvent, error)
+}
@@ -0,0 +1,65 @@
+package domain
+
+import "context"
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	claimedActorKey
+	requestIDKey
+	freshReadKey
+)
+
+const (
+	// AnonymousActor is the actor of the requests which are not authenticated
+	AnonymousActor = "anonymous"
+)
+
+// WithActor returns a context carrying who makes the change, the actor must be authenticated
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// ActorFromContext returns the actor of the context, AnonymousActor if there is none
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey).(string); ok && actor != "" {
+		return actor
+	}
+
+	return AnonymousActor
+}
+
+// WithClaimedActor returns a context carrying who the caller says makes the change, it is not verified
+func WithClaimedActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, claimedActorKey, actor)
+}
+
+// ClaimedActorFromContext returns the claimed actor of the context or an empty string
+func ClaimedActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(claimedActorKey).(string)
+	return actor
+}
+
+// WithRequestID returns a context carrying the id of the request which makes the change
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestIDFromContext returns the request id of the context or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// WithFreshRead returns a context whose reads must see the latest writes
+// a repository with read replicas serves them from the primary
+func WithFreshRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshReadKey, true)
+}
+
+// FreshReadFromContext reports whether the reads of the context must see the latest writes
+func FreshReadFromContext(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshReadKey).(bool)
+	return fresh
+}
@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"errors"
+	"sort"
+)
+
+// codes of the domain errors, the apis send them so their clients do not depend on the messages
+const (
+	ErrorCodeWagerNotFound           = "wager_not_found"
+	ErrorCodeBuyingPriceTooHigh      = "buying_price_too_high"
+	ErrorCodeWagerClosed             = "wager_closed"
+	ErrorCodeWebhookNotFound         = "webhook_not_found"
+	ErrorCodeWebhookDeliveryNotFound = "webhook_delivery_not_found"
+)
+
+// ErrorCode is the code of the domain error which err wraps, it is empty for the other errors
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrWagerNotFound):
+		return ErrorCodeWagerNotFound
+	case errors.Is(err, ErrBuyingPriceTooHigh):
+		return ErrorCodeBuyingPriceTooHigh
+	case errors.Is(err, ErrWagerClosed):
+		return ErrorCodeWagerClosed
+	case errors.Is(err, ErrWebhookNotFound):
+		return ErrorCodeWebhookNotFound
+	case errors.Is(err, ErrWebhookDeliveryNotFound):
+		return ErrorCodeWebhookDeliveryNotFound
+	default:
+		return ""
+	}
+}
+
+// ErrorKind tells how a request failed by a domain error, every api maps it to its own status
+type ErrorKind int
+
+// kinds of the domain errors
+const (
+	// ErrorKindInternal is an error which is not a domain error
+	ErrorKindInternal ErrorKind = iota
+	// ErrorKindNotFound is a request for something which does not exist
+	ErrorKindNotFound
+	// ErrorKindInvalid is a request which can not succeed as it is sent
+	ErrorKindInvalid
+	// ErrorKindConflict is a request which does not fit the state of the wager
+	ErrorKindConflict
+)
+
+// errorKinds of the error codes
+var errorKinds = map[string]ErrorKind{
+	ErrorCodeWagerNotFound:           ErrorKindNotFound,
+	ErrorCodeBuyingPriceTooHigh:      ErrorKindInvalid,
+	ErrorCodeWagerClosed:             ErrorKindConflict,
+	ErrorCodeWebhookNotFound:         ErrorKindNotFound,
+	ErrorCodeWebhookDeliveryNotFound: ErrorKindNotFound,
+}
+
+// ErrorCodes are the codes of every domain error, sorted
+func ErrorCodes() []string {
+	codes := make([]string, 0, len(errorKinds))
+	for code := range errorKinds {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	return codes
+}
+
+// ErrorKindOf is the kind of the domain error which err wraps, it is ErrorKindInternal for the other errors
+func ErrorKindOf(err error) ErrorKind {
+	return errorKinds[ErrorCode(err)]
+}
@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCode(t *testing.T) {
+	tcs := []struct {
+		err  error
+		code string
+		kind ErrorKind
+	}{
+		{err: fmt.Errorf("wager 1: %w", ErrWagerNotFound), code: ErrorCodeWagerNotFound, kind: ErrorKindNotFound},
+		{err: fmt.Errorf("wager 1: %w", ErrBuyingPriceTooHigh), code: ErrorCodeBuyingPriceTooHigh, kind: ErrorKindInvalid},
+		{err: fmt.Errorf("wager 1: %w", ErrWagerClosed), code: ErrorCodeWagerClosed, kind: ErrorKindConflict},
+		{err: ErrWebhookDeliveryNotFound, code: ErrorCodeWebhookDeliveryNotFound, kind: ErrorKindNotFound},
+		{err: errors.New(ErrWagerNotFound.Error()), kind: ErrorKindInternal},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.code, ErrorCode(tc.err), tc.err)
+		assert.Equal(t, tc.kind, ErrorKindOf(tc.err), tc.err)
+	}
+}
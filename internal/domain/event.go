@@ -0,0 +1,192 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// types of WagerEvent
+const (
+	WagerPlaced    = "placed"
+	WagerPurchased = "purchased"
+	WagerCancelled = "cancelled"
+	WagerSettled   = "settled"
+)
+
+// statuses of Wager
+const (
+	WagerStatusOpen      = "open"
+	WagerStatusCancelled = "cancelled"
+	WagerStatusSettled   = "settled"
+)
+
+var (
+	// ErrWagerClosed is returned when a wager which is cancelled or settled is bought
+	ErrWagerClosed = errors.New("wager is not open")
+)
+
+type (
+	// WagerEvent is a change of a wager, the events of a wager are the source of truth
+	// and the wager is the projection of its events applied in version order
+	WagerEvent struct {
+		ID         int64           `json:"id" db:"id"`
+		WagerID    int             `json:"wager_id" db:"wager_id"`
+		Version    int             `json:"version" db:"version"`
+		Type       string          `json:"type" db:"type"`
+		Data       json.RawMessage `json:"data" db:"data"`
+		OccurredAt time.Time       `json:"occurred_at" db:"occurred_at"`
+	}
+
+	// WagerSnapshot is a wager with its status, as it is kept in the events, the audit trail and the exports.
+	// the status is not in the json of a wager, so the responses of the http api are unchanged
+	WagerSnapshot struct {
+		Wager
+		Status string `json:"status"`
+	}
+
+	// WagerPlacedData is the data of a placed event, the wager as it is placed
+	WagerPlacedData = WagerSnapshot
+
+	// WagerPurchasedData is the data of a purchased event
+	WagerPurchasedData struct {
+		Purchase
+		// Imported tells that the purchase is counted in the sold state the wager is imported with,
+		// so it is not applied again
+		Imported bool `json:"imported,omitempty"`
+	}
+
+	// WagerClosedData is the data of a cancelled or settled event
+	WagerClosedData struct {
+		Reason string `json:"reason,omitempty"`
+	}
+
+	// WagerChange is a wager changed from Before to After by Event, Action is the action of its audit event
+	// and the market events tell the clients about it once it is committed
+	WagerChange struct {
+		Before       Wager
+		After        Wager
+		Event        WagerEvent
+		Action       string
+		MarketEvents []MarketEvent
+	}
+)
+
+// NewWagerEvent builds the next event of the wager
+func NewWagerEvent(wager Wager, eventType string, data interface{}) (WagerEvent, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return WagerEvent{}, err
+	}
+
+	return WagerEvent{
+		WagerID:    wager.ID,
+		Version:    wager.Version + 1,
+		Type:       eventType,
+		Data:       raw,
+		OccurredAt: time.Now().UTC(),
+	}, nil
+}
+
+// Snapshot of the wager with its status
+func (w *Wager) Snapshot() WagerSnapshot {
+	return WagerSnapshot{Wager: *w, Status: w.Status}
+}
+
+// Restore the wager of the snapshot
+func (s *WagerSnapshot) Restore() Wager {
+	w := s.Wager
+	w.Status = s.Status
+	return w
+}
+
+// CanBuy checks whether the wager can be bought at the buying price
+func (w *Wager) CanBuy(ctx context.Context, buyingPrice decimal.Decimal) error {
+	if w.Status != WagerStatusOpen {
+		return ErrWagerClosed
+	}
+
+	if buyingPrice.GreaterThan(w.CurrentSellingPrice) {
+		return ErrBuyingPriceTooHigh
+	}
+
+	return nil
+}
+
+// ValidateStatus checks the status is one of the statuses of a wager, an empty status is open
+func (w *Wager) ValidateStatus() error {
+	switch w.Status {
+	case "", WagerStatusOpen, WagerStatusCancelled, WagerStatusSettled:
+		return nil
+	default:
+		return fmt.Errorf("status %q %s", w.Status, ErrInvalidStatus)
+	}
+}
+
+// SoldOut tells whether every unit of the wager is sold
+func (w *Wager) SoldOut() bool {
+	return w.AmountSold != nil && w.TotalWagerValue > 0 && *w.AmountSold >= w.TotalWagerValue
+}
+
+// Apply the event to the wager, the events must be applied in version order
+// events are facts so Apply does not check the business rules, see CanBuy
+func (w *Wager) Apply(e WagerEvent) error {
+	if e.Version != w.Version+1 {
+		return fmt.Errorf("event %d of wager %d: version %d does not follow %d", e.ID, e.WagerID, e.Version, w.Version)
+	}
+
+	switch e.Type {
+	case WagerPlaced:
+		placed := WagerPlacedData{}
+		if err := json.Unmarshal(e.Data, &placed); err != nil {
+			return fmt.Errorf("event %d of wager %d: %w", e.ID, e.WagerID, err)
+		}
+
+		// an imported wager is placed with its sold state, a new one starts from its selling price
+		*w = placed.Restore()
+		if w.CurrentSellingPrice.IsZero() {
+			w.CurrentSellingPrice = w.SellingPrice
+		}
+		if w.Status == "" {
+			w.Status = WagerStatusOpen
+		}
+		w.ID = e.WagerID
+
+	case WagerPurchased:
+		purchase := WagerPurchasedData{}
+		if err := json.Unmarshal(e.Data, &purchase); err != nil {
+			return fmt.Errorf("event %d of wager %d: %w", e.ID, e.WagerID, err)
+		}
+
+		if purchase.Imported {
+			break
+		}
+
+		// the amount sold is set to 0 by the first purchase and counts the next ones, as it always has
+		var amountSold, percentageSold int
+		if w.AmountSold != nil {
+			amountSold = *w.AmountSold + 1
+		}
+		percentageSold = amountSold * 100 / w.TotalWagerValue
+
+		w.CurrentSellingPrice = purchase.BuyingPrice
+		w.AmountSold = &amountSold
+		w.PercentageSold = &percentageSold
+
+	case WagerCancelled:
+		w.Status = WagerStatusCancelled
+
+	case WagerSettled:
+		w.Status = WagerStatusSettled
+
+	default:
+		return fmt.Errorf("event %d of wager %d: unknown type %s", e.ID, e.WagerID, e.Type)
+	}
+
+	w.Version = e.Version
+	return nil
+}
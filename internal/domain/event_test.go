@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyPurchased(t *testing.T) {
+	sold := 5
+	imported := Wager{
+		ID:                  1,
+		TotalWagerValue:     10,
+		SellingPrice:        decimal.NewFromInt(10),
+		CurrentSellingPrice: decimal.NewFromInt(8),
+		AmountSold:          &sold,
+		PercentageSold:      &sold,
+		Status:              WagerStatusOpen,
+	}
+
+	wager := Wager{}
+	placed, err := NewWagerEvent(Wager{ID: 1}, WagerPlaced, imported.Snapshot())
+	require.NoError(t, err)
+	require.NoError(t, wager.Apply(placed))
+
+	// a purchase counted in the imported sold state only moves the version
+	purchase := Purchase{ID: 1, WagerID: 1, BuyingPrice: decimal.NewFromInt(8)}
+	event, err := NewWagerEvent(wager, WagerPurchased, WagerPurchasedData{Purchase: purchase, Imported: true})
+	require.NoError(t, err)
+	require.NoError(t, wager.Apply(event))
+	assert.Equal(t, 2, wager.Version)
+	assert.Equal(t, 5, *wager.AmountSold)
+	assert.True(t, wager.CurrentSellingPrice.Equal(decimal.NewFromInt(8)))
+
+	// a new purchase is applied on top of it
+	purchase = Purchase{ID: 2, WagerID: 1, BuyingPrice: decimal.NewFromInt(7)}
+	event, err = NewWagerEvent(wager, WagerPurchased, WagerPurchasedData{Purchase: purchase})
+	require.NoError(t, err)
+	require.NoError(t, wager.Apply(event))
+	assert.Equal(t, 3, wager.Version)
+	assert.Equal(t, 6, *wager.AmountSold)
+	assert.Equal(t, 60, *wager.PercentageSold)
+	assert.True(t, wager.CurrentSellingPrice.Equal(decimal.NewFromInt(7)))
+}
+
+func TestWagerSnapshot(t *testing.T) {
+	wager := Wager{ID: 1, TotalWagerValue: 10, Status: WagerStatusSettled}
+
+	// the status is not in the json of a wager
+	data, err := json.Marshal(wager)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "status")
+
+	data, err = json.Marshal(wager.Snapshot())
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"status":"settled"`)
+
+	snapshot := WagerSnapshot{}
+	require.NoError(t, json.Unmarshal(data, &snapshot))
+	restored := snapshot.Restore()
+	assert.Equal(t, 1, restored.ID)
+	assert.Equal(t, WagerStatusSettled, restored.Status)
+
+	// a settled wager is placed settled when it is imported
+	placed, err := NewWagerEvent(Wager{ID: 1}, WagerPlaced, wager.Snapshot())
+	require.NoError(t, err)
+	replayed := Wager{}
+	require.NoError(t, replayed.Apply(placed))
+	assert.Equal(t, WagerStatusSettled, replayed.Status)
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrIdempotencyKeyReused is returned when a key is sent again with another request
+	ErrIdempotencyKeyReused = errors.New("idempotency key is already used by another request")
+)
+
+type (
+	// IdempotencyKey is the key a caller sends to retry a write safely, the keys of two callers never meet
+	IdempotencyKey struct {
+		// Scope is the caller of the key
+		Scope string
+		Key   string
+		// RequestHash tells the requests of a key apart
+		RequestHash []byte
+	}
+
+	// IdempotentResponse is the response of the first request of a key, it is replayed for its retries
+	IdempotentResponse struct {
+		Status      int
+		ContentType string
+		Body        []byte
+	}
+
+	// IdempotentFunc serves the first request of a key, the writes made with ctx are committed with the response.
+	// keep is false for a response which must not be replayed, its writes are rolled back
+	IdempotentFunc func(ctx context.Context) (res IdempotentResponse, keep bool, err error)
+)
+
+// IdempotencyRepository keeps the responses of the idempotency keys
+type IdempotencyRepository interface {
+	// Idempotent serves the first request of the key with fn and keeps its response, a retry of the key gets
+	// the kept response with replayed set and fn is not called. a retry which comes while the first request
+	// is in flight waits for it and a key sent with another request fails with ErrIdempotencyKeyReused
+	Idempotent(ctx context.Context, key IdempotencyKey, fn IdempotentFunc) (res IdempotentResponse, replayed bool, err error)
+}
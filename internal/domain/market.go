@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// types of MarketEvent
+const (
+	MarketWagerPlaced    = "wager_placed"
+	MarketWagerPurchased = "wager_purchased"
+	MarketPriceChanged   = "price_changed"
+	MarketSoldOut        = "sold_out"
+)
+
+// MarketEventTypes are all the types of MarketEvent
+var MarketEventTypes = []string{MarketWagerPlaced, MarketWagerPurchased, MarketPriceChanged, MarketSoldOut}
+
+type (
+	// MarketEvent tells the clients about a committed change of the market
+	// the id is given by the publisher
+	MarketEvent struct {
+		ID         string    `json:"id"`
+		Type       string    `json:"type"`
+		WagerID    int       `json:"wager_id"`
+		Wager      Wager     `json:"wager"`
+		Purchase   *Purchase `json:"purchase,omitempty"`
+		OccurredAt time.Time `json:"occurred_at"`
+	}
+
+	// MarketPublisher delivers the market events relayed from the outbox
+	// an error makes the relay publish the events again later, so they are delivered at least once
+	MarketPublisher interface {
+		Publish(ctx context.Context, events ...MarketEvent) error
+	}
+
+	// OutboxMessage are the market events of a change of a wager, they are written in the transaction
+	// of the change and relayed once it is committed
+	OutboxMessage struct {
+		ID        int64
+		WagerID   int
+		Events    []MarketEvent
+		Attempts  int
+		CreatedAt time.Time
+	}
+
+	// OutboxAttempt is the outcome of an attempt to publish an outbox message
+	OutboxAttempt struct {
+		MessageID int64
+		// Error is empty when the message is published, it is removed then
+		Error string
+		// RetryAfter is when a failed message is tried again
+		RetryAfter time.Duration
+	}
+)
+
+// PlacedMarketEvents are the events of new wagers
+func PlacedMarketEvents(wagers ...Wager) []MarketEvent {
+	events := make([]MarketEvent, 0, len(wagers))
+	for _, wager := range wagers {
+		events = append(events, MarketEvent{
+			Type:       MarketWagerPlaced,
+			WagerID:    wager.ID,
+			Wager:      wager,
+			OccurredAt: wager.PlacedAt,
+		})
+	}
+
+	return events
+}
+
+// PurchasedMarketEvents are the events of a purchase which changed the wager from before to after
+func PurchasedMarketEvents(purchase Purchase, before, after Wager) []MarketEvent {
+	event := MarketEvent{
+		Type:       MarketWagerPurchased,
+		WagerID:    after.ID,
+		Wager:      after,
+		Purchase:   &purchase,
+		OccurredAt: purchase.BoughtAt,
+	}
+	events := []MarketEvent{event}
+
+	if !before.CurrentSellingPrice.Equal(after.CurrentSellingPrice) {
+		event.Type = MarketPriceChanged
+		event.Purchase = nil
+		events = append(events, event)
+	}
+
+	if !before.SoldOut() && after.SoldOut() {
+		event.Type = MarketSoldOut
+		event.Purchase = nil
+		events = append(events, event)
+	}
+
+	return events
+}
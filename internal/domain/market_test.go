@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// purchased applies a real purchase to the wager and returns its market events
+func purchased(t *testing.T, before Wager, price string) []MarketEvent {
+	purchase := Purchase{ID: 1, WagerID: before.ID, BuyingPrice: decimal.RequireFromString(price), BoughtAt: time.Now()}
+
+	event, err := NewWagerEvent(before, WagerPurchased, WagerPurchasedData{Purchase: purchase})
+	require.NoError(t, err)
+
+	after := before
+	require.NoError(t, after.Apply(event))
+
+	return PurchasedMarketEvents(purchase, before, after)
+}
+
+func eventTypes(events []MarketEvent) []string {
+	types := make([]string, 0, len(events))
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+
+	return types
+}
+
+func TestPurchasedMarketEvents(t *testing.T) {
+	sold := 3
+	wager := Wager{
+		ID:                  1,
+		TotalWagerValue:     4,
+		SellingPrice:        decimal.RequireFromString("10.00"),
+		CurrentSellingPrice: decimal.RequireFromString("10.00"),
+		AmountSold:          &sold,
+		Status:              WagerStatusOpen,
+		Version:             4,
+	}
+
+	tcs := []struct {
+		name  string
+		sold  int
+		price string
+		types []string
+	}{
+		{name: "same price", sold: 1, price: "10.00", types: []string{MarketWagerPurchased}},
+		{name: "price changed", sold: 1, price: "9.00", types: []string{MarketWagerPurchased, MarketPriceChanged}},
+		{name: "sold out", sold: 3, price: "10.00", types: []string{MarketWagerPurchased, MarketSoldOut}},
+		{name: "sold out at a new price", sold: 3, price: "9.00",
+			types: []string{MarketWagerPurchased, MarketPriceChanged, MarketSoldOut}},
+		{name: "already sold out", sold: 4, price: "10.00", types: []string{MarketWagerPurchased}},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			before := wager
+			sold := tc.sold
+			before.AmountSold = &sold
+
+			assert.Equal(t, tc.types, eventTypes(purchased(t, before, tc.price)))
+		})
+	}
+}
@@ -51,6 +51,50 @@ func (_m *WagerRepository) Create(ctx context.Context, wager domain.Wager) (doma
 	return r0, r1
 }
 
+// CreateBatch provides a mock function with given fields: ctx, wagers
+func (_m *WagerRepository) CreateBatch(ctx context.Context, wagers []domain.Wager) ([]domain.Wager, error) {
+	ret := _m.Called(ctx, wagers)
+
+	var r0 []domain.Wager
+	if rf, ok := ret.Get(0).(func(context.Context, []domain.Wager) []domain.Wager); ok {
+		r0 = rf(ctx, wagers)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.Wager)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []domain.Wager) error); ok {
+		r1 = rf(ctx, wagers)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Find provides a mock function with given fields: ctx, wagerID
+func (_m *WagerRepository) Find(ctx context.Context, wagerID int) (domain.Wager, error) {
+	ret := _m.Called(ctx, wagerID)
+
+	var r0 domain.Wager
+	if rf, ok := ret.Get(0).(func(context.Context, int) domain.Wager); ok {
+		r0 = rf(ctx, wagerID)
+	} else {
+		r0 = ret.Get(0).(domain.Wager)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, wagerID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Get provides a mock function with given fields: ctx, wagerID, limit
 func (_m *WagerRepository) Get(ctx context.Context, wagerID int, limit int) ([]domain.Wager, int, error) {
 	ret := _m.Called(ctx, wagerID, limit)
@@ -101,3 +145,26 @@ func (_m *WagerRepository) Purchase(ctx context.Context, wagerID int, buyingPric
 
 	return r0, r1
 }
+
+// PurchaseBasket provides a mock function with given fields: ctx, purchases
+func (_m *WagerRepository) PurchaseBasket(ctx context.Context, purchases []domain.Purchase) ([]domain.Purchase, error) {
+	ret := _m.Called(ctx, purchases)
+
+	var r0 []domain.Purchase
+	if rf, ok := ret.Get(0).(func(context.Context, []domain.Purchase) []domain.Purchase); ok {
+		r0 = rf(ctx, purchases)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.Purchase)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []domain.Purchase) error); ok {
+		r1 = rf(ctx, purchases)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
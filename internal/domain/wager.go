@@ -3,6 +3,7 @@ package domain
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -20,14 +21,21 @@ type (
 		PercentageSold      *int            `json:"percentage_sold" db:"percentage_sold"`
 		AmountSold          *int            `json:"amount_sold" db:"amount_sold"`
 		PlacedAt            time.Time       `json:"placed_at" db:"placed_at"`
+		Status              string          `json:"-" db:"status"`  // not in the http api, see WagerSnapshot
+		Version             int             `json:"-" db:"version"` // version of the latest event applied
 	}
 
 	// Purchase ...
 	Purchase struct {
-		ID          int             `json:"id"`
-		WagerID     int             `json:"wager_id" validate:"required"`
-		BuyingPrice decimal.Decimal `json:"buying_price" validate:"required"`
-		BoughtAt    time.Time       `json:"bought_at"`
+		ID          int             `json:"id" db:"id"`
+		WagerID     int             `json:"wager_id" db:"wager_id" validate:"required"`
+		BuyingPrice decimal.Decimal `json:"buying_price" db:"buying_price" validate:"required"`
+		BoughtAt    time.Time       `json:"bought_at" db:"bought_at"`
+	}
+
+	// Basket is a set of purchases, either all of them are bought or none
+	Basket struct {
+		Purchases []Purchase `json:"purchases"`
 	}
 )
 
@@ -37,11 +45,22 @@ const (
 
 const (
 	ErrInvalidWagerID           = "wager_id is required and must be greater than 0"
+	ErrWagerIDMismatch          = "wager_id of the body must be the one of the path"
 	ErrInvalidBuyingPrice       = "buying_price is required with scale 2 and must be greater than 0"
 	ErrInvalidTotalWagerValue   = "total_wager_value is required and must be greater than 0"
 	ErrInvalidOdds              = "odds is required and must be greater than 0"
 	ErrInvalidSellingPercentage = "selling_percentage is invalid"
 	ErrInvalidSellingPrice      = "selling_price is required with scale 2 and must be greater than total_wager_value * selling_percentage/100"
+	ErrEmptyBasket              = "purchases is required"
+	ErrDuplicateBasketWager     = "a wager can be bought only once in a basket"
+	ErrInvalidStatus            = "status must be open, cancelled or settled"
+)
+
+var (
+	// ErrWagerNotFound is returned when the wager does not exist
+	ErrWagerNotFound = errors.New("wager is not found")
+	// ErrBuyingPriceTooHigh is returned when buying_price is greater than current_selling_price
+	ErrBuyingPriceTooHigh = errors.New("buying_price must be less than current_selling_price")
 )
 
 // Validate wager
@@ -71,7 +90,7 @@ func (w *Wager) Validate(ctx context.Context) error {
 }
 
 // Validate purchase
-func (p *Purchase) Validate(cxt context.Context) error {
+func (p *Purchase) Validate(ctx context.Context) error {
 	if p.WagerID <= 0 {
 		return errors.New(ErrInvalidWagerID)
 	}
@@ -88,10 +107,50 @@ func (p *Purchase) Validate(cxt context.Context) error {
 	return nil
 }
 
+// Validate basket, every purchase must be valid and a wager is bought only once
+func (b *Basket) Validate(ctx context.Context) error {
+	if len(b.Purchases) == 0 {
+		return errors.New(ErrEmptyBasket)
+	}
+
+	seen := make(map[int]struct{}, len(b.Purchases))
+	for i := range b.Purchases {
+		if err := b.Purchases[i].Validate(ctx); err != nil {
+			return fmt.Errorf("purchases[%d]: %w", i, err)
+		}
+
+		if _, ok := seen[b.Purchases[i].WagerID]; ok {
+			return errors.New(ErrDuplicateBasketWager)
+		}
+		seen[b.Purchases[i].WagerID] = struct{}{}
+	}
+
+	return nil
+}
+
 // WagerRepository interface
 type WagerRepository interface {
 	Create(ctx context.Context, wager Wager) (Wager, error)
+	CreateBatch(ctx context.Context, wagers []Wager) ([]Wager, error)
+	Find(ctx context.Context, wagerID int) (Wager, error)
 	Get(ctx context.Context, wagerID, limit int) ([]Wager, int, error)
 	Purchase(ctx context.Context, wagerID int, buyingPrice decimal.Decimal) (Purchase, error)
+	PurchaseBasket(ctx context.Context, purchases []Purchase) ([]Purchase, error)
 	Close(ctx context.Context) error
 }
+
+// WagerTx changes the wagers in a unit of work, a wager is locked before it is changed
+type WagerTx interface {
+	// LockWager reads the wager and locks it until the unit of work ends
+	LockWager(ctx context.Context, wagerID int) (Wager, error)
+	// InsertPurchase records the purchase, it is returned with its id and time
+	InsertPurchase(ctx context.Context, purchase Purchase) (Purchase, error)
+	// SaveWager writes the change of a locked wager with its audit trail and its market events
+	SaveWager(ctx context.Context, change WagerChange) error
+}
+
+// WagerUnitOfWork runs fn in a unit of work, its changes are committed together when fn succeeds
+// and none of them is otherwise
+type WagerUnitOfWork interface {
+	InTx(ctx context.Context, fn func(ctx context.Context, tx WagerTx) error) error
+}
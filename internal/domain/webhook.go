@@ -0,0 +1,132 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+)
+
+// statuses of WebhookDelivery
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	// WebhookDeliveryDead is a delivery which failed too many times, it is only sent again by hand
+	WebhookDeliveryDead = "dead"
+)
+
+var (
+	// ErrWebhookNotFound is returned when the webhook does not exist
+	ErrWebhookNotFound = errors.New("webhook is not found")
+	// ErrWebhookDeliveryNotFound is returned when the delivery does not exist or is of another webhook
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery is not found")
+)
+
+// minWebhookSecret is the shortest secret a partner can choose
+const minWebhookSecret = 16
+
+// error messages of an invalid webhook
+const (
+	ErrInvalidWebhookURL       = "url must be an absolute http or https url"
+	ErrInvalidWebhookEventType = "event_types must be wager_placed, wager_purchased, price_changed or sold_out"
+	ErrInvalidWebhookSecret    = "secret must have at least 16 characters"
+	ErrInvalidWebhookID        = "webhook_id is required and must be greater than 0"
+	ErrInvalidDeliveryID       = "delivery_id is required and must be greater than 0"
+)
+
+type (
+	// Webhook is a subscription of a partner to the market events, the events are posted to its url
+	// signed with its secret. An empty EventTypes subscribes to every event
+	Webhook struct {
+		ID         int       `json:"id"`
+		URL        string    `json:"url"`
+		EventTypes []string  `json:"event_types"`
+		Secret     string    `json:"secret,omitempty"`
+		CreatedAt  time.Time `json:"created_at"`
+	}
+
+	// WebhookDelivery is a market event to be posted to a webhook, it is kept as the log of the delivery
+	WebhookDelivery struct {
+		ID        int64  `json:"id" db:"id"`
+		WebhookID int    `json:"webhook_id" db:"webhook_id"`
+		EventID   string `json:"event_id" db:"event_id"`
+		EventType string `json:"event_type" db:"event_type"`
+		WagerID   int    `json:"wager_id" db:"wager_id"`
+		// Payload is the body which is posted
+		Payload  json.RawMessage `json:"-" db:"payload"`
+		Status   string          `json:"status" db:"status"`
+		Attempts int             `json:"attempts" db:"attempts"`
+		// ResponseStatus and LastError are of the last attempt
+		ResponseStatus *int       `json:"response_status" db:"response_status"`
+		LastError      *string    `json:"last_error" db:"last_error"`
+		NextAttemptAt  time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+		CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+		DeliveredAt    *time.Time `json:"delivered_at" db:"delivered_at"`
+
+		// URL and Secret are of the webhook, they are only set on the deliveries to be sent
+		URL    string `json:"-" db:"-"`
+		Secret string `json:"-" db:"-"`
+	}
+
+	// WebhookAttempt is the outcome of an attempt to post a delivery
+	WebhookAttempt struct {
+		DeliveryID int64
+		// ResponseStatus is 0 when there is no response
+		ResponseStatus int
+		// Error is empty when the delivery is delivered
+		Error string
+		// RetryAfter is when the delivery is tried again, unless it is dead
+		RetryAfter time.Duration
+		Dead       bool
+	}
+
+	// WebhookRepository stores the webhooks and the log of their deliveries
+	WebhookRepository interface {
+		// CreateWebhook stores a new webhook, the events published from now on are delivered to it
+		CreateWebhook(ctx context.Context, webhook Webhook) (Webhook, error)
+		// WebhookDeliveries are the last deliveries of a webhook, the newest first
+		WebhookDeliveries(ctx context.Context, webhookID, limit int) ([]WebhookDelivery, error)
+		// RedeliverWebhook sends a delivery again as soon as possible, whatever its status is
+		RedeliverWebhook(ctx context.Context, webhookID int, deliveryID int64) (WebhookDelivery, error)
+	}
+)
+
+// Validate the webhook which is created
+func (w *Webhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New(ErrInvalidWebhookURL)
+	}
+
+	if w.Secret != "" && len(w.Secret) < minWebhookSecret {
+		return errors.New(ErrInvalidWebhookSecret)
+	}
+
+	for _, t := range w.EventTypes {
+		known := false
+		for _, eventType := range MarketEventTypes {
+			known = known || t == eventType
+		}
+		if !known {
+			return errors.New(ErrInvalidWebhookEventType)
+		}
+	}
+
+	return nil
+}
+
+// Match tells whether the event is delivered to the webhook
+func (w *Webhook) Match(event MarketEvent) bool {
+	if len(w.EventTypes) == 0 {
+		return true
+	}
+
+	for _, t := range w.EventTypes {
+		if t == event.Type {
+			return true
+		}
+	}
+
+	return false
+}
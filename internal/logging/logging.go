@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"wager/config"
+	"wager/internal/domain"
+)
+
+// classes of the errors
+const (
+	ClassNotFound     = "not_found"
+	ClassPriceTooHigh = "price_too_high"
+	ClassClosed       = "closed"
+	ClassCanceled     = "canceled"
+	ClassTimeout      = "timeout"
+	ClassDatabase     = "database"
+	ClassInternal     = "internal"
+)
+
+// New returns the logger of the configuration writing to stderr
+// the returned level changes the level of the logger while it is running
+func New(cfg config.Log) (*zap.Logger, zap.AtomicLevel, error) {
+	level := zap.NewAtomicLevel()
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, level, err
+	}
+
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoderConfig.EncodeDuration = zapcore.MillisDurationEncoder
+
+	var encoder zapcore.Encoder
+	if cfg.Format == config.LogFormatConsole {
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	} else {
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	}
+
+	core := zapcore.NewCore(encoder, zapcore.Lock(os.Stderr), level)
+	return zap.New(core, zap.AddCaller()), level, nil
+}
+
+// WithRequest adds the request id of ctx to the logger
+func WithRequest(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if id := domain.RequestIDFromContext(ctx); id != "" {
+		return logger.With(zap.String("request_id", id))
+	}
+
+	return logger
+}
+
+// Error is the field of an error, it carries the message and the class of the error
+func Error(err error) zap.Field {
+	if err == nil {
+		return zap.Skip()
+	}
+
+	return zap.Object("error", errorObject{err})
+}
+
+type errorObject struct {
+	err error
+}
+
+func (e errorObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("message", e.err.Error())
+	enc.AddString("class", ErrorClass(e.err))
+	return nil
+}
+
+// ErrorClass tells what kind of failure the error is
+func ErrorClass(err error) string {
+	switch domain.ErrorCode(err) {
+	case domain.ErrorCodeWagerNotFound:
+		return ClassNotFound
+	case domain.ErrorCodeBuyingPriceTooHigh:
+		return ClassPriceTooHigh
+	case domain.ErrorCodeWagerClosed:
+		return ClassClosed
+	}
+
+	var pqErr *pq.Error
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ClassCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ClassTimeout
+	case errors.As(err, &pqErr):
+		return ClassDatabase + "." + pqErr.Code.Class().Name()
+	default:
+		return ClassInternal
+	}
+}
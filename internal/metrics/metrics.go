@@ -0,0 +1,281 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"wager/internal/domain"
+)
+
+const (
+	namespace = "wager"
+
+	scrapeTimeout = 2 * time.Second
+)
+
+// outcomes of an attempt to deliver to a webhook
+const (
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+	WebhookDead      = "dead"
+)
+
+// outcomes of a purchase
+const (
+	PurchaseSuccess      = "success"
+	PurchasePriceTooHigh = "price_too_high"
+	PurchaseNotFound     = "not_found"
+	PurchaseClosed       = "closed"
+	PurchaseError        = "error"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of http requests by route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of http requests by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "repository_query_duration_seconds",
+		Help:      "Latency of the repository methods.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "success"})
+
+	purchases = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "purchases_total",
+		Help:      "Number of purchases by outcome.",
+	}, []string{"outcome"})
+
+	lockWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "purchase_lock_wait_seconds",
+		Help:      "Time a purchase waits for the row lock of its wagers.",
+		Buckets:   []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	})
+
+	outboxMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_messages_total",
+		Help:      "Number of outbox messages relayed by whether they are delivered.",
+	}, []string{"success"})
+
+	webhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Number of attempts to deliver to the webhooks by outcome.",
+	}, []string{"outcome"})
+
+	repositoryRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "repository_retries_total",
+		Help:      "Number of repository calls retried after a serialization failure or a deadlock by method.",
+	}, []string{"method"})
+
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Number of reads of the wager cache by kind and whether they are hits.",
+	}, []string{"kind", "hit"})
+)
+
+// Handler serves the metrics of the default registry
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware records the count and the latency of the http requests by route and status
+func Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		start := time.Now()
+		err := next(ctx)
+
+		status := ctx.Response().Status
+		if err != nil {
+			var httpErr *echo.HTTPError
+			if errors.As(err, &httpErr) {
+				status = httpErr.Code
+			} else {
+				status = http.StatusInternalServerError
+			}
+		}
+
+		// the route pattern keeps the cardinality low, unmatched requests share a label
+		route := ctx.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		labels := prometheus.Labels{
+			"method": ctx.Request().Method,
+			"route":  route,
+			"status": strconv.Itoa(status),
+		}
+		httpRequests.With(labels).Inc()
+		httpDuration.With(labels).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
+
+// ObserveQuery records the latency of a repository method
+func ObserveQuery(method string, start time.Time, err error) {
+	queryDuration.WithLabelValues(method, strconv.FormatBool(err == nil)).Observe(time.Since(start).Seconds())
+}
+
+// ObservePurchase counts a purchase by its outcome
+func ObservePurchase(err error) {
+	purchases.WithLabelValues(PurchaseOutcome(err)).Inc()
+}
+
+// ObserveLockWait records the time a purchase waits for its row locks
+func ObserveLockWait(d time.Duration) {
+	lockWait.Observe(d.Seconds())
+}
+
+// ObserveOutbox counts an outbox message relayed to the publisher
+func ObserveOutbox(err error) {
+	outboxMessages.WithLabelValues(strconv.FormatBool(err == nil)).Inc()
+}
+
+// ObserveWebhook counts an attempt to deliver to a webhook by its outcome
+func ObserveWebhook(outcome string) {
+	webhookDeliveries.WithLabelValues(outcome).Inc()
+}
+
+// ObserveRetry counts a retried repository call
+func ObserveRetry(method string) {
+	repositoryRetries.WithLabelValues(method).Inc()
+}
+
+// ObserveCache counts a read of the wager cache, kind is wager or page
+func ObserveCache(kind string, hit bool) {
+	cacheRequests.WithLabelValues(kind, strconv.FormatBool(hit)).Inc()
+}
+
+// PurchaseOutcome classifies the result of a purchase
+func PurchaseOutcome(err error) string {
+	if err == nil {
+		return PurchaseSuccess
+	}
+
+	switch domain.ErrorCode(err) {
+	case domain.ErrorCodeBuyingPriceTooHigh:
+		return PurchasePriceTooHigh
+	case domain.ErrorCodeWagerNotFound:
+		return PurchaseNotFound
+	case domain.ErrorCodeWagerClosed:
+		return PurchaseClosed
+	default:
+		return PurchaseError
+	}
+}
+
+// dbStatsCollector exposes the stats of a connection pool as gauges and counters
+type dbStatsCollector struct {
+	stats func() sql.DBStats
+
+	maxOpen, open, inUse, idle       *prometheus.Desc
+	waitCount, waitDuration          *prometheus.Desc
+	maxIdleClosed, maxLifetimeClosed *prometheus.Desc
+}
+
+// RegisterDBStats exposes the pool stats of the database named db
+func RegisterDBStats(db string, stats func() sql.DBStats) error {
+	labels := prometheus.Labels{"db": db}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", name), help, nil, labels)
+	}
+
+	return prometheus.Register(&dbStatsCollector{
+		stats:             stats,
+		maxOpen:           desc("max_open_connections", "Maximum number of open connections."),
+		open:              desc("open_connections", "Number of open connections."),
+		inUse:             desc("in_use_connections", "Number of connections in use."),
+		idle:              desc("idle_connections", "Number of idle connections."),
+		waitCount:         desc("wait_count_total", "Number of connections waited for."),
+		waitDuration:      desc("wait_duration_seconds_total", "Time blocked waiting for a connection."),
+		maxIdleClosed:     desc("max_idle_closed_total", "Connections closed by max_idle_conns."),
+		maxLifetimeClosed: desc("max_lifetime_closed_total", "Connections closed by conn_max_lifetime."),
+	})
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClosed
+	ch <- c.maxLifetimeClosed
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(s.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(s.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(s.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(s.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, s.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(s.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxLifetimeClosed, prometheus.CounterValue, float64(s.MaxLifetimeClosed))
+}
+
+// marketCollector queries the market totals on every scrape
+type marketCollector struct {
+	totals func(ctx context.Context) (domain.MarketTotals, error)
+
+	openWagers, volumeSold *prometheus.Desc
+}
+
+// RegisterMarket exposes the open wagers and the volume sold
+func RegisterMarket(analytics domain.AnalyticsRepository) error {
+	return prometheus.Register(&marketCollector{
+		totals: analytics.MarketTotals,
+		openWagers: prometheus.NewDesc(prometheus.BuildFQName(namespace, "market", "open_wagers"),
+			"Number of wagers which can still be bought.", nil, nil),
+		volumeSold: prometheus.NewDesc(prometheus.BuildFQName(namespace, "market", "volume_sold"),
+			"Sum of the buying prices of every purchase.", nil, nil),
+	})
+}
+
+func (c *marketCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.openWagers
+	ch <- c.volumeSold
+}
+
+func (c *marketCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	totals, err := c.totals(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.openWagers, err)
+		ch <- prometheus.NewInvalidMetric(c.volumeSold, err)
+		return
+	}
+
+	volumeSold, _ := totals.VolumeSold.Float64()
+	ch <- prometheus.MustNewConstMetric(c.openWagers, prometheus.GaugeValue, float64(totals.OpenWagers))
+	ch <- prometheus.MustNewConstMetric(c.volumeSold, prometheus.GaugeValue, volumeSold)
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"wager/internal/domain"
+)
+
+// Repository records the latency of every method of the wrapped repository
+// and the outcome of every purchase
+type Repository struct {
+	next domain.WagerRepository
+}
+
+// NewRepository wraps the wager repository with metrics
+func NewRepository(next domain.WagerRepository) *Repository {
+	return &Repository{next: next}
+}
+
+// Create a wager
+func (r *Repository) Create(ctx context.Context, wager domain.Wager) (domain.Wager, error) {
+	start := time.Now()
+	res, err := r.next.Create(ctx, wager)
+	ObserveQuery("create", start, err)
+
+	return res, err
+}
+
+// CreateBatch creates the wagers at once
+func (r *Repository) CreateBatch(ctx context.Context, wagers []domain.Wager) ([]domain.Wager, error) {
+	start := time.Now()
+	res, err := r.next.CreateBatch(ctx, wagers)
+	ObserveQuery("create_batch", start, err)
+
+	return res, err
+}
+
+// Find a wager
+func (r *Repository) Find(ctx context.Context, wagerID int) (domain.Wager, error) {
+	start := time.Now()
+	res, err := r.next.Find(ctx, wagerID)
+	ObserveQuery("find", start, err)
+
+	return res, err
+}
+
+// Get a page of wagers
+func (r *Repository) Get(ctx context.Context, wagerID, limit int) ([]domain.Wager, int, error) {
+	start := time.Now()
+	res, next, err := r.next.Get(ctx, wagerID, limit)
+	ObserveQuery("get", start, err)
+
+	return res, next, err
+}
+
+// Purchase a wager
+func (r *Repository) Purchase(ctx context.Context, wagerID int, buyingPrice decimal.Decimal) (domain.Purchase, error) {
+	start := time.Now()
+	res, err := r.next.Purchase(ctx, wagerID, buyingPrice)
+	ObserveQuery("purchase", start, err)
+	ObservePurchase(err)
+
+	return res, err
+}
+
+// PurchaseBasket buys the wagers at once, every purchase of a basket which is made counts
+func (r *Repository) PurchaseBasket(ctx context.Context, purchases []domain.Purchase) ([]domain.Purchase, error) {
+	start := time.Now()
+	res, err := r.next.PurchaseBasket(ctx, purchases)
+	ObserveQuery("purchase_basket", start, err)
+	// a basket which fails counts once, since none of its purchases is made
+	if err != nil {
+		ObservePurchase(err)
+	}
+	for range res {
+		ObservePurchase(nil)
+	}
+
+	return res, err
+}
+
+// Close the wrapped repository
+func (r *Repository) Close(ctx context.Context) error {
+	return r.next.Close(ctx)
+}
+
+// UnitOfWork records the time the units of work of the wrapped one wait for the locks of their wagers
+type UnitOfWork struct {
+	next domain.WagerUnitOfWork
+}
+
+// NewUnitOfWork wraps the unit of work with metrics
+func NewUnitOfWork(next domain.WagerUnitOfWork) *UnitOfWork {
+	return &UnitOfWork{next: next}
+}
+
+// InTx runs fn in a unit of work of the wrapped one
+func (u *UnitOfWork) InTx(ctx context.Context, fn func(ctx context.Context, tx domain.WagerTx) error) error {
+	return u.next.InTx(ctx, func(ctx context.Context, tx domain.WagerTx) error {
+		return fn(ctx, lockTimer{WagerTx: tx})
+	})
+}
+
+// lockTimer records the time a unit of work waits for the lock of a wager
+type lockTimer struct {
+	domain.WagerTx
+}
+
+func (t lockTimer) LockWager(ctx context.Context, wagerID int) (domain.Wager, error) {
+	start := time.Now()
+	res, err := t.WagerTx.LockWager(ctx, wagerID)
+	ObserveLockWait(time.Since(start))
+
+	return res, err
+}
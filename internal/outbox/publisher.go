@@ -0,0 +1,111 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"wager/internal/domain"
+)
+
+// natsFlushTimeout is how long the nats server has to acknowledge the published events
+const natsFlushTimeout = 5 * time.Second
+
+// Fanout publishes the events to every publisher in order, it stops at the first failure
+// and the events are published to all of them again, so the publishers which must not see
+// duplicates go first
+type Fanout []domain.MarketPublisher
+
+// Publish the events to every publisher
+func (f Fanout) Publish(ctx context.Context, events ...domain.MarketEvent) error {
+	for _, p := range f {
+		if err := p.Publish(ctx, events...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FilePublisher appends the events to a file as json lines
+type FilePublisher struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewFilePublisher appends to the file at path, it is created if it does not exist
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FilePublisher{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Publish writes the events and syncs the file, so they are not lost once it returns
+func (p *FilePublisher) Publish(ctx context.Context, events ...domain.MarketEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, event := range events {
+		if err := p.enc.Encode(event); err != nil {
+			return err
+		}
+	}
+
+	return p.file.Sync()
+}
+
+// Close the file
+func (p *FilePublisher) Close() error {
+	return p.file.Close()
+}
+
+// NATSPublisher publishes the events to nats, an event of wager 1 goes to the subject prefix.1
+// so a consumer can subscribe to prefix.> or to the wagers it follows
+type NATSPublisher struct {
+	conn   *nats.Conn
+	prefix string
+}
+
+// NewNATSPublisher connects to the nats server at url, it reconnects by itself
+func NewNATSPublisher(url, prefix string) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url, nats.Name("wager"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+
+	return &NATSPublisher{conn: conn, prefix: prefix}, nil
+}
+
+// Publish the events and wait until the server has them
+func (p *NATSPublisher) Publish(ctx context.Context, events ...domain.MarketEvent) error {
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		if err := p.conn.Publish(fmt.Sprintf("%s.%d", p.prefix, event.WagerID), data); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := ctx.Deadline(); ok {
+		return p.conn.FlushWithContext(ctx)
+	}
+
+	return p.conn.FlushTimeout(natsFlushTimeout)
+}
+
+// Close sends the pending events and closes the connection
+func (p *NATSPublisher) Close() error {
+	return p.conn.Drain()
+}
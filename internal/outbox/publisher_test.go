@@ -0,0 +1,101 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"wager/internal/domain"
+)
+
+func TestFanout(t *testing.T) {
+	first, second := &recorder{}, &recorder{}
+	events := []domain.MarketEvent{{ID: "1-1", WagerID: 1}}
+
+	require.NoError(t, Fanout{first, second}.Publish(context.Background(), events...))
+	assert.Equal(t, []string{"1-1"}, first.ids())
+	assert.Equal(t, []string{"1-1"}, second.ids())
+
+	// the publishers after a failed one are not called
+	first.err = errors.New("broker is down")
+	assert.Error(t, Fanout{first, second}.Publish(context.Background(), events...))
+	assert.Equal(t, []string{"1-1"}, second.ids())
+}
+
+func TestFilePublisher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.jsonl")
+
+	for _, id := range []string{"1-1", "2-1"} {
+		p, err := NewFilePublisher(path)
+		require.NoError(t, err)
+		require.NoError(t, p.Publish(context.Background(), domain.MarketEvent{ID: id, Type: domain.MarketWagerPlaced}))
+		require.NoError(t, p.Close())
+	}
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	// the file is appended to
+	ids := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event domain.MarketEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		ids = append(ids, event.ID)
+	}
+	assert.Equal(t, []string{"1-1", "2-1"}, ids)
+}
+
+func TestNATSPublisher(t *testing.T) {
+	opts := natstest.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	srv := natstest.RunServer(&opts)
+	defer srv.Shutdown()
+
+	sub, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer sub.Close()
+
+	msgs := make(chan *nats.Msg, 4)
+	_, err = sub.ChanSubscribe("wager.events.2", msgs)
+	require.NoError(t, err)
+	require.NoError(t, sub.Flush())
+
+	p, err := NewNATSPublisher(srv.ClientURL(), "wager.events")
+	require.NoError(t, err)
+	defer p.Close()
+
+	err = p.Publish(context.Background(),
+		domain.MarketEvent{ID: "1-1", WagerID: 1},
+		domain.MarketEvent{ID: "2-1", WagerID: 2},
+		domain.MarketEvent{ID: "2-2", WagerID: 2})
+	require.NoError(t, err)
+
+	for _, id := range []string{"2-1", "2-2"} {
+		select {
+		case msg := <-msgs:
+			var event domain.MarketEvent
+			require.NoError(t, json.Unmarshal(msg.Data, &event))
+			assert.Equal(t, id, event.ID)
+		case <-time.After(time.Second):
+			t.Fatalf("event %s is not received", id)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Package outbox relays the market events written to the outbox of the repository to a publisher
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wager/internal/domain"
+	"wager/internal/logging"
+	"wager/internal/metrics"
+)
+
+// defaults of the relay
+const (
+	DefaultInterval   = 100 * time.Millisecond
+	DefaultBatchSize  = 100
+	DefaultMaxBackoff = time.Minute
+	DefaultLease      = 30 * time.Second
+)
+
+type (
+	// Store is the outbox of the repository
+	Store interface {
+		// ClaimOutbox takes the oldest message of up to limit wagers for lease
+		ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]domain.OutboxMessage, error)
+		// RecordOutbox removes the published messages, the failed ones are tried again after their RetryAfter
+		RecordOutbox(ctx context.Context, attempts ...domain.OutboxAttempt) error
+	}
+
+	// Relay polls the outbox and publishes its messages, a message is removed only once it is published
+	// so the events are delivered at least once, in order for every wager
+	Relay struct {
+		store      Store
+		publisher  domain.MarketPublisher
+		logger     *zap.Logger
+		interval   time.Duration
+		batchSize  int
+		maxBackoff time.Duration
+		lease      time.Duration
+	}
+
+	// Option configures the relay
+	Option func(r *Relay)
+)
+
+// WithLogger logs the failed deliveries
+func WithLogger(logger *zap.Logger) Option {
+	return func(r *Relay) {
+		r.logger = logger
+	}
+}
+
+// WithInterval polls the outbox every interval when it is drained, a failed message
+// is tried again after interval and then twice as late every time up to maxBackoff
+func WithInterval(interval, maxBackoff time.Duration) Option {
+	return func(r *Relay) {
+		r.interval = interval
+		r.maxBackoff = maxBackoff
+	}
+}
+
+// WithLease claims the messages for lease, a batch which is not published by then is canceled
+// and its messages may be taken by another relay
+func WithLease(lease time.Duration) Option {
+	return func(r *Relay) {
+		r.lease = lease
+	}
+}
+
+// WithBatchSize relays up to n messages at once
+func WithBatchSize(n int) Option {
+	return func(r *Relay) {
+		r.batchSize = n
+	}
+}
+
+// NewRelay publishes the messages of the store to publisher
+func NewRelay(store Store, publisher domain.MarketPublisher, opts ...Option) *Relay {
+	r := &Relay{
+		store:      store,
+		publisher:  publisher,
+		logger:     zap.NewNop(),
+		interval:   DefaultInterval,
+		batchSize:  DefaultBatchSize,
+		maxBackoff: DefaultMaxBackoff,
+		lease:      DefaultLease,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Run relays the outbox until ctx is done, a full batch is followed by the next one at once
+func (r *Relay) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		delivered, err := r.RelayOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Error("Relay outbox failed", logging.Error(err))
+		}
+
+		if err == nil && delivered == r.batchSize {
+			timer.Reset(0)
+		} else {
+			timer.Reset(r.interval)
+		}
+	}
+}
+
+// RelayOnce relays a batch of the outbox and returns the number of delivered messages.
+// the batch is claimed, published and recorded in turn so no transaction is open while it is published
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	messages, err := r.store.ClaimOutbox(ctx, r.batchSize, r.lease)
+	if err != nil || len(messages) == 0 {
+		return 0, err
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, r.lease)
+	defer cancel()
+
+	delivered := 0
+	attempts := make([]domain.OutboxAttempt, 0, len(messages))
+	for _, msg := range messages {
+		attempt := domain.OutboxAttempt{MessageID: msg.ID}
+
+		err := r.deliver(publishCtx, msg)
+		metrics.ObserveOutbox(err)
+		if err != nil {
+			attempt.Error = err.Error()
+			attempt.RetryAfter = r.backoff(msg.Attempts + 1)
+			r.logger.Warn("Deliver outbox message failed, retry", zap.Int64("outbox_id", msg.ID),
+				zap.Int("wager_id", msg.WagerID), zap.Int("attempts", msg.Attempts+1), logging.Error(err))
+		} else {
+			delivered++
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	if err := r.store.RecordOutbox(ctx, attempts...); err != nil {
+		return 0, err
+	}
+
+	return delivered, nil
+}
+
+// deliver publishes the events of a message, they are given ids of the message
+// so the consumers can drop the ones which are delivered again
+func (r *Relay) deliver(ctx context.Context, msg domain.OutboxMessage) error {
+	events := make([]domain.MarketEvent, len(msg.Events))
+	for i, event := range msg.Events {
+		event.ID = fmt.Sprintf("%d-%d", msg.ID, i+1)
+		events[i] = event
+	}
+
+	return r.publisher.Publish(ctx, events...)
+}
+
+// backoff doubles the interval with every failed attempt up to maxBackoff
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.interval
+	for i := 1; i < attempts && d < r.maxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > r.maxBackoff {
+		d = r.maxBackoff
+	}
+
+	return d
+}
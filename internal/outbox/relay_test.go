@@ -0,0 +1,169 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"wager/internal/domain"
+	"wager/internal/testutil/memory"
+)
+
+// recorder is a publisher which records the events, it fails while err is set
+type recorder struct {
+	mu     sync.Mutex
+	events []domain.MarketEvent
+	err    error
+}
+
+func (r *recorder) Publish(ctx context.Context, events ...domain.MarketEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	r.events = append(r.events, events...)
+
+	return nil
+}
+
+func (r *recorder) ids() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := []string{}
+	for _, e := range r.events {
+		ids = append(ids, e.ID)
+	}
+
+	return ids
+}
+
+func message(id int64, wagerID int, types ...string) domain.OutboxMessage {
+	msg := domain.OutboxMessage{ID: id, WagerID: wagerID}
+	for _, t := range types {
+		msg.Events = append(msg.Events, domain.MarketEvent{Type: t, WagerID: wagerID})
+	}
+
+	return msg
+}
+
+func TestRelayOnce(t *testing.T) {
+	store := memory.New(memory.WithOutbox(
+		message(1, 1, domain.MarketWagerPlaced),
+		message(2, 2, domain.MarketWagerPlaced),
+		message(3, 1, domain.MarketWagerPurchased, domain.MarketPriceChanged),
+	))
+	pub := &recorder{err: errors.New("broker is down")}
+	relay := NewRelay(store, pub, WithInterval(time.Second, 3*time.Second))
+
+	// a failed message is kept and blocks the later messages of its wager
+	delivered, err := relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, delivered)
+	assert.Len(t, store.Outbox(), 3)
+	assert.Equal(t, map[int64]time.Duration{1: time.Second, 2: time.Second}, store.RetryAfter())
+
+	pub.err = nil
+	delivered, err = relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, delivered)
+
+	delivered, err = relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Empty(t, store.Outbox())
+
+	// the events are in order for every wager and have the ids of their message
+	assert.Equal(t, []string{"1-1", "2-1", "3-1", "3-2"}, pub.ids())
+}
+
+func TestRelayBackoff(t *testing.T) {
+	relay := NewRelay(memory.New(), &recorder{}, WithInterval(100*time.Millisecond, time.Second))
+
+	tcs := []struct {
+		attempts int
+		backoff  time.Duration
+	}{
+		{attempts: 1, backoff: 100 * time.Millisecond},
+		{attempts: 2, backoff: 200 * time.Millisecond},
+		{attempts: 4, backoff: 800 * time.Millisecond},
+		{attempts: 5, backoff: time.Second},
+		{attempts: 100, backoff: time.Second},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.backoff, relay.backoff(tc.attempts), tc.attempts)
+	}
+}
+
+func TestRelayRun(t *testing.T) {
+	store := memory.New()
+	for i := 1; i <= 5; i++ {
+		store.AddOutbox(message(int64(i), i, domain.MarketWagerPlaced))
+	}
+	pub := &recorder{}
+
+	// the batches which are full are relayed one after another without waiting for the interval
+	relay := NewRelay(store, pub, WithBatchSize(2), WithInterval(time.Hour, time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		relay.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool { return len(store.Outbox()) == 0 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Len(t, pub.ids(), 5)
+}
+
+// lockingStore fails the relay when the store is used while a message is published
+type lockingStore struct {
+	*memory.Repository
+	publishing bool
+}
+
+func (s *lockingStore) RecordOutbox(ctx context.Context, attempts ...domain.OutboxAttempt) error {
+	if s.publishing {
+		return errors.New("the outbox is used while the messages are published")
+	}
+
+	return s.Repository.RecordOutbox(ctx, attempts...)
+}
+
+type publishFunc func(ctx context.Context, events ...domain.MarketEvent) error
+
+func (f publishFunc) Publish(ctx context.Context, events ...domain.MarketEvent) error {
+	return f(ctx, events...)
+}
+
+func TestRelayClaim(t *testing.T) {
+	store := &lockingStore{Repository: memory.New(memory.WithOutbox(message(1, 1, domain.MarketWagerPlaced)))}
+
+	// the message is claimed before it is published, another relay does not take it meanwhile
+	var claimed []domain.OutboxMessage
+	pub := publishFunc(func(ctx context.Context, events ...domain.MarketEvent) error {
+		store.publishing = true
+		defer func() { store.publishing = false }()
+
+		var err error
+		claimed, err = store.ClaimOutbox(ctx, 10, time.Minute)
+		return err
+	})
+
+	delivered, err := NewRelay(store, pub).RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Empty(t, claimed)
+	assert.Empty(t, store.Outbox())
+}
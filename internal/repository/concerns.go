@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wager/internal/domain"
+	"wager/internal/logging"
+	"wager/internal/metrics"
+	"wager/internal/tracing"
+)
+
+// Metrics records the latency of every method and the outcome of every purchase
+func Metrics() Middleware {
+	return func(next domain.WagerRepository) domain.WagerRepository {
+		return metrics.NewRepository(next)
+	}
+}
+
+// Tracing starts a span of every method, the spans of the statements are its children
+func Tracing() Middleware {
+	return Wrap(func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		ctx, span := tracing.Start(ctx, "repository."+method)
+		err := call(ctx)
+		tracing.End(ctx, span, err)
+
+		return err
+	})
+}
+
+// Logging logs every call at debug level and the calls which take longer than slow as warnings
+func Logging(logger *zap.Logger, slow time.Duration) Middleware {
+	return Wrap(func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		start := time.Now()
+		err := call(ctx)
+		elapsed := time.Since(start)
+
+		log := logging.WithRequest(ctx, logger).Debug
+		if elapsed >= slow {
+			log = logging.WithRequest(ctx, logger).Warn
+		}
+		log("Repository call", zap.String("method", method), zap.Duration("elapsed", elapsed), logging.Error(err))
+
+		return err
+	})
+}
+
+// Retry calls a method up to attempts times while it fails with an error which is retryable.
+// the wait before the second attempt is about backoff and it doubles with every attempt
+func Retry(attempts int, backoff time.Duration, retryable func(error) bool) Middleware {
+	return Wrap(func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		wait := backoff
+		for attempt := 1; ; attempt++ {
+			err := call(ctx)
+			if err == nil || attempt >= attempts || !retryable(err) {
+				return err
+			}
+			metrics.ObserveRetry(method)
+
+			// the jitter keeps the transactions which conflicted from conflicting again
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))):
+			}
+			wait *= 2
+		}
+	})
+}
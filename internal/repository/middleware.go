@@ -0,0 +1,117 @@
+// Package repository wraps the wager repository with the cross cutting concerns, so they are not written
+// in every method of the repository
+package repository
+
+import (
+	"context"
+
+	"github.com/shopspring/decimal"
+
+	"wager/internal/domain"
+)
+
+// names of the methods of domain.WagerRepository which are passed to Around
+const (
+	MethodCreate         = "create"
+	MethodCreateBatch    = "create_batch"
+	MethodFind           = "find"
+	MethodGet            = "get"
+	MethodPurchase       = "purchase"
+	MethodPurchaseBasket = "purchase_basket"
+)
+
+type (
+	// Middleware wraps a repository with a concern
+	Middleware func(next domain.WagerRepository) domain.WagerRepository
+
+	// Around runs call, a call of a method of the wrapped repository, and acts before and after it.
+	// call may be run again, ctx is passed to the method of the wrapped repository
+	Around func(ctx context.Context, method string, call func(ctx context.Context) error) error
+
+	// wrapped calls every method of next through around, Close is called directly
+	wrapped struct {
+		next   domain.WagerRepository
+		around Around
+	}
+)
+
+// Chain wraps repo with the middleware, the first one is the outermost
+func Chain(repo domain.WagerRepository, middleware ...Middleware) domain.WagerRepository {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		repo = middleware[i](repo)
+	}
+
+	return repo
+}
+
+// Wrap is the middleware which calls every method of the repository through around
+func Wrap(around Around) Middleware {
+	return func(next domain.WagerRepository) domain.WagerRepository {
+		return &wrapped{next: next, around: around}
+	}
+}
+
+// Create a wager
+func (w *wrapped) Create(ctx context.Context, wager domain.Wager) (res domain.Wager, err error) {
+	err = w.around(ctx, MethodCreate, func(ctx context.Context) error {
+		res, err = w.next.Create(ctx, wager)
+		return err
+	})
+
+	return res, err
+}
+
+// CreateBatch creates the wagers at once
+func (w *wrapped) CreateBatch(ctx context.Context, wagers []domain.Wager) (res []domain.Wager, err error) {
+	err = w.around(ctx, MethodCreateBatch, func(ctx context.Context) error {
+		res, err = w.next.CreateBatch(ctx, wagers)
+		return err
+	})
+
+	return res, err
+}
+
+// Find a wager
+func (w *wrapped) Find(ctx context.Context, wagerID int) (res domain.Wager, err error) {
+	err = w.around(ctx, MethodFind, func(ctx context.Context) error {
+		res, err = w.next.Find(ctx, wagerID)
+		return err
+	})
+
+	return res, err
+}
+
+// Get a page of wagers
+func (w *wrapped) Get(ctx context.Context, wagerID, limit int) (res []domain.Wager, next int, err error) {
+	err = w.around(ctx, MethodGet, func(ctx context.Context) error {
+		res, next, err = w.next.Get(ctx, wagerID, limit)
+		return err
+	})
+
+	return res, next, err
+}
+
+// Purchase a wager
+func (w *wrapped) Purchase(ctx context.Context, wagerID int, buyingPrice decimal.Decimal) (res domain.Purchase, err error) {
+	err = w.around(ctx, MethodPurchase, func(ctx context.Context) error {
+		res, err = w.next.Purchase(ctx, wagerID, buyingPrice)
+		return err
+	})
+
+	return res, err
+}
+
+// PurchaseBasket buys the wagers at once
+func (w *wrapped) PurchaseBasket(ctx context.Context, purchases []domain.Purchase) (res []domain.Purchase, err error) {
+	err = w.around(ctx, MethodPurchaseBasket, func(ctx context.Context) error {
+		res, err = w.next.PurchaseBasket(ctx, purchases)
+		return err
+	})
+
+	return res, err
+}
+
+// Close the repository
+func (w *wrapped) Close(ctx context.Context) error {
+	return w.next.Close(ctx)
+}
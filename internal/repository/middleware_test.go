@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"wager/internal/domain"
+	"wager/internal/domain/mocks"
+)
+
+var errConflict = errors.New("conflict")
+
+func retryable(err error) bool {
+	return errors.Is(err, errConflict)
+}
+
+func TestChain(t *testing.T) {
+	ctx := context.Background()
+	next := &mocks.WagerRepository{}
+	next.On("Find", mock.Anything, 1).Return(domain.Wager{ID: 1}, nil)
+	next.On("Close", mock.Anything).Return(nil)
+
+	var calls []string
+	record := func(name string) Middleware {
+		return Wrap(func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+			calls = append(calls, name+" "+method)
+			return call(ctx)
+		})
+	}
+
+	repo := Chain(next, record("outer"), record("inner"))
+	res, err := repo.Find(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.ID)
+	assert.Equal(t, []string{"outer find", "inner find"}, calls)
+
+	// close is not a call of the concerns
+	require.NoError(t, repo.Close(ctx))
+	assert.Len(t, calls, 2)
+	next.AssertExpectations(t)
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	price := decimal.NewFromInt(1)
+
+	tcs := []struct {
+		name     string
+		errs     []error
+		attempts int
+		err      error
+	}{
+		{name: "success", errs: []error{nil}, attempts: 1},
+		{name: "retried", errs: []error{errConflict, errConflict, nil}, attempts: 3},
+		{name: "too many attempts", errs: []error{errConflict, errConflict, errConflict}, attempts: 3, err: errConflict},
+		{name: "not retryable", errs: []error{domain.ErrWagerNotFound}, attempts: 1, err: domain.ErrWagerNotFound},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			next := &mocks.WagerRepository{}
+			for _, err := range tc.errs {
+				next.On("Purchase", mock.Anything, 1, price).Return(domain.Purchase{}, err).Once()
+			}
+
+			repo := Chain(next, Retry(3, time.Millisecond, retryable))
+			_, err := repo.Purchase(ctx, 1, price)
+			assert.Equal(t, tc.err, err)
+			next.AssertNumberOfCalls(t, "Purchase", tc.attempts)
+		})
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	next := &mocks.WagerRepository{}
+	next.On("Get", mock.Anything, 0, 10).Return(nil, 0, errConflict).Once()
+
+	repo := Chain(next, Retry(3, time.Hour, retryable))
+	_, _, err := repo.Get(ctx, 0, 10)
+	assert.Equal(t, errConflict, err)
+	next.AssertExpectations(t)
+}
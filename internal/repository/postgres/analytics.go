@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+
+	"wager/internal/domain"
+)
+
+// Stats aggregates the market statistics per bucket in the date range
+func (w *Repository) Stats(ctx context.Context, q domain.StatsQuery) ([]domain.MarketStats, error) {
+	query := `
+		WITH first_purchases AS (
+			SELECT wager_id, MIN(bought_at) AS bought_at
+			FROM purchases
+			GROUP BY wager_id
+		), placed AS (
+			SELECT
+				date_trunc($1, w.placed_at) AS bucket,
+				COUNT(*) AS wagers_placed,
+				SUM(w.selling_price) AS volume_placed,
+				COUNT(fp.bought_at)::numeric / COUNT(*) AS sell_through_rate,
+				AVG(EXTRACT(EPOCH FROM fp.bought_at - w.placed_at)) AS seconds_to_first_purchase
+			FROM wagers w
+			LEFT JOIN first_purchases fp ON fp.wager_id = w.id
+			WHERE w.placed_at >= $2 AND w.placed_at < $3
+			GROUP BY 1
+		), sold AS (
+			SELECT
+				date_trunc($1, p.bought_at) AS bucket,
+				COUNT(*) AS purchases,
+				SUM(p.buying_price) AS volume_sold,
+				AVG((w.selling_price - p.buying_price) / NULLIF(w.selling_price, 0)) AS average_discount
+			FROM purchases p
+			JOIN wagers w ON w.id = p.wager_id
+			WHERE p.bought_at >= $2 AND p.bought_at < $3
+			GROUP BY 1
+		)
+		SELECT
+			COALESCE(placed.bucket, sold.bucket) AS bucket,
+			COALESCE(placed.wagers_placed, 0) AS wagers_placed,
+			COALESCE(placed.volume_placed, 0) AS volume_placed,
+			COALESCE(sold.purchases, 0) AS purchases,
+			COALESCE(sold.volume_sold, 0) AS volume_sold,
+			ROUND(sold.average_discount, 4) AS average_discount,
+			ROUND(placed.sell_through_rate, 4) AS sell_through_rate,
+			ROUND(placed.seconds_to_first_purchase::numeric, 3) AS seconds_to_first_purchase
+		FROM placed
+		FULL OUTER JOIN sold ON sold.bucket = placed.bucket
+		ORDER BY 1`
+
+	stats := []domain.MarketStats{}
+	err := w.read(ctx, func(conn *sqlx.DB) error {
+		stats = stats[:0]
+		return conn.SelectContext(ctx, &stats, query, q.Bucket, q.From.UTC(), q.To.UTC())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// MarketTotals counts the wagers which can still be bought and sums the volume sold
+// a wager which is sold out is not open, see domain.Wager.SoldOut
+func (w *Repository) MarketTotals(ctx context.Context) (domain.MarketTotals, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM wagers
+				WHERE status = 'open' AND current_selling_price > 0
+				AND COALESCE(amount_sold, 0) < total_wager_value) AS open_wagers,
+			(SELECT COALESCE(SUM(buying_price), 0) FROM purchases) AS volume_sold`
+
+	totals := domain.MarketTotals{}
+	err := w.read(ctx, func(conn *sqlx.DB) error {
+		return conn.GetContext(ctx, &totals, query)
+	})
+
+	return totals, err
+}
@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDB connects to the database of WAGER_TEST_DSN, e.g. the one of the docker compose,
+// the test is skipped without it
+func testDB(t *testing.T) *sqlx.DB {
+	dsn := os.Getenv("WAGER_TEST_DSN")
+	if dsn == "" {
+		t.Skip("WAGER_TEST_DSN is not set")
+	}
+
+	conn, err := Open(dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestMarketTotals(t *testing.T) {
+	conn := testDB(t)
+	ctx := context.Background()
+	repo := New(conn)
+
+	before, err := repo.MarketTotals(ctx)
+	require.NoError(t, err)
+
+	// only the open wager which is not sold out can still be bought
+	var ids []int
+	err = conn.SelectContext(ctx, &ids, `INSERT INTO wagers
+		(total_wager_value, selling_price, odds, selling_percentage, current_selling_price, amount_sold, status)
+		VALUES
+		(10, 20, 2, 50, 20, NULL, 'open'),
+		(10, 20, 2, 50, 5, 10, 'open'),
+		(10, 20, 2, 50, 20, NULL, 'settled')
+		RETURNING id`)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Exec(`DELETE FROM wagers WHERE id = ANY($1)`, pq.Array(ids)) })
+
+	after, err := repo.MarketTotals(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, before.OpenWagers+1, after.OpenWagers)
+}
@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"wager/internal/domain"
+)
+
+// AuditTrail returns the audit events of the wager in the order they are written
+func (w *Repository) AuditTrail(ctx context.Context, wagerID int) ([]domain.AuditEvent, error) {
+	events := []domain.AuditEvent{}
+
+	query := `SELECT * FROM audit_events WHERE wager_id = $1 ORDER BY id`
+	err := w.read(ctx, func(conn *sqlx.DB) error {
+		events = events[:0]
+		return conn.SelectContext(ctx, &events, query, wagerID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// newAuditEvent builds the event of a wager change made by the actor of ctx, the claimed actor is kept beside it
+// before is nil for a new wager
+func newAuditEvent(ctx context.Context, action string, before, after *domain.Wager) (domain.AuditEvent, error) {
+	event := domain.AuditEvent{
+		WagerID:      after.ID,
+		Action:       action,
+		Actor:        domain.ActorFromContext(ctx),
+		ClaimedActor: domain.ClaimedActorFromContext(ctx),
+		RequestID:    domain.RequestIDFromContext(ctx),
+		// postgres keeps microseconds, the hash must be computed on the stored value
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+
+	var err error
+	if before != nil {
+		if event.Before, err = json.Marshal(before.Snapshot()); err != nil {
+			return event, err
+		}
+	}
+
+	event.After, err = json.Marshal(after.Snapshot())
+	return event, err
+}
+
+// lastAuditHash returns the hash of the latest event of the wager
+// the wager row must be locked by the transaction
+func lastAuditHash(ctx context.Context, tx *sqlx.Tx, wagerID int) (string, error) {
+	query := `SELECT hash FROM audit_events WHERE wager_id = $1 ORDER BY id DESC LIMIT 1`
+
+	var hash string
+	err := tx.GetContext(ctx, &hash, query, wagerID)
+	if err == sql.ErrNoRows {
+		return domain.AuditGenesisHash, nil
+	}
+
+	return hash, err
+}
+
+// insertAuditEvents hashes the events and writes them in a single insert
+// PrevHash of every event must be set
+func insertAuditEvents(ctx context.Context, tx *sqlx.Tx, events ...domain.AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(events))
+	args := make([]interface{}, 0, len(events)*10)
+	for i, e := range events {
+		e.Hash = e.ComputeHash()
+
+		n := i * 10
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10))
+		args = append(args, e.WagerID, e.Action, e.Actor, e.ClaimedActor, e.RequestID,
+			nullJSON(e.Before), nullJSON(e.After), e.PrevHash, e.Hash, e.CreatedAt)
+	}
+
+	query := `INSERT INTO audit_events
+		(wager_id, action, actor, claimed_actor, request_id, before, after, prev_hash, hash, created_at)
+		VALUES ` + strings.Join(values, ", ")
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func nullJSON(data json.RawMessage) interface{} {
+	if data == nil {
+		return nil
+	}
+
+	return string(data)
+}
@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"wager/internal/logging"
+)
+
+// SchemaVersion is the version of the schema the repository is written for, db/init.sql
+// and the migrations of db/migrations up to it
+const SchemaVersion = 6
+
+const (
+	connectMinBackoff = 100 * time.Millisecond
+	connectMaxBackoff = 5 * time.Second
+)
+
+// Pool settings of a connection
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// Apply the pool settings to the connection
+func (p Pool) Apply(conn *sqlx.DB) {
+	conn.SetMaxOpenConns(p.MaxOpenConns)
+	conn.SetMaxIdleConns(p.MaxIdleConns)
+	conn.SetConnMaxLifetime(p.ConnMaxLifetime)
+	conn.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+}
+
+// Connect to the database, retrying with exponential backoff until ctx is done
+// so the service can start before the database is up
+func Connect(ctx context.Context, dsn string, pool Pool, logger *zap.Logger) (*sqlx.DB, error) {
+	backoff := connectMinBackoff
+	for attempt := 1; ; attempt++ {
+		conn, err := Open(dsn)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = conn.PingContext(ctx); err == nil {
+			pool.Apply(conn)
+			return conn, nil
+		}
+		conn.Close()
+
+		logger.Warn("Connect to database failed, retry",
+			zap.Int("attempt", attempt), zap.Duration("backoff", backoff), logging.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > connectMaxBackoff {
+			backoff = connectMaxBackoff
+		}
+	}
+}
+
+// Ping the primary database
+func (w *Repository) Ping(ctx context.Context) error {
+	return w.conn.PingContext(ctx)
+}
+
+// PoolStats of the connection pool of the primary database
+func (w *Repository) PoolStats() sql.DBStats {
+	return w.conn.Stats()
+}
+
+// CheckSchema fails when the schema of the database is older than SchemaVersion
+func (w *Repository) CheckSchema(ctx context.Context) error {
+	var version int
+	if err := w.conn.GetContext(ctx, &version, `SELECT COALESCE(MAX(version), 0) FROM schema_version`); err != nil {
+		return err
+	}
+
+	if version < SchemaVersion {
+		return fmt.Errorf("schema version %d is older than %d", version, SchemaVersion)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/lib/pq"
+)
+
+// SQLSTATE of the errors which are gone when the transaction runs again
+const (
+	codeSerializationFailure = pq.ErrorCode("40001")
+	codeDeadlockDetected     = pq.ErrorCode("40P01")
+
+	// classConnectionException and the shutdown codes are the errors of a server which can not serve
+	classConnectionException = pq.ErrorClass("08")
+	codeAdminShutdown        = pq.ErrorCode("57P01")
+	codeCrashShutdown        = pq.ErrorCode("57P02")
+	codeCannotConnectNow     = pq.ErrorCode("57P03")
+)
+
+// IsRetryable tells whether the transaction failed by a serialization failure or a deadlock,
+// so it is rolled back and can run again
+func IsRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	return pqErr.Code == codeSerializationFailure || pqErr.Code == codeDeadlockDetected
+}
+
+// isConnectionError tells whether the query failed because the server can not be reached or can not serve,
+// unlike the errors of the query itself, e.g. a constraint violation or no rows
+func isConnectionError(err error) bool {
+	var (
+		pqErr  *pq.Error
+		netErr net.Error
+	)
+
+	switch {
+	// the deadline of the context is a net.Error too
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.As(err, &pqErr):
+		return pqErr.Code.Class() == classConnectionException || pqErr.Code == codeAdminShutdown ||
+			pqErr.Code == codeCrashShutdown || pqErr.Code == codeCannotConnectNow
+	case errors.As(err, &netErr):
+		return true
+	default:
+		return errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+			errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+}
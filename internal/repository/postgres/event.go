@@ -0,0 +1,156 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"wager/internal/domain"
+)
+
+// appendEvents writes the events to the event stream in a single insert
+// a concurrent writer of the same version is rejected by the unique (wager_id, version)
+func appendEvents(ctx context.Context, tx *sqlx.Tx, events ...domain.WagerEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(events))
+	args := make([]interface{}, 0, len(events)*5)
+	for i, e := range events {
+		n := i * 5
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+		args = append(args, e.WagerID, e.Version, e.Type, string(e.Data), e.OccurredAt)
+	}
+
+	query := `INSERT INTO wager_events
+		(wager_id, version, type, data, occurred_at)
+		VALUES ` + strings.Join(values, ", ")
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// saveProjection writes the wager projected from its events
+// the row is inserted when the projection does not exist yet
+func saveProjection(ctx context.Context, tx *sqlx.Tx, wager domain.Wager) error {
+	updateQuery := `UPDATE wagers
+		SET (total_wager_value, odds, selling_percentage, selling_price, current_selling_price,
+			percentage_sold, amount_sold, placed_at, status, version) =
+			($2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		WHERE id = $1`
+
+	args := []interface{}{wager.ID, wager.TotalWagerValue, wager.Odds, wager.SellingPercentage,
+		wager.SellingPrice, wager.CurrentSellingPrice, wager.PercentageSold, wager.AmountSold,
+		wager.PlacedAt, wager.Status, wager.Version}
+
+	res, err := tx.ExecContext(ctx, updateQuery, args...)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	insertQuery := `INSERT INTO wagers
+		(id, total_wager_value, odds, selling_percentage, selling_price, current_selling_price,
+		percentage_sold, amount_sold, placed_at, status, version)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+	_, err = tx.ExecContext(ctx, insertQuery, args...)
+	return err
+}
+
+// RebuildProjections replays the events of every wager and rewrites the wagers table from them
+// wagers are rebuilt one by one, each in a transaction holding the lock of the wager
+// so it is safe to run while the api is serving. fn is called for every wager with
+// whether its projection is changed
+func (w *Repository) RebuildProjections(ctx context.Context, fn func(wager domain.Wager, changed bool) error) error {
+	// a wager without events would be left out of the replay, it is placed in the stream by
+	// db/migrations/4_wager_events.sql
+	var missing int
+	err := w.conn.GetContext(ctx, &missing, `SELECT COUNT(*) FROM wagers w
+		WHERE NOT EXISTS (SELECT 1 FROM wager_events e WHERE e.wager_id = w.id)`)
+	if err != nil {
+		return err
+	}
+	if missing > 0 {
+		return fmt.Errorf("%d wagers have no events, apply db/migrations/4_wager_events.sql first", missing)
+	}
+
+	rows, err := w.conn.QueryContext(ctx, `SELECT DISTINCT wager_id FROM wager_events ORDER BY wager_id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var wagerID int
+		if err := rows.Scan(&wagerID); err != nil {
+			return err
+		}
+
+		var (
+			projection domain.Wager
+			changed    bool
+		)
+		err := w.withTx(ctx, func(tx *sqlx.Tx) error {
+			current := domain.Wager{}
+			err := tx.GetContext(ctx, &current, `SELECT * FROM wagers WHERE id = $1 FOR UPDATE`, wagerID)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+
+			events := []domain.WagerEvent{}
+			query := `SELECT * FROM wager_events WHERE wager_id = $1 ORDER BY version`
+			if err := tx.SelectContext(ctx, &events, query, wagerID); err != nil {
+				return err
+			}
+
+			for _, e := range events {
+				if err := projection.Apply(e); err != nil {
+					return err
+				}
+			}
+
+			if changed = !sameWager(current, projection); !changed {
+				return nil
+			}
+
+			return saveProjection(ctx, tx, projection)
+		})
+		if err != nil {
+			return fmt.Errorf("rebuild wager %d: %w", wagerID, err)
+		}
+
+		if err := fn(projection, changed); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = w.conn.ExecContext(ctx, `SELECT setval(pg_get_serial_sequence('wagers', 'id'),
+		COALESCE(MAX(id), 0) + 1, false) FROM wagers`)
+	return err
+}
+
+// sameWager compares the stored wager with its projection
+// decimals and times are compared by value as they may differ in representation
+func sameWager(a, b domain.Wager) bool {
+	if !a.SellingPrice.Equal(b.SellingPrice) || !a.CurrentSellingPrice.Equal(b.CurrentSellingPrice) ||
+		!a.PlacedAt.Equal(b.PlacedAt) {
+		return false
+	}
+
+	a.SellingPrice, a.CurrentSellingPrice, a.PlacedAt = b.SellingPrice, b.CurrentSellingPrice, b.PlacedAt
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,146 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"wager/internal/domain"
+	"wager/internal/logging"
+)
+
+const (
+	// idempotencyKeyTTL is how long the response of a key is replayed
+	idempotencyKeyTTL = 24 * time.Hour
+	// the expired keys are deleted every idempotencyPruneEvery claims, up to idempotencyPruneBatch at a time
+	idempotencyPruneEvery = 1024
+	idempotencyPruneBatch = 1000
+)
+
+// txKey is the context key of the transaction of an idempotent request
+type txKey struct{}
+
+// joinedTx is the transaction of the idempotent request of ctx
+func joinedTx(ctx context.Context) (*sqlx.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(*sqlx.Tx)
+	return tx, ok
+}
+
+// inSavepoint runs fn in a savepoint of tx, a write which fails is undone without aborting tx
+func inSavepoint(ctx context.Context, tx *sqlx.Tx, fn func(tx *sqlx.Tx) error) error {
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT joined_write`); err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		if _, rbErr := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT joined_write`); rbErr != nil {
+			return rbErr
+		}
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT joined_write`)
+	return err
+}
+
+// idempotencyRow is a row of the idempotency keys
+type idempotencyRow struct {
+	RequestHash []byte         `db:"request_hash"`
+	Status      int            `db:"status"`
+	ContentType sql.NullString `db:"content_type"`
+	Body        []byte         `db:"body"`
+}
+
+// Idempotent claims the key in a transaction and serves the request with fn in it, the writes made with the
+// context of fn join the transaction and the response is written with them, so they are committed together
+// and every instance replays it. the row of a key in flight is locked, so a retry waits for the first request
+// to commit or roll back. an expired key is claimed again
+func (w *Repository) Idempotent(ctx context.Context, key domain.IdempotencyKey,
+	fn domain.IdempotentFunc) (domain.IdempotentResponse, bool, error) {
+	if atomic.AddUint64(&w.idempotencyClaims, 1)%idempotencyPruneEvery == 0 {
+		w.pruneIdempotencyKeys(ctx)
+	}
+
+	tx, err := w.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return domain.IdempotentResponse{}, false, err
+	}
+	// the transaction is rolled back unless it is committed, even when fn panics
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		if rbErr := tx.Rollback(); rbErr != nil {
+			logging.WithRequest(ctx, w.logger).Error("Rollback failed", logging.Error(rbErr))
+		}
+	}()
+
+	claimQuery := `INSERT INTO idempotency_keys (scope, key, request_hash, expires_at)
+		VALUES ($1, $2, $3, NOW() + $4 * interval '1 millisecond')
+		ON CONFLICT (scope, key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, status = NULL, content_type = NULL, body = NULL,
+			created_at = NOW(), expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at < NOW()
+		RETURNING key`
+
+	var claimed string
+	err = tx.GetContext(ctx, &claimed, claimQuery, key.Scope, key.Key, key.RequestHash,
+		int64(idempotencyKeyTTL/time.Millisecond))
+	if err == sql.ErrNoRows {
+		// the key is kept by a request which is committed
+		return w.keptResponse(ctx, key)
+	}
+	if err != nil {
+		return domain.IdempotentResponse{}, false, err
+	}
+
+	res, keep, err := fn(context.WithValue(ctx, txKey{}, tx))
+	if err != nil || !keep {
+		return res, false, err
+	}
+
+	saveQuery := `UPDATE idempotency_keys SET status = $3, content_type = $4, body = $5 WHERE scope = $1 AND key = $2`
+	if _, err := tx.ExecContext(ctx, saveQuery, key.Scope, key.Key, res.Status, res.ContentType, res.Body); err != nil {
+		return domain.IdempotentResponse{}, false, err
+	}
+
+	committed = true
+	if err := tx.Commit(); err != nil {
+		logging.WithRequest(ctx, w.logger).Error("Commit failed", logging.Error(err))
+		return domain.IdempotentResponse{}, false, err
+	}
+
+	return res, false, nil
+}
+
+// keptResponse reads the response of a key which is kept
+func (w *Repository) keptResponse(ctx context.Context, key domain.IdempotencyKey) (domain.IdempotentResponse, bool, error) {
+	query := `SELECT request_hash, status, content_type, body FROM idempotency_keys WHERE scope = $1 AND key = $2`
+
+	row := idempotencyRow{}
+	if err := w.conn.GetContext(ctx, &row, query, key.Scope, key.Key); err != nil {
+		return domain.IdempotentResponse{}, false, err
+	}
+
+	if !bytes.Equal(row.RequestHash, key.RequestHash) {
+		return domain.IdempotentResponse{}, false, domain.ErrIdempotencyKeyReused
+	}
+
+	return domain.IdempotentResponse{Status: row.Status, ContentType: row.ContentType.String, Body: row.Body}, true, nil
+}
+
+// pruneIdempotencyKeys deletes some of the expired keys, the ones which are locked are left for the next time
+func (w *Repository) pruneIdempotencyKeys(ctx context.Context) {
+	query := `DELETE FROM idempotency_keys WHERE (scope, key) IN (
+		SELECT scope, key FROM idempotency_keys WHERE expires_at < NOW()
+		LIMIT $1 FOR UPDATE SKIP LOCKED)`
+
+	if _, err := w.conn.ExecContext(ctx, query, idempotencyPruneBatch); err != nil {
+		logging.WithRequest(ctx, w.logger).Warn("Prune idempotency keys failed", logging.Error(err))
+	}
+}
@@ -0,0 +1,200 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+
+	"wager/internal/domain"
+	"wager/internal/logging"
+)
+
+const (
+	// NotifyChannel is the channel the changes of the wagers are notified on
+	NotifyChannel = "wager_events"
+
+	// maxNotifyPayload is below the 8000 bytes postgres allows, the events of a bigger payload are left out
+	maxNotifyPayload = 7900
+	// listenerPingInterval is how often an idle listener checks its connection
+	listenerPingInterval = time.Minute
+)
+
+type (
+	// Notification of a committed change of a wager, it is sent by the instance which made the change
+	// to every listener. the events are left out when they do not fit in a notification
+	Notification struct {
+		WagerID int                  `json:"wager_id"`
+		Events  []domain.MarketEvent `json:"events,omitempty"`
+		// Truncated tells that the events are left out, the subscribers miss them
+		Truncated bool `json:"truncated,omitempty"`
+		// Reset tells that the listener reconnected, the notifications sent meanwhile are missed
+		Reset bool `json:"-"`
+	}
+
+	// Listener listens to the notifications of every instance and fans them out to its subscribers
+	// it reconnects by itself when the connection is lost
+	Listener struct {
+		logger  *zap.Logger
+		connect func(callback pq.EventCallbackType) listenerConn
+
+		mu     sync.Mutex
+		nextID int
+		subs   map[int]func(Notification)
+	}
+
+	// listenerConn is the connection of the listener, it is a *pq.Listener
+	listenerConn interface {
+		Listen(channel string) error
+		NotificationChannel() <-chan *pq.Notification
+		Ping() error
+		Close() error
+	}
+)
+
+// notifyMarket notifies the market events in the transaction of the change, so they are only sent once it is committed.
+// a notification for every wager keeps the events of the wager together and in order
+func notifyMarket(ctx context.Context, tx *sqlx.Tx, events ...domain.MarketEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	payloads, err := notifyPayloads(events)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `SELECT pg_notify($1, payload) FROM unnest($2::text[]) AS payload`,
+		NotifyChannel, pq.Array(payloads))
+	return err
+}
+
+// notifyPayloads are the notifications of the events grouped by wager in the order of their first event,
+// the events of a notification which is too big are left out
+func notifyPayloads(events []domain.MarketEvent) ([]string, error) {
+	var wagerIDs []int
+	byWager := map[int][]domain.MarketEvent{}
+	for _, e := range events {
+		if _, ok := byWager[e.WagerID]; !ok {
+			wagerIDs = append(wagerIDs, e.WagerID)
+		}
+		byWager[e.WagerID] = append(byWager[e.WagerID], e)
+	}
+
+	payloads := make([]string, 0, len(wagerIDs))
+	for _, wagerID := range wagerIDs {
+		data, err := json.Marshal(Notification{WagerID: wagerID, Events: byWager[wagerID]})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(data) > maxNotifyPayload {
+			if data, err = json.Marshal(Notification{WagerID: wagerID, Truncated: true}); err != nil {
+				return nil, err
+			}
+		}
+		payloads = append(payloads, string(data))
+	}
+
+	return payloads, nil
+}
+
+// NewListener of the notifications of the database at dsn, nothing is logged when logger is nil
+func NewListener(dsn string, logger *zap.Logger) *Listener {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &Listener{
+		logger: logger,
+		connect: func(callback pq.EventCallbackType) listenerConn {
+			return pq.NewListener(dsn, connectMinBackoff, connectMaxBackoff, callback)
+		},
+		subs: map[int]func(Notification){},
+	}
+}
+
+// Subscribe calls fn with every notification until it is unsubscribed,
+// fn is called from the listener one notification at a time so it must not block
+func (l *Listener) Subscribe(fn func(Notification)) (unsubscribe func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	id := l.nextID
+	l.nextID++
+	l.subs[id] = fn
+
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		delete(l.subs, id)
+	}
+}
+
+// Run listens until ctx is done, a lost connection is retried with a backoff
+// and the subscribers get a reset notification once it is back
+func (l *Listener) Run(ctx context.Context) error {
+	listener := l.connect(func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			l.logger.Warn("Listener disconnected, reconnect", logging.Error(err))
+		case pq.ListenerEventConnectionAttemptFailed:
+			l.logger.Warn("Listener connect failed, retry", logging.Error(err))
+		case pq.ListenerEventReconnected:
+			l.logger.Info("Listener reconnected")
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(NotifyChannel); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.NotificationChannel():
+			// a nil notification is sent once the connection is back
+			if n == nil {
+				l.fanout(Notification{Reset: true})
+				continue
+			}
+
+			notification := Notification{}
+			if err := json.Unmarshal([]byte(n.Extra), &notification); err != nil {
+				l.logger.Error("Decode notification failed", zap.String("payload", n.Extra), logging.Error(err))
+				continue
+			}
+			l.fanout(notification)
+		case <-ticker.C:
+			// a ping finds a connection which is lost silently, the listener reconnects then
+			if err := listener.Ping(); err != nil {
+				l.logger.Warn("Listener ping failed", logging.Error(err))
+			}
+		}
+	}
+}
+
+// fanout calls the subscribers with the notification, they are called without the lock
+// so a subscriber can subscribe or unsubscribe meanwhile
+func (l *Listener) fanout(n Notification) {
+	l.mu.Lock()
+	subs := make([]func(Notification), 0, len(l.subs))
+	for _, fn := range l.subs {
+		subs = append(subs, fn)
+	}
+	l.mu.Unlock()
+
+	for _, fn := range subs {
+		fn(n)
+	}
+}
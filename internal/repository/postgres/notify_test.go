@@ -0,0 +1,147 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"wager/internal/domain"
+)
+
+func TestNotifyPayloads(t *testing.T) {
+	events := []domain.MarketEvent{
+		{Type: domain.MarketWagerPurchased, WagerID: 2},
+		{Type: domain.MarketWagerPurchased, WagerID: 1},
+		{Type: domain.MarketPriceChanged, WagerID: 2},
+	}
+	// the events of wager 3 do not fit in a notification
+	for i := 0; i < 100; i++ {
+		events = append(events, domain.MarketEvent{Type: domain.MarketPriceChanged, WagerID: 3})
+	}
+
+	payloads, err := notifyPayloads(events)
+	require.NoError(t, err)
+
+	notifications := make([]string, 0, len(payloads))
+	for _, payload := range payloads {
+		assert.True(t, len(payload) <= maxNotifyPayload, len(payload))
+
+		n := Notification{}
+		require.NoError(t, json.Unmarshal([]byte(payload), &n))
+
+		summary := []string{strconv.Itoa(n.WagerID)}
+		for _, e := range n.Events {
+			summary = append(summary, e.Type)
+		}
+		if n.Truncated {
+			summary = append(summary, "truncated")
+		}
+		notifications = append(notifications, strings.Join(summary, " "))
+	}
+
+	// the events of a wager are together and in order, the wagers are in the order of their first event
+	assert.Equal(t, []string{"2 wager_purchased price_changed", "1 wager_purchased", "3 truncated"}, notifications)
+}
+
+// fakeConn is a connection of the listener which is fed by the test
+type fakeConn struct {
+	notify   chan *pq.Notification
+	callback pq.EventCallbackType
+	listened chan string
+	closed   chan struct{}
+}
+
+func (c *fakeConn) Listen(channel string) error {
+	c.listened <- channel
+	return nil
+}
+
+func (c *fakeConn) NotificationChannel() <-chan *pq.Notification {
+	return c.notify
+}
+
+func (c *fakeConn) Ping() error {
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestListener(t *testing.T) {
+	conn := &fakeConn{
+		notify:   make(chan *pq.Notification),
+		listened: make(chan string, 1),
+		closed:   make(chan struct{}),
+	}
+	l := NewListener("", nil)
+	l.connect = func(callback pq.EventCallbackType) listenerConn {
+		conn.callback = callback
+		return conn
+	}
+
+	var (
+		mu       sync.Mutex
+		received = map[string][]Notification{}
+	)
+	subscribe := func(name string) func() {
+		return l.Subscribe(func(n Notification) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			received[name] = append(received[name], n)
+		})
+	}
+	subscribe("first")
+	unsubscribe := subscribe("second")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Run(ctx)
+	}()
+	assert.Equal(t, NotifyChannel, <-conn.listened)
+
+	// every subscriber gets the notification, a payload which is not one is skipped
+	conn.notify <- &pq.Notification{Extra: `{"wager_id":1,"events":[{"type":"sold_out","wager_id":1}]}`}
+	conn.notify <- &pq.Notification{Extra: `{`}
+
+	// a subscriber which unsubscribes from the fan out does not deadlock the listener
+	l.Subscribe(func(Notification) { unsubscribe() })
+
+	// the connection is back after it is lost, the notifications sent meanwhile are missed
+	conn.callback(pq.ListenerEventDisconnected, nil)
+	conn.callback(pq.ListenerEventReconnected, nil)
+	conn.notify <- nil
+	conn.notify <- &pq.Notification{Extra: `{"wager_id":2,"truncated":true}`}
+
+	cancel()
+	require.NoError(t, <-done)
+	select {
+	case <-conn.closed:
+	case <-time.After(time.Second):
+		t.Fatal("the connection is not closed")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Len(t, received["first"], 3)
+	assert.Equal(t, 1, received["first"][0].WagerID)
+	assert.Equal(t, domain.MarketSoldOut, received["first"][0].Events[0].Type)
+	assert.Equal(t, Notification{Reset: true}, received["first"][1])
+	assert.Equal(t, Notification{WagerID: 2, Truncated: true}, received["first"][2])
+
+	require.Len(t, received["second"], 2)
+	assert.Equal(t, 1, received["second"][0].WagerID)
+	assert.Equal(t, Notification{Reset: true}, received["second"][1])
+}
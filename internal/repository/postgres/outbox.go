@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"wager/internal/domain"
+)
+
+// outboxRow is a row of the outbox, the events are json
+type outboxRow struct {
+	ID        int64     `db:"id"`
+	WagerID   int       `db:"wager_id"`
+	Events    []byte    `db:"events"`
+	Attempts  int       `db:"attempts"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// insertOutbox writes the market events to the outbox in the transaction of the change,
+// a row for every wager keeps the events of the wager together and in order
+func insertOutbox(ctx context.Context, tx *sqlx.Tx, events ...domain.MarketEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	var wagerIDs []int
+	byWager := map[int][]domain.MarketEvent{}
+	for _, e := range events {
+		if _, ok := byWager[e.WagerID]; !ok {
+			wagerIDs = append(wagerIDs, e.WagerID)
+		}
+		byWager[e.WagerID] = append(byWager[e.WagerID], e)
+	}
+
+	values := make([]string, 0, len(wagerIDs))
+	args := make([]interface{}, 0, len(wagerIDs)*2)
+	for i, wagerID := range wagerIDs {
+		data, err := json.Marshal(byWager[wagerID])
+		if err != nil {
+			return err
+		}
+
+		n := i * 2
+		values = append(values, fmt.Sprintf("($%d, $%d)", n+1, n+2))
+		args = append(args, wagerID, string(data))
+	}
+
+	query := `INSERT INTO outbox (wager_id, events) VALUES ` + strings.Join(values, ", ")
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// ClaimOutbox takes the oldest message of up to limit wagers for lease, a claimed message is not taken
+// again until its lease expires. only the oldest message of a wager is taken so the events of a wager
+// are published in order, and the locked messages are skipped so many relays can run at once.
+// the messages are published after the claim is committed, so no lock is held while they are published
+func (w *Repository) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]domain.OutboxMessage, error) {
+	query := `UPDATE outbox SET available_at = NOW() + $2 * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM outbox o
+			WHERE available_at <= NOW()
+			AND NOT EXISTS (SELECT 1 FROM outbox p WHERE p.wager_id = o.wager_id AND p.id < o.id)
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id, wager_id, events, attempts, created_at`
+
+	rows := []outboxRow{}
+	if err := w.conn.SelectContext(ctx, &rows, query, limit, int64(lease/time.Millisecond)); err != nil {
+		return nil, err
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+
+	messages := make([]domain.OutboxMessage, 0, len(rows))
+	for _, row := range rows {
+		msg := domain.OutboxMessage{
+			ID:        row.ID,
+			WagerID:   row.WagerID,
+			Attempts:  row.Attempts,
+			CreatedAt: row.CreatedAt,
+		}
+		if err := json.Unmarshal(row.Events, &msg.Events); err != nil {
+			return nil, fmt.Errorf("outbox %d: %w", row.ID, err)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+// RecordOutbox writes the outcome of the attempts in a transaction, a published message is deleted
+// and a failed one is tried again after its RetryAfter
+func (w *Repository) RecordOutbox(ctx context.Context, attempts ...domain.OutboxAttempt) error {
+	if len(attempts) == 0 {
+		return nil
+	}
+
+	return w.withTx(ctx, func(tx *sqlx.Tx) error {
+		published := pq.Int64Array{}
+		for _, attempt := range attempts {
+			if attempt.Error == "" {
+				published = append(published, attempt.MessageID)
+				continue
+			}
+
+			retryQuery := `UPDATE outbox
+				SET attempts = attempts + 1, last_error = $2, available_at = NOW() + $3 * INTERVAL '1 millisecond'
+				WHERE id = $1`
+
+			_, err := tx.ExecContext(ctx, retryQuery, attempt.MessageID, attempt.Error,
+				int64(attempt.RetryAfter/time.Millisecond))
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(published) == 0 {
+			return nil
+		}
+
+		_, err := tx.ExecContext(ctx, `DELETE FROM outbox WHERE id = ANY($1)`, published)
+		return err
+	})
+}
@@ -2,24 +2,51 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
-	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
 
 	"wager/internal/domain"
+	"wager/internal/logging"
 )
 
 // Repository ...
 type Repository struct {
-	conn *sqlx.DB
+	// idempotencyClaims counts the claims of the idempotency keys, the expired keys are pruned every so often.
+	// it is first so it is aligned for the atomic operations
+	idempotencyClaims uint64
+
+	conn   *sqlx.DB
+	logger *zap.Logger
+
+	replicas             []*replica
+	replicaCheckInterval time.Duration
+	nextReplica          uint32
+	done                 chan struct{}
 }
 
 // New returns new wager postgres repository
-func New(conn *sqlx.DB) *Repository {
-	return &Repository{
-		conn: conn,
+func New(conn *sqlx.DB, opts ...Option) *Repository {
+	w := &Repository{
+		conn:   conn,
+		logger: zap.NewNop(),
+		done:   make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(w)
 	}
+
+	if len(w.replicas) > 0 && w.replicaCheckInterval > 0 {
+		go w.checkReplicas(w.replicaCheckInterval)
+	}
+
+	return w
 }
 
 // Create new wager, persist the wager to database
@@ -31,18 +58,83 @@ func (w *Repository) Create(ctx context.Context, wager domain.Wager) (domain.Wag
 		RETURNING *`
 
 	res := domain.Wager{}
-	err := w.conn.GetContext(ctx, &res, query, wager.TotalWagerValue, wager.SellingPrice,
-		wager.Odds, wager.SellingPercentage, wager.SellingPrice)
+	err := w.withTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, &res, query, wager.TotalWagerValue, wager.SellingPrice,
+			wager.Odds, wager.SellingPercentage, wager.SellingPrice)
+		if err != nil {
+			return err
+		}
+
+		return placed(ctx, tx, res)
+	})
 
 	return res, err
 }
 
+// CreateBatch persists all the wagers in a single multi-row insert
+// the returned wagers keep the order of the input
+func (w *Repository) CreateBatch(ctx context.Context, wagers []domain.Wager) ([]domain.Wager, error) {
+	if len(wagers) == 0 {
+		return nil, nil
+	}
+
+	values := make([]string, 0, len(wagers))
+	args := make([]interface{}, 0, len(wagers)*5)
+	for i, wager := range wagers {
+		n := i * 5
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+		args = append(args, wager.TotalWagerValue, wager.SellingPrice,
+			wager.Odds, wager.SellingPercentage, wager.SellingPrice)
+	}
+
+	query := `INSERT INTO wagers
+		(total_wager_value, selling_price, odds, selling_percentage, current_selling_price)
+		VALUES ` + strings.Join(values, ", ") + `
+		RETURNING *`
+
+	res := []domain.Wager{}
+	err := w.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.SelectContext(ctx, &res, query, args...); err != nil {
+			return err
+		}
+
+		// RETURNING does not promise any order but the ids are taken in the order of VALUES
+		sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+
+		return placed(ctx, tx, res...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Find a wager by id
+func (w *Repository) Find(ctx context.Context, wagerID int) (domain.Wager, error) {
+	wager := domain.Wager{}
+
+	query := `SELECT * FROM wagers WHERE id = $1`
+	err := w.read(ctx, func(conn *sqlx.DB) error {
+		return conn.GetContext(ctx, &wager, query, wagerID)
+	})
+	if err == sql.ErrNoRows {
+		return wager, fmt.Errorf("wager %d: %w", wagerID, domain.ErrWagerNotFound)
+	}
+
+	return wager, err
+}
+
 // Get list of wagers from page and limit
 func (w *Repository) Get(ctx context.Context, wagerID, limit int) ([]domain.Wager, int, error) {
 	wagers := []domain.Wager{}
 
 	query := `SELECT * FROM wagers WHERE ID > $1 ORDER BY ID LIMIT $2`
-	if err := w.conn.SelectContext(ctx, &wagers, query, wagerID, limit); err != nil {
+	err := w.read(ctx, func(conn *sqlx.DB) error {
+		wagers = wagers[:0]
+		return conn.SelectContext(ctx, &wagers, query, wagerID, limit)
+	})
+	if err != nil {
 		return nil, 0, err
 	}
 
@@ -53,84 +145,87 @@ func (w *Repository) Get(ctx context.Context, wagerID, limit int) ([]domain.Wage
 	return wagers, wagers[len(wagers)-1].ID, nil
 }
 
-// Purchase a wager, lock the wager to avoid data race
-// do all biz logic here
-func (w *Repository) Purchase(ctx context.Context, wagerID int, buyingPrice decimal.Decimal) (domain.Purchase, error) {
-	purchase := domain.Purchase{}
+// placed appends the placed events, the audit events and the market events of the new wagers,
+// the market events are notified to the other instances too
+func placed(ctx context.Context, tx *sqlx.Tx, wagers ...domain.Wager) error {
+	if err := recordPlaced(ctx, tx, wagers...); err != nil {
+		return err
+	}
 
-	tx, err := w.conn.BeginTx(ctx, nil)
-	if err != nil {
-		return purchase, err
+	marketEvents := domain.PlacedMarketEvents(wagers...)
+	if err := insertOutbox(ctx, tx, marketEvents...); err != nil {
+		return err
 	}
 
-	defer func() {
+	return notifyMarket(ctx, tx, marketEvents...)
+}
+
+// recordPlaced appends the placed events and the audit events of the new wagers
+func recordPlaced(ctx context.Context, tx *sqlx.Tx, wagers ...domain.Wager) error {
+	events := make([]domain.WagerEvent, 0, len(wagers))
+	auditEvents := make([]domain.AuditEvent, 0, len(wagers))
+	for i := range wagers {
+		// the wager row is the projection of its first event
+		placed := wagers[i]
+		placed.Version = 0
+
+		event, err := domain.NewWagerEvent(placed, domain.WagerPlaced, placed.Snapshot())
 		if err != nil {
-			err = tx.Rollback()
-		} else {
-			err = tx.Commit()
+			return err
 		}
+		event.OccurredAt = wagers[i].PlacedAt
+		events = append(events, event)
 
+		auditEvent, err := newAuditEvent(ctx, domain.AuditActionPlaced, nil, &wagers[i])
 		if err != nil {
-			fmt.Printf("Rollback or commit error here: %s", err.Error())
+			return err
 		}
-	}()
-
-	lockQuery := `
-		SELECT id, current_selling_price, total_wager_value, amount_sold
-		FROM wagers
-		WHERE id = $1 FOR UPDATE`
-
-	wager := domain.Wager{}
-	err = tx.QueryRowContext(ctx, lockQuery, wagerID).Scan(
-		&wager.ID,
-		&wager.CurrentSellingPrice,
-		&wager.TotalWagerValue,
-		&wager.AmountSold,
-	)
-	if err != nil {
-		return purchase, err
+		auditEvent.PrevHash = domain.AuditGenesisHash
+		auditEvents = append(auditEvents, auditEvent)
 	}
 
-	if wager.ID == 0 {
-		return purchase, fmt.Errorf("Wager %d is not found", wagerID)
+	if err := appendEvents(ctx, tx, events...); err != nil {
+		return err
 	}
 
-	if buyingPrice.GreaterThan(wager.CurrentSellingPrice) {
-		return purchase, fmt.Errorf("buying_price must be less than current_selling_price")
+	return insertAuditEvents(ctx, tx, auditEvents...)
+}
+
+// withTx runs fn in a transaction, commit if fn succeeds otherwise rollback
+// the writes of an idempotent request join its transaction, see Idempotent
+func (w *Repository) withTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	if tx, ok := joinedTx(ctx); ok {
+		return inSavepoint(ctx, tx, fn)
 	}
 
-	var amountSold, percentageSold int
-	if wager.AmountSold != nil {
-		amountSold = *wager.AmountSold + 1
+	tx, err := w.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
 	}
-	percentageSold = amountSold * 100 / wager.TotalWagerValue
 
-	updateWagerQuery := `UPDATE wagers
-		SET (current_selling_price, amount_sold, percentage_sold) = ($1, $2, $3)
-		WHERE ID = $4`
+	if err = fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			logging.WithRequest(ctx, w.logger).Error("Rollback failed", logging.Error(rbErr))
+		}
+		return err
+	}
 
-	_, err = tx.ExecContext(ctx, updateWagerQuery, buyingPrice,
-		amountSold, percentageSold, wagerID)
-	if err != nil {
-		return purchase, err
+	if err = tx.Commit(); err != nil {
+		logging.WithRequest(ctx, w.logger).Error("Commit failed", logging.Error(err))
 	}
 
-	insertPurchaseQuery := `INSERT INTO purchases
-		(wager_id, buying_price)
-		VALUES
-		($1, $2)
-		RETURNING id, wager_id, buying_price, bought_at`
-
-	err = tx.QueryRowContext(ctx, insertPurchaseQuery, wagerID, buyingPrice).Scan(
-		&purchase.ID,
-		&purchase.WagerID,
-		&purchase.BuyingPrice,
-		&purchase.BoughtAt,
-	)
-	return purchase, err
+	return err
 }
 
 // Close the repository
 func (w *Repository) Close(ctx context.Context) error {
+	close(w.done)
+
+	for _, r := range w.replicas {
+		if err := r.conn.Close(); err != nil {
+			w.logger.Error("Close replica failed", zap.Int("replica", r.index), logging.Error(err))
+		}
+	}
+
 	return w.conn.DB.Close()
 }
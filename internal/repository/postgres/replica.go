@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"wager/internal/domain"
+	"wager/internal/logging"
+)
+
+// Option configures the optional parts of Repository
+type Option func(w *Repository)
+
+// WithLogger sets the logger of the repository, nothing is logged by default
+func WithLogger(logger *zap.Logger) Option {
+	return func(w *Repository) {
+		w.logger = logger
+	}
+}
+
+// WithReplicas sends the read only queries to the replicas
+// the replicas are pinged every interval and the unhealthy ones are skipped until they recover
+func WithReplicas(interval time.Duration, replicas ...*sqlx.DB) Option {
+	return func(w *Repository) {
+		for _, conn := range replicas {
+			w.replicas = append(w.replicas, &replica{index: len(w.replicas), conn: conn, healthy: 1})
+		}
+		w.replicaCheckInterval = interval
+	}
+}
+
+type replica struct {
+	index   int
+	conn    *sqlx.DB
+	healthy int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+// setHealthy returns whether the health of the replica is changed
+func (r *replica) setHealthy(healthy bool) bool {
+	var v int32
+	if healthy {
+		v = 1
+	}
+
+	return atomic.SwapInt32(&r.healthy, v) != v
+}
+
+// reader returns the connection for a read only query and the replica it belongs to
+// the primary is returned when the context needs fresh reads or there is no healthy replica
+func (w *Repository) reader(ctx context.Context) (*sqlx.DB, *replica) {
+	if len(w.replicas) == 0 || domain.FreshReadFromContext(ctx) {
+		return w.conn, nil
+	}
+
+	start := atomic.AddUint32(&w.nextReplica, 1)
+	for i := range w.replicas {
+		r := w.replicas[(int(start)+i)%len(w.replicas)]
+		if r.isHealthy() {
+			return r.conn, r
+		}
+	}
+
+	return w.conn, nil
+}
+
+// read runs a read only query on a replica and fails over to the primary when the replica can not be reached,
+// the other errors are the ones of the query so they are returned
+func (w *Repository) read(ctx context.Context, query func(conn *sqlx.DB) error) error {
+	conn, r := w.reader(ctx)
+
+	err := query(conn)
+	if err == nil || r == nil || ctx.Err() != nil || !isConnectionError(err) {
+		return err
+	}
+
+	logging.WithRequest(ctx, w.logger).Warn("Read from replica failed, fail over to primary",
+		zap.Int("replica", r.index), logging.Error(err))
+	r.setHealthy(false)
+
+	return query(w.conn)
+}
+
+// checkReplicas pings the replicas until the repository is closed
+func (w *Repository) checkReplicas(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		for _, r := range w.replicas {
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			healthy := r.conn.PingContext(ctx) == nil
+			cancel()
+
+			if r.setHealthy(healthy) {
+				w.logger.Info("Replica health is changed", zap.Int("replica", r.index), zap.Bool("healthy", healthy))
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"wager/internal/domain"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	tcs := []struct {
+		err  error
+		want bool
+	}{
+		{err: driver.ErrBadConn, want: true},
+		{err: fmt.Errorf("get wager: %w", io.ErrUnexpectedEOF), want: true},
+		{err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, want: true},
+		{err: &pq.Error{Code: "08006"}, want: true},
+		{err: &pq.Error{Code: codeAdminShutdown}, want: true},
+		{err: &pq.Error{Code: "23505"}},
+		{err: sql.ErrNoRows},
+		{err: domain.ErrWagerNotFound},
+		{err: context.DeadlineExceeded},
+		{err: context.Canceled},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.want, isConnectionError(tc.err), tc.err)
+	}
+}
+
+func TestReadFailover(t *testing.T) {
+	tcs := []struct {
+		name    string
+		err     error
+		calls   int
+		healthy bool
+	}{
+		{name: "served", calls: 1, healthy: true},
+		{name: "no rows", err: sql.ErrNoRows, calls: 1, healthy: true},
+		{name: "constraint", err: &pq.Error{Code: "23505"}, calls: 1, healthy: true},
+		{name: "connection lost", err: driver.ErrBadConn, calls: 2},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &replica{healthy: 1}
+			w := &Repository{replicas: []*replica{r}, logger: zap.NewNop()}
+
+			// the replica fails with the error, the primary serves
+			calls := 0
+			err := w.read(context.Background(), func(*sqlx.DB) error {
+				calls++
+				if calls == 1 {
+					return tc.err
+				}
+				return nil
+			})
+
+			if tc.calls == 1 {
+				assert.Equal(t, tc.err, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.calls, calls)
+			assert.Equal(t, tc.healthy, r.isHealthy())
+		})
+	}
+}
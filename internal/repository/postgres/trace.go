@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/semconv"
+
+	"wager/internal/tracing"
+)
+
+// Open a database handle whose statements and transactions are traced
+// the connections are opened lazily like sql.Open
+func Open(dsn string) (*sqlx.DB, error) {
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return sqlx.NewDb(sql.OpenDB(tracedConnector{connector}), "postgres"), nil
+}
+
+// tracedConnector opens traced connections of lib/pq
+type tracedConnector struct {
+	*pq.Connector
+}
+
+func (c tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pc, ok := conn.(pqConn)
+	if !ok {
+		_ = conn.Close()
+		return nil, fmt.Errorf("connection %T can not be traced", conn)
+	}
+
+	return tracedConn{pc}, nil
+}
+
+// pqConn is the set of the interfaces implemented by a lib/pq connection
+type pqConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.QueryerContext
+	driver.ExecerContext
+	driver.Pinger
+}
+
+// tracedConn starts a span for every statement, begin, commit and rollback
+type tracedConn struct {
+	pqConn
+}
+
+func (c tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, span := startStatement(ctx, query)
+	rows, err := c.pqConn.QueryContext(ctx, query, args)
+	tracing.End(ctx, span, err)
+
+	return rows, err
+}
+
+func (c tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ctx, span := startStatement(ctx, query)
+	res, err := c.pqConn.ExecContext(ctx, query, args)
+	tracing.End(ctx, span, err)
+
+	return res, err
+}
+
+func (c tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	spanCtx, span := startStatement(ctx, "BEGIN")
+	tx, err := c.pqConn.BeginTx(spanCtx, opts)
+	tracing.End(spanCtx, span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	// commit and rollback do not take a context, they belong to the trace of the begin
+	return tracedTx{tx: tx, ctx: ctx}, nil
+}
+
+// tracedTx traces the end of a transaction
+type tracedTx struct {
+	tx  driver.Tx
+	ctx context.Context
+}
+
+func (t tracedTx) Commit() error {
+	ctx, span := startStatement(t.ctx, "COMMIT")
+	err := t.tx.Commit()
+	tracing.End(ctx, span, err)
+
+	return err
+}
+
+func (t tracedTx) Rollback() error {
+	ctx, span := startStatement(t.ctx, "ROLLBACK")
+	err := t.tx.Rollback()
+	tracing.End(ctx, span, err)
+
+	return err
+}
+
+// startStatement starts the span of a statement, it is named after the operation of the statement
+func startStatement(ctx context.Context, query string) (context.Context, trace.Span) {
+	statement := strings.Join(strings.Fields(query), " ")
+
+	operation := statement
+	if i := strings.IndexByte(statement, ' '); i > 0 {
+		operation = statement[:i]
+	}
+	operation = strings.ToUpper(operation)
+
+	return tracing.Start(ctx, "postgres "+operation,
+		semconv.DBSystemPostgres,
+		semconv.DBOperationKey.String(operation),
+		semconv.DBStatementKey.String(statement),
+	)
+}
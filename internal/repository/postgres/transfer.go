@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"wager/internal/domain"
+)
+
+// ExportWagers streams every wager in id order to fn
+// rows are read one by one so the table does not have to fit in memory
+func (w *Repository) ExportWagers(ctx context.Context, fn func(domain.Wager) error) error {
+	rows, err := w.conn.QueryxContext(ctx, `SELECT * FROM wagers ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		wager := domain.Wager{}
+		if err := rows.StructScan(&wager); err != nil {
+			return err
+		}
+
+		if err := fn(wager); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ExportPurchases streams every purchase in id order to fn
+func (w *Repository) ExportPurchases(ctx context.Context, fn func(domain.Purchase) error) error {
+	rows, err := w.conn.QueryxContext(ctx, `SELECT * FROM purchases ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		purchase := domain.Purchase{}
+		if err := rows.StructScan(&purchase); err != nil {
+			return err
+		}
+
+		if err := fn(purchase); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ImportWager inserts the wager as it is with its id, placed_at is generated when it is empty
+// the wager is placed in the event stream with its sold state, so the purchases imported
+// along with it are not replayed on top of it. the import is audited but it is not a market
+// event, so nothing is written to the outbox nor notified
+func (w *Repository) ImportWager(ctx context.Context, wager domain.Wager) error {
+	query := `INSERT INTO wagers
+		(id, total_wager_value, odds, selling_percentage, selling_price,
+		current_selling_price, percentage_sold, amount_sold, placed_at, status)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, COALESCE($9, NOW()), COALESCE(NULLIF($10, ''), 'open'))
+		RETURNING *`
+
+	return w.withTx(ctx, func(tx *sqlx.Tx) error {
+		res := domain.Wager{}
+		err := tx.GetContext(ctx, &res, query, wager.ID, wager.TotalWagerValue, wager.Odds,
+			wager.SellingPercentage, wager.SellingPrice, wager.CurrentSellingPrice,
+			wager.PercentageSold, wager.AmountSold, nullTime(wager.PlacedAt), wager.Status)
+		if err != nil {
+			return err
+		}
+
+		return recordPlaced(ctx, tx, res)
+	})
+}
+
+// ImportPurchase inserts the purchase as it is with its id, bought_at is generated when it is empty
+// the purchase is appended to the event stream of its wager as an imported purchase, it is counted
+// in the sold state the wager is imported with so it is not replayed on top of it. it is audited
+// like the imported wager and it is not a market event either
+func (w *Repository) ImportPurchase(ctx context.Context, purchase domain.Purchase) error {
+	query := `INSERT INTO purchases
+		(id, wager_id, buying_price, bought_at)
+		VALUES
+		($1, $2, $3, COALESCE($4, NOW()))
+		RETURNING *`
+
+	return w.withTx(ctx, func(tx *sqlx.Tx) error {
+		res := domain.Purchase{}
+		err := tx.GetContext(ctx, &res, query, purchase.ID, purchase.WagerID,
+			purchase.BuyingPrice, nullTime(purchase.BoughtAt))
+		if err != nil {
+			return err
+		}
+
+		wager := domain.Wager{}
+		if err := tx.GetContext(ctx, &wager, `SELECT * FROM wagers WHERE id = $1 FOR UPDATE`, res.WagerID); err != nil {
+			return err
+		}
+
+		event, err := domain.NewWagerEvent(wager, domain.WagerPurchased, domain.WagerPurchasedData{Purchase: res, Imported: true})
+		if err != nil {
+			return err
+		}
+		event.OccurredAt = res.BoughtAt
+
+		before := wager
+		if err := wager.Apply(event); err != nil {
+			return err
+		}
+		if err := appendEvents(ctx, tx, event); err != nil {
+			return err
+		}
+		if err := saveProjection(ctx, tx, wager); err != nil {
+			return err
+		}
+
+		auditEvent, err := newAuditEvent(ctx, domain.AuditActionPurchased, &before, &wager)
+		if err != nil {
+			return err
+		}
+		if auditEvent.PrevHash, err = lastAuditHash(ctx, tx, wager.ID); err != nil {
+			return err
+		}
+
+		return insertAuditEvents(ctx, tx, auditEvent)
+	})
+}
+
+// SyncSequences moves the id sequences after the imported ids
+func (w *Repository) SyncSequences(ctx context.Context) error {
+	for _, table := range []string{"wagers", "purchases"} {
+		query := `SELECT setval(pg_get_serial_sequence('` + table + `', 'id'), COALESCE(MAX(id), 0) + 1, false)
+			FROM ` + table
+
+		if _, err := w.conn.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/label"
+
+	"wager/internal/domain"
+	"wager/internal/tracing"
+)
+
+// wagerTx is the unit of work of the service in a transaction of the repository
+type wagerTx struct {
+	tx *sqlx.Tx
+}
+
+// InTx runs fn in a transaction, it is committed when fn succeeds and rolled back otherwise
+func (w *Repository) InTx(ctx context.Context, fn func(ctx context.Context, tx domain.WagerTx) error) error {
+	return w.withTx(ctx, func(tx *sqlx.Tx) error {
+		return fn(ctx, &wagerTx{tx: tx})
+	})
+}
+
+// LockWager reads the wager with a row lock, the other purchases of the wager wait until the transaction ends
+func (t *wagerTx) LockWager(ctx context.Context, wagerID int) (domain.Wager, error) {
+	lockQuery := `SELECT * FROM wagers WHERE id = $1 FOR UPDATE`
+
+	wager := domain.Wager{}
+	lockCtx, span := tracing.Start(ctx, "postgres.lock_wagers", label.Int("wager_id", wagerID))
+	err := t.tx.GetContext(lockCtx, &wager, lockQuery, wagerID)
+	tracing.End(lockCtx, span, err)
+	if err == sql.ErrNoRows {
+		return wager, fmt.Errorf("wager %d: %w", wagerID, domain.ErrWagerNotFound)
+	}
+
+	return wager, err
+}
+
+// InsertPurchase records the purchase, its id and time are generated
+func (t *wagerTx) InsertPurchase(ctx context.Context, purchase domain.Purchase) (domain.Purchase, error) {
+	insertPurchaseQuery := `INSERT INTO purchases
+		(wager_id, buying_price)
+		VALUES
+		($1, $2)
+		RETURNING id, wager_id, buying_price, bought_at`
+
+	res := domain.Purchase{}
+	err := t.tx.QueryRowContext(ctx, insertPurchaseQuery, purchase.WagerID, purchase.BuyingPrice).Scan(
+		&res.ID,
+		&res.WagerID,
+		&res.BuyingPrice,
+		&res.BoughtAt,
+	)
+
+	return res, err
+}
+
+// SaveWager appends the event, projects it to the wager, writes the audit event
+// and the market events to the outbox and notifies them
+func (t *wagerTx) SaveWager(ctx context.Context, change domain.WagerChange) error {
+	if err := appendEvents(ctx, t.tx, change.Event); err != nil {
+		return err
+	}
+
+	if err := saveProjection(ctx, t.tx, change.After); err != nil {
+		return err
+	}
+
+	auditEvent, err := newAuditEvent(ctx, change.Action, &change.Before, &change.After)
+	if err != nil {
+		return err
+	}
+
+	// the wager is locked so no other event of the wager can be written meanwhile
+	if auditEvent.PrevHash, err = lastAuditHash(ctx, t.tx, change.After.ID); err != nil {
+		return err
+	}
+
+	if err = insertAuditEvents(ctx, t.tx, auditEvent); err != nil {
+		return err
+	}
+
+	if err = insertOutbox(ctx, t.tx, change.MarketEvents...); err != nil {
+		return err
+	}
+
+	return notifyMarket(ctx, t.tx, change.MarketEvents...)
+}
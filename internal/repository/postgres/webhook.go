@@ -0,0 +1,193 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"wager/internal/domain"
+)
+
+// webhookRow is a row of the webhooks, the event types are a postgres array
+type webhookRow struct {
+	ID         int            `db:"id"`
+	URL        string         `db:"url"`
+	EventTypes pq.StringArray `db:"event_types"`
+	Secret     string         `db:"secret"`
+	CreatedAt  time.Time      `db:"created_at"`
+}
+
+func (r webhookRow) webhook() domain.Webhook {
+	return domain.Webhook{
+		ID:         r.ID,
+		URL:        r.URL,
+		EventTypes: []string(r.EventTypes),
+		Secret:     r.Secret,
+		CreatedAt:  r.CreatedAt,
+	}
+}
+
+// CreateWebhook stores a new webhook
+func (w *Repository) CreateWebhook(ctx context.Context, webhook domain.Webhook) (domain.Webhook, error) {
+	query := `INSERT INTO webhooks (url, event_types, secret) VALUES ($1, $2, $3) RETURNING *`
+
+	row := webhookRow{}
+	eventTypes := webhook.EventTypes
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+	err := w.withTx(ctx, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &row, query, webhook.URL, pq.StringArray(eventTypes), webhook.Secret)
+	})
+	if err != nil {
+		return domain.Webhook{}, err
+	}
+
+	return row.webhook(), nil
+}
+
+// EnqueueWebhooks writes a delivery of every event to every webhook which subscribes to it
+// an event which is enqueued again is ignored, so the outbox can relay it more than once
+func (w *Repository) EnqueueWebhooks(ctx context.Context, events ...domain.MarketEvent) error {
+	rows := []webhookRow{}
+	if err := w.conn.SelectContext(ctx, &rows, `SELECT * FROM webhooks ORDER BY id`); err != nil {
+		return err
+	}
+
+	values := []string{}
+	args := []interface{}{}
+	for _, event := range events {
+		var payload []byte
+		for _, row := range rows {
+			webhook := row.webhook()
+			if !webhook.Match(event) {
+				continue
+			}
+
+			if payload == nil {
+				var err error
+				if payload, err = json.Marshal(event); err != nil {
+					return err
+				}
+			}
+
+			n := len(args)
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+			args = append(args, webhook.ID, event.ID, event.Type, event.WagerID, string(payload))
+		}
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	query := `INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, wager_id, payload)
+		VALUES ` + strings.Join(values, ", ") + `
+		ON CONFLICT (webhook_id, event_id) DO NOTHING`
+
+	_, err := w.conn.ExecContext(ctx, query, args...)
+	return err
+}
+
+// WebhookDeliveries returns the last deliveries of the webhook, the newest first
+func (w *Repository) WebhookDeliveries(ctx context.Context, webhookID, limit int) ([]domain.WebhookDelivery, error) {
+	var exists bool
+	if err := w.conn.GetContext(ctx, &exists, `SELECT EXISTS (SELECT 1 FROM webhooks WHERE id = $1)`, webhookID); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("webhook %d: %w", webhookID, domain.ErrWebhookNotFound)
+	}
+
+	deliveries := []domain.WebhookDelivery{}
+	query := `SELECT * FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2`
+	if err := w.conn.SelectContext(ctx, &deliveries, query, webhookID, limit); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RedeliverWebhook makes the delivery pending again, it is sent at once and tried once more when it is dead
+func (w *Repository) RedeliverWebhook(ctx context.Context, webhookID int, deliveryID int64) (domain.WebhookDelivery, error) {
+	query := `UPDATE webhook_deliveries SET status = $3, next_attempt_at = NOW()
+		WHERE id = $1 AND webhook_id = $2
+		RETURNING *`
+
+	delivery := domain.WebhookDelivery{}
+	err := w.conn.GetContext(ctx, &delivery, query, deliveryID, webhookID, domain.WebhookDeliveryPending)
+	if err == sql.ErrNoRows {
+		return delivery, fmt.Errorf("delivery %d of webhook %d: %w", deliveryID, webhookID, domain.ErrWebhookDeliveryNotFound)
+	}
+
+	return delivery, err
+}
+
+// ClaimWebhookDeliveries takes up to limit pending deliveries which are due, with the url and the secret
+// of their webhooks. They are leased, so another dispatcher does not take them before the lease ends
+// and the ones of a dispatcher which crashes are sent again
+func (w *Repository) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]domain.WebhookDelivery, error) {
+	query := `UPDATE webhook_deliveries d SET next_attempt_at = NOW() + $3 * INTERVAL '1 millisecond'
+		FROM webhooks h
+		WHERE h.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = $2 AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING d.*, h.url, h.secret`
+
+	rows := []struct {
+		domain.WebhookDelivery
+		URL    string `db:"url"`
+		Secret string `db:"secret"`
+	}{}
+	err := w.conn.SelectContext(ctx, &rows, query, limit, domain.WebhookDeliveryPending, int64(lease/time.Millisecond))
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]domain.WebhookDelivery, 0, len(rows))
+	for _, row := range rows {
+		delivery := row.WebhookDelivery
+		delivery.URL, delivery.Secret = row.URL, row.Secret
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+// RecordWebhookAttempt writes the outcome of an attempt to the log of the delivery
+func (w *Repository) RecordWebhookAttempt(ctx context.Context, attempt domain.WebhookAttempt) error {
+	status := domain.WebhookDeliveryPending
+	switch {
+	case attempt.Error == "":
+		status = domain.WebhookDeliveryDelivered
+	case attempt.Dead:
+		status = domain.WebhookDeliveryDead
+	}
+
+	query := `UPDATE webhook_deliveries
+		SET attempts = attempts + 1, status = $2, response_status = $3, last_error = $4,
+			next_attempt_at = NOW() + $5 * INTERVAL '1 millisecond',
+			delivered_at = CASE WHEN $2 = 'delivered' THEN NOW() ELSE delivered_at END
+		WHERE id = $1`
+
+	var responseStatus, lastError interface{}
+	if attempt.ResponseStatus != 0 {
+		responseStatus = attempt.ResponseStatus
+	}
+	if attempt.Error != "" {
+		lastError = attempt.Error
+	}
+
+	_, err := w.conn.ExecContext(ctx, query, attempt.DeliveryID, status, responseStatus, lastError,
+		int64(attempt.RetryAfter/time.Millisecond))
+	return err
+}
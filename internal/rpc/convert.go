@@ -0,0 +1,47 @@
+package rpc
+
+import (
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"wager/internal/domain"
+	"wager/pkg/wagerpb"
+)
+
+func toWager(w domain.Wager) *wagerpb.Wager {
+	res := &wagerpb.Wager{
+		Id:                  int64(w.ID),
+		TotalWagerValue:     int64(w.TotalWagerValue),
+		Odds:                int64(w.Odds),
+		SellingPercentage:   int64(w.SellingPercentage),
+		SellingPrice:        w.SellingPrice.String(),
+		CurrentSellingPrice: w.CurrentSellingPrice.String(),
+		Status:              w.Status,
+	}
+
+	if w.PercentageSold != nil {
+		res.PercentageSold = &wrappers.Int64Value{Value: int64(*w.PercentageSold)}
+	}
+	if w.AmountSold != nil {
+		res.AmountSold = &wrappers.Int64Value{Value: int64(*w.AmountSold)}
+	}
+	if !w.PlacedAt.IsZero() {
+		res.PlacedAt, _ = ptypes.TimestampProto(w.PlacedAt)
+	}
+
+	return res
+}
+
+func toPurchase(p domain.Purchase) *wagerpb.Purchase {
+	res := &wagerpb.Purchase{
+		Id:          int64(p.ID),
+		WagerId:     int64(p.WagerID),
+		BuyingPrice: p.BuyingPrice.String(),
+	}
+
+	if !p.BoughtAt.IsZero() {
+		res.BoughtAt, _ = ptypes.TimestampProto(p.BoughtAt)
+	}
+
+	return res
+}
@@ -0,0 +1,163 @@
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/label"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"wager/internal/domain"
+	"wager/internal/logging"
+	"wager/internal/tracing"
+)
+
+// the metadata keys of the calls, they are the http headers of the rest api
+const (
+	metadataRequestID     = "x-request-id"
+	metadataActor         = "x-actor"
+	metadataAuthorization = "authorization"
+
+	bearerPrefix = "Bearer "
+
+	// maxRequestIDLength is the longest request id taken from a client, a longer one is replaced
+	maxRequestIDLength = 128
+)
+
+func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res interface{}, err error) {
+	ctx, finish := s.begin(ctx, info.FullMethod)
+	defer func() { finish(&err, recover()) }()
+
+	if ctx, err = s.authenticate(ctx); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (s *Server) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	ctx, finish := s.begin(stream.Context(), info.FullMethod)
+	defer func() { finish(&err, recover()) }()
+
+	if ctx, err = s.authenticate(ctx); err != nil {
+		return err
+	}
+
+	// the stream ends at its deadline or once the server closes, so it does not hold the graceful stop open
+	ctx, cancel := context.WithTimeout(ctx, s.streamTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+}
+
+// begin puts the request id and the claimed actor of the call into its context and starts its span
+// finish logs the call once it is served, a panic of the handler is turned into an internal error,
+// it must be given the recover() of the deferred call
+func (s *Server) begin(ctx context.Context, method string) (context.Context, func(err *error, panicked interface{})) {
+	start := time.Now()
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	id := first(md, metadataRequestID)
+	if id == "" || len(id) > maxRequestIDLength {
+		id = newRequestID()
+	}
+	ctx = domain.WithRequestID(ctx, id)
+	ctx = domain.WithClaimedActor(ctx, first(md, metadataActor))
+	_ = grpc.SetHeader(ctx, metadata.Pairs(metadataRequestID, id))
+
+	ctx, span := tracing.Start(ctx, "grpc "+method, label.String("rpc.system", "grpc"), label.String("rpc.method", method))
+
+	return ctx, func(err *error, panicked interface{}) {
+		if panicked != nil {
+			logging.WithRequest(ctx, s.logger).Error("Call panicked", zap.String("method", method),
+				zap.String("panic", fmt.Sprint(panicked)), zap.Stack("stack"))
+			*err = status.Error(codes.Internal, "internal error")
+		}
+
+		tracing.End(ctx, span, *err)
+
+		// the class of the error is logged by the handler, the status only has its message
+		code := status.Code(*err)
+		fields := []zap.Field{
+			zap.String("method", method),
+			zap.String("code", code.String()),
+			zap.Duration("latency", time.Since(start)),
+		}
+		if *err != nil {
+			fields = append(fields, zap.String("error", status.Convert(*err).Message()))
+		}
+
+		logger := logging.WithRequest(ctx, s.logger)
+		switch code {
+		case codes.OK:
+			logger.Info("Call served", fields...)
+		case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+			logger.Error("Call failed", fields...)
+		default:
+			logger.Info("Call rejected", fields...)
+		}
+	}
+}
+
+// authenticate puts the caller of the api key of the call into its context as the actor, as the http api does.
+// a call without a key is anonymous, one with an unknown key fails with Unauthenticated unless there are no callers
+func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	auth := first(md, metadataAuthorization)
+	if auth == "" || len(s.callers) == 0 {
+		return ctx, nil
+	}
+
+	caller, ok := "", false
+	if strings.HasPrefix(auth, bearerPrefix) {
+		caller, ok = s.callers.Find(strings.TrimPrefix(auth, bearerPrefix))
+	}
+	if !ok {
+		return ctx, status.Error(codes.Unauthenticated, "api key is not valid")
+	}
+
+	return domain.WithActor(ctx, caller), nil
+}
+
+// contextStream is a server stream with the context of the interceptor
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
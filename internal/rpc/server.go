@@ -0,0 +1,288 @@
+// Package rpc serves the wagers over gRPC, with the same repository and validation as the http api
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"wager/config"
+	"wager/internal/domain"
+	"wager/internal/logging"
+	"wager/pkg/wagerpb"
+)
+
+const (
+	// defaultPageSize is the number of wagers read at once by ListWagers when the server is not configured
+	defaultPageSize = 20
+	// DefaultStreamTimeout is the longest a stream is served when the server is not configured
+	DefaultStreamTimeout = time.Minute
+)
+
+type (
+	// Server is the gRPC server of the wagers
+	Server struct {
+		wagerpb.UnimplementedWagerServiceServer
+
+		grpc     *grpc.Server
+		health   *health.Server
+		repo     domain.WagerRepository
+		settings func() config.App
+		callers  config.Callers
+		logger   *zap.Logger
+
+		streamTimeout time.Duration
+		// closing is closed once the server closes, it ends the streams in flight
+		closing   chan struct{}
+		closeOnce sync.Once
+	}
+
+	// Option configures the optional dependencies of Server
+	Option func(s *Server)
+)
+
+// WithSettings reads the app settings on every call, so they can be reloaded
+// settings must be safe for concurrent use
+func WithSettings(settings func() config.App) Option {
+	return func(s *Server) {
+		s.settings = settings
+	}
+}
+
+// WithCallers authenticates the calls which send the api key of a caller, the other calls are anonymous
+func WithCallers(callers config.Callers) Option {
+	return func(s *Server) {
+		s.callers = callers
+	}
+}
+
+// WithLogger sets the logger of the server, nothing is logged by default
+func WithLogger(logger *zap.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithStreamTimeout ends a stream after timeout, so a long stream does not hold the shutdown open
+func WithStreamTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.streamTimeout = timeout
+	}
+}
+
+// New gRPC server of the wagers, the standard health service is served too
+func New(repo domain.WagerRepository, opts ...Option) *Server {
+	s := &Server{
+		health: health.NewServer(),
+		repo:   repo,
+		settings: func() config.App {
+			return config.App{MaxWagerInPage: defaultPageSize}
+		},
+		logger:        zap.NewNop(),
+		streamTimeout: DefaultStreamTimeout,
+		closing:       make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.grpc = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(s.unaryInterceptor),
+		grpc.ChainStreamInterceptor(s.streamInterceptor),
+	)
+	wagerpb.RegisterWagerServiceServer(s.grpc, s)
+	healthpb.RegisterHealthServer(s.grpc, s.health)
+
+	return s
+}
+
+// Run serves on the port until the server is closed
+func (s *Server) Run(port int) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("Start the grpc server", zap.Int("port", port))
+	return s.Serve(lis)
+}
+
+// Serve on the listener until the server is closed
+func (s *Server) Serve(lis net.Listener) error {
+	return s.grpc.Serve(lis)
+}
+
+// Drain turns the health of the server to not serving, it keeps serving until it is closed
+func (s *Server) Drain() {
+	s.health.Shutdown()
+}
+
+// Close the server, the streams in flight are ended and the calls in flight are waited for until ctx is done
+// the repository is not closed, it belongs to the http app
+func (s *Server) Close(ctx context.Context) error {
+	s.logger.Info("Close the grpc server")
+	s.health.Shutdown()
+	s.closeOnce.Do(func() { close(s.closing) })
+
+	done := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.grpc.Stop()
+		return ctx.Err()
+	}
+}
+
+// PlaceWager places a wager
+func (s *Server) PlaceWager(ctx context.Context, req *wagerpb.PlaceWagerRequest) (*wagerpb.Wager, error) {
+	sellingPrice, err := decimal.NewFromString(req.SellingPrice)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, domain.ErrInvalidSellingPrice)
+	}
+
+	wager := domain.Wager{
+		TotalWagerValue:   int(req.TotalWagerValue),
+		Odds:              int(req.Odds),
+		SellingPercentage: int(req.SellingPercentage),
+		SellingPrice:      sellingPrice,
+	}
+	if err := wager.Validate(ctx); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	res, err := s.repo.Create(ctx, wager)
+	if err != nil {
+		return nil, s.fail(ctx, "Place wager failed", err)
+	}
+
+	logging.WithRequest(ctx, s.logger).Info("Wager is placed", zap.Int("wager_id", res.ID))
+	return toWager(res), nil
+}
+
+// BuyWager buys a wager
+func (s *Server) BuyWager(ctx context.Context, req *wagerpb.BuyWagerRequest) (*wagerpb.Purchase, error) {
+	buyingPrice, err := decimal.NewFromString(req.BuyingPrice)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, domain.ErrInvalidBuyingPrice)
+	}
+
+	purchase := domain.Purchase{WagerID: int(req.WagerId), BuyingPrice: buyingPrice}
+	if err := purchase.Validate(ctx); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	res, err := s.repo.Purchase(ctx, purchase.WagerID, purchase.BuyingPrice)
+	if err != nil {
+		return nil, s.fail(ctx, "Buy wager failed", err, zap.Int("wager_id", purchase.WagerID))
+	}
+
+	logging.WithRequest(ctx, s.logger).Info("Wager is purchased", zap.Int("wager_id", res.WagerID), zap.Int("purchase_id", res.ID))
+	return toPurchase(res), nil
+}
+
+// GetWager gets a wager by id
+func (s *Server) GetWager(ctx context.Context, req *wagerpb.GetWagerRequest) (*wagerpb.Wager, error) {
+	if req.WagerId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, domain.ErrInvalidWagerID)
+	}
+
+	res, err := s.repo.Find(ctx, int(req.WagerId))
+	if err != nil {
+		return nil, s.fail(ctx, "Get wager failed", err, zap.Int64("wager_id", req.WagerId))
+	}
+
+	return toWager(res), nil
+}
+
+// ListWagers streams the wagers after the wager id page, they are read max_wager_in_page at a time
+// so a stream of all the wagers does not hold them in memory. the stream ends at the stream timeout
+func (s *Server) ListWagers(req *wagerpb.ListWagersRequest, stream wagerpb.WagerService_ListWagersServer) error {
+	if req.Page <= 0 {
+		return status.Error(codes.InvalidArgument, "page can not be less than or equal to zero")
+	}
+	if req.Limit < 0 {
+		return status.Error(codes.InvalidArgument, "limit can not be negative")
+	}
+
+	ctx := stream.Context()
+	page, left := int(req.Page), int(req.Limit)
+	for {
+		size := s.settings().MaxWagerInPage
+		if size <= 0 {
+			size = defaultPageSize
+		}
+		if req.Limit > 0 && left < size {
+			size = left
+		}
+
+		wagers, next, err := s.repo.Get(ctx, page, size)
+		if err != nil {
+			return s.fail(ctx, "List wagers failed", err)
+		}
+
+		for _, wager := range wagers {
+			if err := stream.Send(toWager(wager)); err != nil {
+				return err
+			}
+		}
+
+		left -= len(wagers)
+		if len(wagers) < size || (req.Limit > 0 && left == 0) {
+			return nil
+		}
+		page = next
+	}
+}
+
+// fail logs the error of the repository and returns its status
+func (s *Server) fail(ctx context.Context, msg string, err error, fields ...zap.Field) error {
+	st := errorStatus(err)
+
+	fields = append(fields, logging.Error(err))
+	if st.Code() == codes.Internal {
+		logging.WithRequest(ctx, s.logger).Error(msg, fields...)
+	} else {
+		logging.WithRequest(ctx, s.logger).Info(msg, fields...)
+	}
+
+	return st.Err()
+}
+
+// errorStatus maps the kind of the repository errors to grpc status, as the http api maps it to http status
+func errorStatus(err error) *status.Status {
+	switch domain.ErrorKindOf(err) {
+	case domain.ErrorKindNotFound:
+		return status.New(codes.NotFound, err.Error())
+	case domain.ErrorKindInvalid:
+		return status.New(codes.InvalidArgument, err.Error())
+	case domain.ErrorKindConflict:
+		return status.New(codes.FailedPrecondition, err.Error())
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.New(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.New(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.New(codes.Internal, err.Error())
+	}
+}
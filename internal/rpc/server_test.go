@@ -0,0 +1,264 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"wager/config"
+	"wager/internal/domain"
+	"wager/internal/domain/mocks"
+	"wager/pkg/wagerpb"
+)
+
+// dial serves s on an in memory listener and connects a client to it
+func dial(t *testing.T, s *Server) (wagerpb.WagerServiceClient, *grpc.ClientConn) {
+	lis := bufconn.Listen(1 << 20)
+	go s.Serve(lis)
+	t.Cleanup(func() { s.Close(context.Background()) })
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.Dial()
+		}))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return wagerpb.NewWagerServiceClient(conn), conn
+}
+
+func TestPlaceWager(t *testing.T) {
+	placed := domain.Wager{
+		ID:                  1,
+		TotalWagerValue:     100,
+		Odds:                2,
+		SellingPercentage:   10,
+		SellingPrice:        decimal.NewFromFloat(10.5),
+		CurrentSellingPrice: decimal.NewFromFloat(10.5),
+		PlacedAt:            time.Now(),
+		Status:              domain.WagerStatusOpen,
+	}
+
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Create", mock.MatchedBy(func(ctx context.Context) bool {
+		return domain.ActorFromContext(ctx) == "gateway" && domain.ClaimedActorFromContext(ctx) == "tester" &&
+			domain.RequestIDFromContext(ctx) == "request-1"
+	}), mock.Anything).Return(placed, nil).Once()
+
+	c, _ := dial(t, New(mockRepo, WithCallers(config.Callers{"gateway": "gateway-key"})))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer gateway-key",
+		"x-actor", "tester", "x-request-id", "request-1")
+	var header metadata.MD
+	res, err := c.PlaceWager(ctx, &wagerpb.PlaceWagerRequest{
+		TotalWagerValue:   100,
+		Odds:              2,
+		SellingPercentage: 10,
+		SellingPrice:      "10.5",
+	}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Id)
+	assert.Equal(t, "10.5", res.CurrentSellingPrice)
+	assert.Nil(t, res.PercentageSold)
+	assert.Equal(t, []string{"request-1"}, header.Get("x-request-id"))
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer tester")
+	_, err = c.PlaceWager(ctx, &wagerpb.PlaceWagerRequest{TotalWagerValue: 100, Odds: 2, SellingPercentage: 10, SellingPrice: "10.5"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), err)
+
+	tcs := []struct {
+		name string
+		req  *wagerpb.PlaceWagerRequest
+	}{
+		{name: "invalid price", req: &wagerpb.PlaceWagerRequest{TotalWagerValue: 100, Odds: 2, SellingPercentage: 10, SellingPrice: "abc"}},
+		{name: "price too low", req: &wagerpb.PlaceWagerRequest{TotalWagerValue: 100, Odds: 2, SellingPercentage: 10, SellingPrice: "1"}},
+		{name: "missing odds", req: &wagerpb.PlaceWagerRequest{TotalWagerValue: 100, SellingPercentage: 10, SellingPrice: "10.5"}},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := c.PlaceWager(context.Background(), tc.req)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err), err)
+		})
+	}
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestBuyWager(t *testing.T) {
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Purchase", mock.Anything, 1, mock.Anything).
+		Return(domain.Purchase{ID: 7, WagerID: 1, BuyingPrice: decimal.NewFromFloat(1.5), BoughtAt: time.Now()}, nil)
+	mockRepo.On("Purchase", mock.Anything, 2, mock.Anything).
+		Return(domain.Purchase{}, fmt.Errorf("wager 2: %w", domain.ErrWagerNotFound))
+	mockRepo.On("Purchase", mock.Anything, 3, mock.Anything).
+		Return(domain.Purchase{}, fmt.Errorf("wager 3: %w", domain.ErrBuyingPriceTooHigh))
+	mockRepo.On("Purchase", mock.Anything, 4, mock.Anything).
+		Return(domain.Purchase{}, fmt.Errorf("wager 4: %w", domain.ErrWagerClosed))
+	mockRepo.On("Purchase", mock.Anything, 5, mock.Anything).
+		Return(domain.Purchase{}, sql.ErrConnDone)
+
+	c, _ := dial(t, New(mockRepo))
+
+	res, err := c.BuyWager(context.Background(), &wagerpb.BuyWagerRequest{WagerId: 1, BuyingPrice: "1.5"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), res.Id)
+	assert.Equal(t, "1.5", res.BuyingPrice)
+
+	tcs := []struct {
+		name string
+		req  *wagerpb.BuyWagerRequest
+		code codes.Code
+	}{
+		{name: "not found", req: &wagerpb.BuyWagerRequest{WagerId: 2, BuyingPrice: "1.5"}, code: codes.NotFound},
+		{name: "price too high", req: &wagerpb.BuyWagerRequest{WagerId: 3, BuyingPrice: "1.5"}, code: codes.InvalidArgument},
+		{name: "closed", req: &wagerpb.BuyWagerRequest{WagerId: 4, BuyingPrice: "1.5"}, code: codes.FailedPrecondition},
+		{name: "database fails", req: &wagerpb.BuyWagerRequest{WagerId: 5, BuyingPrice: "1.5"}, code: codes.Internal},
+		{name: "missing wager id", req: &wagerpb.BuyWagerRequest{BuyingPrice: "1.5"}, code: codes.InvalidArgument},
+		{name: "invalid price", req: &wagerpb.BuyWagerRequest{WagerId: 1, BuyingPrice: "-1"}, code: codes.InvalidArgument},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := c.BuyWager(context.Background(), tc.req)
+			assert.Equal(t, tc.code, status.Code(err), err)
+		})
+	}
+}
+
+func TestGetWager(t *testing.T) {
+	sold := 10
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Find", mock.Anything, 1).Return(domain.Wager{ID: 1, PercentageSold: &sold}, nil)
+	mockRepo.On("Find", mock.Anything, 2).Return(domain.Wager{}, fmt.Errorf("wager 2: %w", domain.ErrWagerNotFound))
+
+	c, _ := dial(t, New(mockRepo))
+
+	res, err := c.GetWager(context.Background(), &wagerpb.GetWagerRequest{WagerId: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Id)
+	assert.Equal(t, int64(10), res.PercentageSold.GetValue())
+
+	_, err = c.GetWager(context.Background(), &wagerpb.GetWagerRequest{WagerId: 2})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = c.GetWager(context.Background(), &wagerpb.GetWagerRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestListWagers(t *testing.T) {
+	page := func(ids ...int) []domain.Wager {
+		wagers := make([]domain.Wager, 0, len(ids))
+		for _, id := range ids {
+			wagers = append(wagers, domain.Wager{ID: id})
+		}
+		return wagers
+	}
+
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Get", mock.Anything, 1, 2).Return(page(2, 3), 3, nil)
+	mockRepo.On("Get", mock.Anything, 3, 2).Return(page(4, 5), 5, nil)
+	mockRepo.On("Get", mock.Anything, 5, 2).Return(page(6), 6, nil)
+	mockRepo.On("Get", mock.Anything, 3, 1).Return(page(4), 4, nil)
+
+	c, _ := dial(t, New(mockRepo, WithSettings(func() config.App { return config.App{MaxWagerInPage: 2} })))
+
+	list := func(req *wagerpb.ListWagersRequest) ([]int64, error) {
+		stream, err := c.ListWagers(context.Background(), req)
+		require.NoError(t, err)
+
+		ids := []int64{}
+		for {
+			wager, err := stream.Recv()
+			if err == io.EOF {
+				return ids, nil
+			}
+			if err != nil {
+				return ids, err
+			}
+			ids = append(ids, wager.Id)
+		}
+	}
+
+	ids, err := list(&wagerpb.ListWagersRequest{Page: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 3, 4, 5, 6}, ids)
+
+	ids, err = list(&wagerpb.ListWagersRequest{Page: 1, Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 3, 4}, ids)
+
+	_, err = list(&wagerpb.ListWagersRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestListWagersEnds(t *testing.T) {
+	// the repository waits until the stream ends
+	started := make(chan struct{}, 2)
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Get", mock.Anything, 1, defaultPageSize).Return(nil, 0,
+		func(ctx context.Context, _, _ int) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+	recv := func(c wagerpb.WagerServiceClient) error {
+		stream, err := c.ListWagers(context.Background(), &wagerpb.ListWagersRequest{Page: 1})
+		require.NoError(t, err)
+
+		_, err = stream.Recv()
+		return err
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		c, _ := dial(t, New(mockRepo, WithStreamTimeout(10*time.Millisecond)))
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(recv(c)))
+		<-started
+	})
+
+	t.Run("close", func(t *testing.T) {
+		s := New(mockRepo)
+		c, _ := dial(t, s)
+
+		errs := make(chan error, 1)
+		go func() { errs <- recv(c) }()
+		<-started
+
+		// the stream is ended so the graceful stop does not wait for it
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, s.Close(ctx))
+		assert.Equal(t, codes.Canceled, status.Code(<-errs))
+	})
+}
+
+func TestHealth(t *testing.T) {
+	s := New(&mocks.WagerRepository{})
+	_, conn := dial(t, s)
+	health := healthpb.NewHealthClient(conn)
+
+	res, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Status)
+
+	s.Drain()
+	res, err = health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, res.Status)
+}
@@ -0,0 +1,156 @@
+// Package service holds the business rules of the wagers, the repository only stores their outcome
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/shopspring/decimal"
+
+	"wager/internal/domain"
+)
+
+type (
+	// Wagers reads and places the wagers, which needs no rule besides the validation of the request
+	Wagers interface {
+		Create(ctx context.Context, wager domain.Wager) (domain.Wager, error)
+		CreateBatch(ctx context.Context, wagers []domain.Wager) ([]domain.Wager, error)
+		Find(ctx context.Context, wagerID int) (domain.Wager, error)
+		Get(ctx context.Context, wagerID, limit int) ([]domain.Wager, int, error)
+		Close(ctx context.Context) error
+	}
+
+	// WagerService buys the wagers in a unit of work, the other methods are passed to the wagers.
+	// it is a domain.WagerRepository so the handlers and the middleware are unchanged
+	WagerService struct {
+		wagers Wagers
+		uow    domain.WagerUnitOfWork
+	}
+)
+
+// NewWagerService of the wagers which are changed in the units of work of uow
+func NewWagerService(wagers Wagers, uow domain.WagerUnitOfWork) *WagerService {
+	return &WagerService{
+		wagers: wagers,
+		uow:    uow,
+	}
+}
+
+// Create a wager
+func (s *WagerService) Create(ctx context.Context, wager domain.Wager) (domain.Wager, error) {
+	return s.wagers.Create(ctx, wager)
+}
+
+// CreateBatch creates the wagers at once
+func (s *WagerService) CreateBatch(ctx context.Context, wagers []domain.Wager) ([]domain.Wager, error) {
+	return s.wagers.CreateBatch(ctx, wagers)
+}
+
+// Find a wager
+func (s *WagerService) Find(ctx context.Context, wagerID int) (domain.Wager, error) {
+	return s.wagers.Find(ctx, wagerID)
+}
+
+// Get a page of wagers
+func (s *WagerService) Get(ctx context.Context, wagerID, limit int) ([]domain.Wager, int, error) {
+	return s.wagers.Get(ctx, wagerID, limit)
+}
+
+// Purchase a wager, it is locked so the concurrent purchases of the wager are made one by one
+func (s *WagerService) Purchase(ctx context.Context, wagerID int, buyingPrice decimal.Decimal) (domain.Purchase, error) {
+	purchase := domain.Purchase{}
+
+	err := s.uow.InTx(ctx, func(ctx context.Context, tx domain.WagerTx) error {
+		wager, err := tx.LockWager(ctx, wagerID)
+		if err != nil {
+			return err
+		}
+
+		purchase, err = buy(ctx, tx, wager, buyingPrice)
+		return err
+	})
+	if err != nil {
+		return domain.Purchase{}, err
+	}
+
+	return purchase, nil
+}
+
+// PurchaseBasket buys all the wagers in one unit of work, either all of them are bought or none
+// the wagers are locked in id order so concurrent baskets can not deadlock each other
+func (s *WagerService) PurchaseBasket(ctx context.Context, purchases []domain.Purchase) ([]domain.Purchase, error) {
+	res := make([]domain.Purchase, len(purchases))
+
+	ids := make([]int, 0, len(purchases))
+	for _, p := range purchases {
+		ids = append(ids, p.WagerID)
+	}
+	sort.Ints(ids)
+
+	err := s.uow.InTx(ctx, func(ctx context.Context, tx domain.WagerTx) error {
+		wagers := make(map[int]domain.Wager, len(ids))
+		for _, id := range ids {
+			wager, err := tx.LockWager(ctx, id)
+			if err != nil {
+				return err
+			}
+			wagers[id] = wager
+		}
+
+		for i, p := range purchases {
+			var err error
+			if res[i], err = buy(ctx, tx, wagers[p.WagerID], p.BuyingPrice); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Close the wagers
+func (s *WagerService) Close(ctx context.Context) error {
+	return s.wagers.Close(ctx)
+}
+
+// buy a locked wager, record the purchase and save the wager changed by its purchased event
+func buy(ctx context.Context, tx domain.WagerTx, wager domain.Wager, buyingPrice decimal.Decimal) (domain.Purchase, error) {
+	if err := wager.CanBuy(ctx, buyingPrice); err != nil {
+		return domain.Purchase{}, fmt.Errorf("wager %d: %w", wager.ID, err)
+	}
+
+	purchase, err := tx.InsertPurchase(ctx, domain.Purchase{WagerID: wager.ID, BuyingPrice: buyingPrice})
+	if err != nil {
+		return domain.Purchase{}, err
+	}
+
+	event, err := domain.NewWagerEvent(wager, domain.WagerPurchased, domain.WagerPurchasedData{Purchase: purchase})
+	if err != nil {
+		return domain.Purchase{}, err
+	}
+	event.OccurredAt = purchase.BoughtAt
+
+	after := wager
+	if err = after.Apply(event); err != nil {
+		return domain.Purchase{}, err
+	}
+
+	err = tx.SaveWager(ctx, domain.WagerChange{
+		Before:       wager,
+		After:        after,
+		Event:        event,
+		Action:       domain.AuditActionPurchased,
+		MarketEvents: domain.PurchasedMarketEvents(purchase, wager, after),
+	})
+	if err != nil {
+		return domain.Purchase{}, err
+	}
+
+	return purchase, nil
+}
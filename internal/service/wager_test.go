@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"wager/internal/domain"
+	"wager/internal/domain/mocks"
+	"wager/internal/testutil/memory"
+)
+
+func openWager(id int, price string) domain.Wager {
+	return domain.Wager{
+		ID:                  id,
+		TotalWagerValue:     10,
+		Odds:                2,
+		SellingPercentage:   50,
+		SellingPrice:        decimal.RequireFromString("10.00"),
+		CurrentSellingPrice: decimal.RequireFromString(price),
+		Status:              domain.WagerStatusOpen,
+		Version:             1,
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestPurchase(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		uow := memory.New(memory.WithWagers(openWager(1, "10.00")))
+		s := NewWagerService(&mocks.WagerRepository{}, uow)
+
+		purchase, err := s.Purchase(ctx, 1, decimal.RequireFromString("8.50"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, purchase.ID)
+		assert.Equal(t, 1, purchase.WagerID)
+
+		// the first purchase sets the amount sold to 0, the selling price follows the buying price
+		wager := uow.Wager(1)
+		assert.Equal(t, "8.5", wager.CurrentSellingPrice.String())
+		assert.Equal(t, intPtr(0), wager.AmountSold)
+		assert.Equal(t, intPtr(0), wager.PercentageSold)
+		assert.Equal(t, 2, wager.Version)
+
+		require.Len(t, uow.Changes(), 1)
+		change := uow.Changes()[0]
+		assert.Equal(t, openWager(1, "10.00"), change.Before)
+		assert.Equal(t, wager, change.After)
+		assert.Equal(t, domain.WagerPurchased, change.Event.Type)
+		assert.Equal(t, 2, change.Event.Version)
+		assert.Equal(t, purchase.BoughtAt, change.Event.OccurredAt)
+		assert.Equal(t, domain.AuditActionPurchased, change.Action)
+
+		types := []string{}
+		for _, e := range change.MarketEvents {
+			types = append(types, e.Type)
+		}
+		assert.Equal(t, []string{domain.MarketWagerPurchased, domain.MarketPriceChanged}, types)
+
+		// the market events of the wager are one outbox message
+		outbox := uow.Outbox()
+		require.Len(t, outbox, 1)
+		assert.Equal(t, change.MarketEvents, outbox[0].Events)
+	})
+
+	t.Run("sold amount", func(t *testing.T) {
+		wager := openWager(1, "10.00")
+		wager.AmountSold = intPtr(4)
+		wager.PercentageSold = intPtr(40)
+		uow := memory.New(memory.WithWagers(wager))
+		s := NewWagerService(&mocks.WagerRepository{}, uow)
+
+		_, err := s.Purchase(ctx, 1, decimal.RequireFromString("10.00"))
+		require.NoError(t, err)
+
+		assert.Equal(t, intPtr(5), uow.Wager(1).AmountSold)
+		assert.Equal(t, intPtr(50), uow.Wager(1).PercentageSold)
+		// the price is not changed so only the purchase is told
+		require.Len(t, uow.Changes()[0].MarketEvents, 1)
+	})
+
+	closed := openWager(2, "10.00")
+	closed.Status = domain.WagerStatusSettled
+
+	tcs := []struct {
+		name    string
+		wagerID int
+		price   string
+		err     error
+	}{
+		{name: "price too high", wagerID: 1, price: "10.01", err: domain.ErrBuyingPriceTooHigh},
+		{name: "closed", wagerID: 2, price: "1.00", err: domain.ErrWagerClosed},
+		{name: "not found", wagerID: 3, price: "1.00", err: domain.ErrWagerNotFound},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			uow := memory.New(memory.WithWagers(openWager(1, "10.00"), closed))
+			s := NewWagerService(&mocks.WagerRepository{}, uow)
+
+			_, err := s.Purchase(ctx, tc.wagerID, decimal.RequireFromString(tc.price))
+			assert.True(t, errors.Is(err, tc.err), err)
+			assert.Empty(t, uow.Purchases())
+			assert.Empty(t, uow.Changes())
+		})
+	}
+}
+
+func TestPurchaseBasket(t *testing.T) {
+	ctx := context.Background()
+
+	purchases := []domain.Purchase{
+		{WagerID: 3, BuyingPrice: decimal.RequireFromString("5.00")},
+		{WagerID: 1, BuyingPrice: decimal.RequireFromString("6.00")},
+		{WagerID: 2, BuyingPrice: decimal.RequireFromString("7.00")},
+	}
+
+	t.Run("success", func(t *testing.T) {
+		uow := memory.New(memory.WithWagers(openWager(1, "10.00"), openWager(2, "10.00"), openWager(3, "10.00")))
+		s := NewWagerService(&mocks.WagerRepository{}, uow)
+
+		res, err := s.PurchaseBasket(ctx, purchases)
+		require.NoError(t, err)
+
+		// the wagers are locked in id order and bought in the order of the basket
+		assert.Equal(t, []int{1, 2, 3}, uow.Locked())
+		require.Len(t, res, 3)
+		for i, p := range res {
+			assert.Equal(t, purchases[i].WagerID, p.WagerID)
+			assert.Equal(t, i+1, p.ID)
+			assert.True(t, purchases[i].BuyingPrice.Equal(uow.Wager(p.WagerID).CurrentSellingPrice))
+		}
+	})
+
+	t.Run("all or nothing", func(t *testing.T) {
+		uow := memory.New(memory.WithWagers(openWager(1, "10.00"), openWager(2, "6.00"), openWager(3, "10.00")))
+		s := NewWagerService(&mocks.WagerRepository{}, uow)
+
+		_, err := s.PurchaseBasket(ctx, purchases)
+		assert.True(t, errors.Is(err, domain.ErrBuyingPriceTooHigh), err)
+		assert.Empty(t, uow.Purchases())
+		assert.Equal(t, "10", uow.Wager(1).CurrentSellingPrice.String())
+	})
+
+	t.Run("save failed", func(t *testing.T) {
+		saveErr := errors.New("connection reset")
+		uow := memory.New(
+			memory.WithWagers(openWager(1, "10.00"), openWager(2, "10.00"), openWager(3, "10.00")),
+			memory.WithSaveError(saveErr),
+		)
+		s := NewWagerService(&mocks.WagerRepository{}, uow)
+
+		_, err := s.PurchaseBasket(ctx, purchases)
+		assert.Equal(t, saveErr, err)
+		assert.Empty(t, uow.Changes())
+		assert.Empty(t, uow.Outbox())
+	})
+}
+
+func TestReads(t *testing.T) {
+	ctx := context.Background()
+	wagers := &mocks.WagerRepository{}
+	s := NewWagerService(wagers, memory.New())
+
+	wagers.On("Find", mock.Anything, 1).Return(openWager(1, "10.00"), nil).Once()
+	wagers.On("Get", mock.Anything, 0, 10).Return([]domain.Wager{openWager(1, "10.00")}, 1, nil).Once()
+	wagers.On("Close", mock.Anything).Return(nil).Once()
+
+	wager, err := s.Find(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, wager.ID)
+
+	page, next, err := s.Get(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.Equal(t, 1, next)
+
+	require.NoError(t, s.Close(ctx))
+	wagers.AssertExpectations(t)
+}
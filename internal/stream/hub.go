@@ -0,0 +1,237 @@
+// Package stream fans the market events out to the clients which are listening
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wager/internal/domain"
+)
+
+// defaults of the hub
+const (
+	// DefaultHistory is the number of events kept for the clients which resume
+	DefaultHistory = 1024
+	// DefaultBuffer is the number of events a subscriber can fall behind before it is dropped
+	DefaultBuffer = 256
+)
+
+var (
+	// ErrSlowConsumer is the error of a subscription which is dropped because it did not keep up with the events
+	ErrSlowConsumer = errors.New("subscriber is too slow, resume from the last event id")
+	// ErrEventsMissed is the error of the subscriptions which are dropped because the hub missed some events
+	ErrEventsMissed = errors.New("events are missed, resume from the last event id")
+)
+
+type (
+	// Hub keeps the last events and delivers the new ones to the subscribers
+	// the events are given ids in the order they are published, an id is epoch-sequence
+	// where the epoch tells the hubs apart, so an id of another process is not resumed from
+	Hub struct {
+		mu     sync.Mutex
+		epoch  string
+		resets int
+		seq    uint64
+
+		// history is a ring of the last events, next is the index of the oldest one once it is full
+		history []domain.MarketEvent
+		next    int
+		full    bool
+
+		buffer int
+		subs   map[*Subscription]struct{}
+	}
+
+	// Filter selects the events of a subscription, an empty set matches everything
+	Filter struct {
+		Types    map[string]bool
+		WagerIDs map[int]bool
+	}
+
+	// Subscription is a subscriber of the hub
+	Subscription struct {
+		// Backlog are the events published after the last event id of the subscriber
+		Backlog []domain.MarketEvent
+		// Reset tells that the last event id is unknown or too old, so some events are missed
+		// and the client has to read the wagers again
+		Reset bool
+
+		hub    *Hub
+		filter Filter
+		ch     chan domain.MarketEvent
+		err    error
+	}
+)
+
+// NewHub keeps the last history events and lets every subscriber fall behind by buffer events
+func NewHub(history, buffer int) *Hub {
+	if history <= 0 {
+		history = DefaultHistory
+	}
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+
+	return &Hub{
+		epoch:   newEpoch(0),
+		history: make([]domain.MarketEvent, history),
+		buffer:  buffer,
+		subs:    map[*Subscription]struct{}{},
+	}
+}
+
+// Match tells whether the event is selected by the filter
+func (f Filter) Match(event domain.MarketEvent) bool {
+	return (len(f.Types) == 0 || f.Types[event.Type]) && (len(f.WagerIDs) == 0 || f.WagerIDs[event.WagerID])
+}
+
+// Publish gives the events their ids and delivers them, it never blocks nor fails
+// a subscriber whose buffer is full is dropped, it can resume from its last event
+func (h *Hub) Publish(ctx context.Context, events ...domain.MarketEvent) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, event := range events {
+		h.seq++
+		event.ID = fmt.Sprintf("%s-%d", h.epoch, h.seq)
+
+		h.history[h.next] = event
+		h.next = (h.next + 1) % len(h.history)
+		h.full = h.full || h.next == 0
+
+		for sub := range h.subs {
+			if !sub.filter.Match(event) {
+				continue
+			}
+
+			select {
+			case sub.ch <- event:
+			default:
+				h.drop(sub, ErrSlowConsumer)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Reset tells the hub that some events are missed, e.g. while the notifications were lost.
+// the history starts again in a new epoch, so the subscribers are dropped and resume with a reset
+// which makes the clients read the wagers again
+func (h *Hub) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.resets++
+	h.epoch = newEpoch(h.resets)
+	h.seq = 0
+	h.next = 0
+	h.full = false
+
+	for sub := range h.subs {
+		h.drop(sub, ErrEventsMissed)
+	}
+}
+
+// newEpoch tells apart the hubs of the processes and the resets of a hub
+func newEpoch(resets int) string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "." + strconv.Itoa(resets)
+}
+
+// Subscribe to the events which match the filter
+// with a last event id, the events published after it are in the backlog of the subscription
+func (h *Hub) Subscribe(filter Filter, lastEventID string) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &Subscription{
+		hub:    h,
+		filter: filter,
+		ch:     make(chan domain.MarketEvent, h.buffer),
+	}
+
+	if lastEventID != "" {
+		sub.Backlog, sub.Reset = h.since(lastEventID, filter)
+	}
+
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// since returns the events after the last event id, reset is set when some of them are not kept anymore
+func (h *Hub) since(lastEventID string, filter Filter) (events []domain.MarketEvent, reset bool) {
+	i := strings.LastIndexByte(lastEventID, '-')
+	if i < 0 || lastEventID[:i] != h.epoch {
+		return nil, true
+	}
+
+	last, err := strconv.ParseUint(lastEventID[i+1:], 10, 64)
+	if err != nil || last > h.seq {
+		return nil, true
+	}
+
+	kept := uint64(h.next)
+	if h.full {
+		kept = uint64(len(h.history))
+	}
+	oldest := h.seq - kept + 1
+	if last+1 < oldest {
+		reset = true
+		last = oldest - 1
+	}
+
+	for seq := last + 1; seq <= h.seq; seq++ {
+		// the event of seq is at (seq-1) in the ring
+		event := h.history[(seq-1)%uint64(len(h.history))]
+		if filter.Match(event) {
+			events = append(events, event)
+		}
+	}
+
+	return events, reset
+}
+
+// drop the subscription, its channel is closed, it must be called with the lock
+func (h *Hub) drop(sub *Subscription, err error) {
+	if _, ok := h.subs[sub]; !ok {
+		return
+	}
+
+	delete(h.subs, sub)
+	sub.err = err
+	close(sub.ch)
+}
+
+// Subscribers is the number of subscriptions of the hub
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subs)
+}
+
+// Events are the new events of the subscription, the channel is closed once it is dropped
+func (s *Subscription) Events() <-chan domain.MarketEvent {
+	return s.ch
+}
+
+// Err tells why the subscription is dropped, it is set once the channel of the events is closed
+func (s *Subscription) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	return s.err
+}
+
+// Close the subscription
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.drop(s, nil)
+}
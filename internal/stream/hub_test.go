@@ -0,0 +1,150 @@
+package stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"wager/internal/domain"
+)
+
+func placed(ids ...int) []domain.MarketEvent {
+	wagers := make([]domain.Wager, 0, len(ids))
+	for _, id := range ids {
+		wagers = append(wagers, domain.Wager{ID: id})
+	}
+
+	return domain.PlacedMarketEvents(wagers...)
+}
+
+func wagerIDs(events []domain.MarketEvent) []int {
+	ids := []int{}
+	for _, event := range events {
+		ids = append(ids, event.WagerID)
+	}
+
+	return ids
+}
+
+func TestPublish(t *testing.T) {
+	hub := NewHub(8, 8)
+
+	all := hub.Subscribe(Filter{}, "")
+	defer all.Close()
+	one := hub.Subscribe(Filter{WagerIDs: map[int]bool{2: true}}, "")
+	defer one.Close()
+	sold := hub.Subscribe(Filter{Types: map[string]bool{domain.MarketSoldOut: true}}, "")
+	defer sold.Close()
+
+	hub.Publish(context.Background(), placed(1, 2, 3)...)
+
+	for _, id := range []int{1, 2, 3} {
+		event := <-all.Events()
+		assert.Equal(t, id, event.WagerID)
+		assert.NotEmpty(t, event.ID)
+	}
+
+	event := <-one.Events()
+	assert.Equal(t, 2, event.WagerID)
+
+	assert.Len(t, one.Events(), 0)
+	assert.Len(t, sold.Events(), 0)
+	assert.Equal(t, 3, hub.Subscribers())
+}
+
+func TestSlowConsumer(t *testing.T) {
+	hub := NewHub(8, 2)
+
+	sub := hub.Subscribe(Filter{}, "")
+	hub.Publish(context.Background(), placed(1, 2, 3)...)
+
+	// the buffered events are still delivered before the channel is closed
+	assert.Equal(t, 1, (<-sub.Events()).WagerID)
+	assert.Equal(t, 2, (<-sub.Events()).WagerID)
+	_, ok := <-sub.Events()
+	assert.False(t, ok)
+	assert.Equal(t, ErrSlowConsumer, sub.Err())
+	assert.Equal(t, 0, hub.Subscribers())
+
+	// the dropped subscription can be closed again
+	sub.Close()
+}
+
+func TestResume(t *testing.T) {
+	hub := NewHub(4, 8)
+
+	sub := hub.Subscribe(Filter{}, "")
+	hub.Publish(context.Background(), placed(1, 2, 3)...)
+	first := <-sub.Events()
+	sub.Close()
+
+	resumed := hub.Subscribe(Filter{}, first.ID)
+	defer resumed.Close()
+	assert.False(t, resumed.Reset)
+	assert.Equal(t, []int{2, 3}, wagerIDs(resumed.Backlog))
+
+	filtered := hub.Subscribe(Filter{WagerIDs: map[int]bool{3: true}}, first.ID)
+	defer filtered.Close()
+	assert.Equal(t, []int{3}, wagerIDs(filtered.Backlog))
+
+	// only the last 4 events are kept, so the events after the first one are partly missed
+	hub.Publish(context.Background(), placed(4, 5, 6)...)
+	late := hub.Subscribe(Filter{}, first.ID)
+	defer late.Close()
+	assert.True(t, late.Reset)
+	assert.Equal(t, []int{3, 4, 5, 6}, wagerIDs(late.Backlog))
+
+	tcs := []struct {
+		name        string
+		lastEventID string
+	}{
+		{name: "another hub", lastEventID: NewHub(0, 0).epoch + "-1"},
+		{name: "malformed", lastEventID: "abc"},
+		{name: "ahead", lastEventID: hub.epoch + "-100"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			sub := hub.Subscribe(Filter{}, tc.lastEventID)
+			defer sub.Close()
+			assert.True(t, sub.Reset)
+			assert.Empty(t, sub.Backlog)
+		})
+	}
+
+	current := hub.Subscribe(Filter{}, late.Backlog[3].ID)
+	defer current.Close()
+	require.False(t, current.Reset)
+	assert.Empty(t, current.Backlog)
+}
+
+func TestReset(t *testing.T) {
+	hub := NewHub(4, 8)
+
+	sub := hub.Subscribe(Filter{}, "")
+	hub.Publish(context.Background(), placed(1)...)
+	last := <-sub.Events()
+
+	// the subscribers are dropped and resume from an event before the gap with a reset
+	hub.Reset()
+	_, ok := <-sub.Events()
+	assert.False(t, ok)
+	assert.Equal(t, ErrEventsMissed, sub.Err())
+	assert.Zero(t, hub.Subscribers())
+
+	hub.Publish(context.Background(), placed(2)...)
+	resumed := hub.Subscribe(Filter{}, last.ID)
+	defer resumed.Close()
+	assert.True(t, resumed.Reset)
+	assert.Empty(t, resumed.Backlog)
+
+	// the events after the reset are resumed as usual
+	hub.Publish(context.Background(), placed(3)...)
+	next := <-resumed.Events()
+	again := hub.Subscribe(Filter{}, next.ID)
+	defer again.Close()
+	assert.False(t, again.Reset)
+	assert.Empty(t, again.Backlog)
+}
@@ -0,0 +1,387 @@
+// Package memory is a repository in memory which follows the rules of the postgres one, it is only
+// imported by the tests of the service, the outbox relay and the webhook dispatcher
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"wager/internal/domain"
+)
+
+type (
+	// Repository keeps the wagers, the outbox and the webhook deliveries in memory.
+	// a unit of work holds the repository until it ends, its changes are applied when it succeeds
+	Repository struct {
+		mu sync.Mutex
+
+		wagers    map[int]domain.Wager
+		purchases []domain.Purchase
+		changes   []domain.WagerChange
+		locked    []int
+		saveErr   error
+
+		messages        []domain.OutboxMessage
+		lastMessageID   int64
+		claimedMessages map[int64]bool
+		retryAt         map[int64]time.Duration
+
+		deliveries        map[int64]*domain.WebhookDelivery
+		claimedDeliveries map[int64]bool
+		attempts          []domain.WebhookAttempt
+		enqueued          []domain.MarketEvent
+	}
+
+	// Option configures the repository
+	Option func(r *Repository)
+
+	// tx buffers the changes of a unit of work
+	tx struct {
+		r         *Repository
+		wagers    map[int]domain.Wager
+		purchases []domain.Purchase
+		changes   []domain.WagerChange
+		messages  []domain.OutboxMessage
+	}
+)
+
+// WithWagers stores the wagers
+func WithWagers(wagers ...domain.Wager) Option {
+	return func(r *Repository) {
+		for _, wager := range wagers {
+			r.wagers[wager.ID] = wager
+		}
+	}
+}
+
+// WithOutbox stores the outbox messages, they are claimed in this order
+func WithOutbox(messages ...domain.OutboxMessage) Option {
+	return func(r *Repository) {
+		r.addOutbox(messages...)
+	}
+}
+
+// WithDeliveries stores the webhook deliveries
+func WithDeliveries(deliveries ...domain.WebhookDelivery) Option {
+	return func(r *Repository) {
+		r.addDeliveries(deliveries...)
+	}
+}
+
+// WithSaveError fails every SaveWager with err
+func WithSaveError(err error) Option {
+	return func(r *Repository) {
+		r.saveErr = err
+	}
+}
+
+// New repository in memory
+func New(opts ...Option) *Repository {
+	r := &Repository{
+		wagers:            map[int]domain.Wager{},
+		claimedMessages:   map[int64]bool{},
+		retryAt:           map[int64]time.Duration{},
+		deliveries:        map[int64]*domain.WebhookDelivery{},
+		claimedDeliveries: map[int64]bool{},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// InTx runs fn in a unit of work, no other unit of work runs meanwhile
+func (r *Repository) InTx(ctx context.Context, fn func(ctx context.Context, tx domain.WagerTx) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := &tx{r: r, wagers: map[int]domain.Wager{}}
+	if err := fn(ctx, t); err != nil {
+		return err
+	}
+
+	for id, wager := range t.wagers {
+		r.wagers[id] = wager
+	}
+	r.purchases = append(r.purchases, t.purchases...)
+	r.changes = append(r.changes, t.changes...)
+	r.addOutbox(t.messages...)
+
+	return nil
+}
+
+// LockWager reads the wager, the locks are recorded in order
+func (t *tx) LockWager(ctx context.Context, wagerID int) (domain.Wager, error) {
+	t.r.locked = append(t.r.locked, wagerID)
+
+	if wager, ok := t.wagers[wagerID]; ok {
+		return wager, nil
+	}
+
+	wager, ok := t.r.wagers[wagerID]
+	if !ok {
+		return wager, fmt.Errorf("wager %d: %w", wagerID, domain.ErrWagerNotFound)
+	}
+
+	return wager, nil
+}
+
+// InsertPurchase gives the purchase the next id, it is bought a second after the previous one
+func (t *tx) InsertPurchase(ctx context.Context, purchase domain.Purchase) (domain.Purchase, error) {
+	purchase.ID = len(t.r.purchases) + len(t.purchases) + 1
+	purchase.BoughtAt = time.Date(2020, 10, 1, 0, 0, purchase.ID, 0, time.UTC)
+	t.purchases = append(t.purchases, purchase)
+
+	return purchase, nil
+}
+
+// SaveWager saves the wager and writes its market events to the outbox, a message for every wager
+func (t *tx) SaveWager(ctx context.Context, change domain.WagerChange) error {
+	if t.r.saveErr != nil {
+		return t.r.saveErr
+	}
+
+	t.wagers[change.After.ID] = change.After
+	t.changes = append(t.changes, change)
+
+	byWager := map[int]int{}
+	for _, e := range change.MarketEvents {
+		i, ok := byWager[e.WagerID]
+		if !ok {
+			i = len(t.messages)
+			byWager[e.WagerID] = i
+			t.messages = append(t.messages, domain.OutboxMessage{WagerID: e.WagerID})
+		}
+		t.messages[i].Events = append(t.messages[i].Events, e)
+	}
+
+	return nil
+}
+
+// ClaimOutbox takes the oldest message of up to limit wagers, a claimed message is not taken again
+// until its attempt is recorded
+func (r *Repository) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]domain.OutboxMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	claimed := []domain.OutboxMessage{}
+	seen := map[int]bool{}
+	for _, msg := range r.messages {
+		// only the oldest message of a wager is taken
+		oldest := !seen[msg.WagerID]
+		seen[msg.WagerID] = true
+		if oldest && !r.claimedMessages[msg.ID] && len(claimed) < limit {
+			r.claimedMessages[msg.ID] = true
+			claimed = append(claimed, msg)
+		}
+	}
+
+	return claimed, nil
+}
+
+// RecordOutbox removes the published messages, the failed ones are kept with their RetryAfter
+func (r *Repository) RecordOutbox(ctx context.Context, attempts ...domain.OutboxAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	published := map[int64]bool{}
+	for _, attempt := range attempts {
+		delete(r.claimedMessages, attempt.MessageID)
+		if attempt.Error == "" {
+			published[attempt.MessageID] = true
+			continue
+		}
+		r.retryAt[attempt.MessageID] = attempt.RetryAfter
+		for i := range r.messages {
+			if r.messages[i].ID == attempt.MessageID {
+				r.messages[i].Attempts++
+			}
+		}
+	}
+
+	kept := r.messages[:0]
+	for _, msg := range r.messages {
+		if !published[msg.ID] {
+			kept = append(kept, msg)
+		}
+	}
+	r.messages = kept
+
+	return nil
+}
+
+// EnqueueWebhooks records the events
+func (r *Repository) EnqueueWebhooks(ctx context.Context, events ...domain.MarketEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.enqueued = append(r.enqueued, events...)
+	return nil
+}
+
+// ClaimWebhookDeliveries takes up to limit pending deliveries in id order,
+// a claimed delivery is not taken again until its attempt is recorded
+func (r *Repository) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]domain.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]int64, 0, len(r.deliveries))
+	for id := range r.deliveries {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	claimed := []domain.WebhookDelivery{}
+	for _, id := range ids {
+		d := r.deliveries[id]
+		if len(claimed) < limit && d.Status == domain.WebhookDeliveryPending && !r.claimedDeliveries[id] {
+			r.claimedDeliveries[id] = true
+			claimed = append(claimed, *d)
+		}
+	}
+
+	return claimed, nil
+}
+
+// RecordWebhookAttempt counts the attempt, the delivery is delivered when it succeeds and dead when it is given up
+func (r *Repository) RecordWebhookAttempt(ctx context.Context, attempt domain.WebhookAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.deliveries[attempt.DeliveryID]
+	if !ok {
+		return fmt.Errorf("webhook delivery %d is not found", attempt.DeliveryID)
+	}
+
+	d.Attempts++
+	switch {
+	case attempt.Error == "":
+		d.Status = domain.WebhookDeliveryDelivered
+	case attempt.Dead:
+		d.Status = domain.WebhookDeliveryDead
+	}
+	delete(r.claimedDeliveries, attempt.DeliveryID)
+	r.attempts = append(r.attempts, attempt)
+
+	return nil
+}
+
+// AddOutbox stores the outbox messages after the ones which are stored, a message without an id gets the next one
+func (r *Repository) AddOutbox(messages ...domain.OutboxMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.addOutbox(messages...)
+}
+
+func (r *Repository) addOutbox(messages ...domain.OutboxMessage) {
+	for _, msg := range messages {
+		if msg.ID == 0 {
+			msg.ID = r.lastMessageID + 1
+		}
+		if msg.ID > r.lastMessageID {
+			r.lastMessageID = msg.ID
+		}
+		r.messages = append(r.messages, msg)
+	}
+}
+
+// AddDeliveries stores the webhook deliveries
+func (r *Repository) AddDeliveries(deliveries ...domain.WebhookDelivery) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.addDeliveries(deliveries...)
+}
+
+func (r *Repository) addDeliveries(deliveries ...domain.WebhookDelivery) {
+	for i := range deliveries {
+		d := deliveries[i]
+		r.deliveries[d.ID] = &d
+	}
+}
+
+// Wager is the stored wager
+func (r *Repository) Wager(wagerID int) domain.Wager {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.wagers[wagerID]
+}
+
+// Purchases are the stored purchases
+func (r *Repository) Purchases() []domain.Purchase {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]domain.Purchase(nil), r.purchases...)
+}
+
+// Changes are the saved changes of the wagers
+func (r *Repository) Changes() []domain.WagerChange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]domain.WagerChange(nil), r.changes...)
+}
+
+// Locked are the ids of the locked wagers in the order they were locked
+func (r *Repository) Locked() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]int(nil), r.locked...)
+}
+
+// Outbox are the messages which are not published yet
+func (r *Repository) Outbox() []domain.OutboxMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]domain.OutboxMessage(nil), r.messages...)
+}
+
+// RetryAfter is the RetryAfter of the last failed attempt of every message which failed
+func (r *Repository) RetryAfter() map[int64]time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	retryAt := make(map[int64]time.Duration, len(r.retryAt))
+	for id, after := range r.retryAt {
+		retryAt[id] = after
+	}
+
+	return retryAt
+}
+
+// Delivery is the stored webhook delivery
+func (r *Repository) Delivery(id int64) domain.WebhookDelivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if d, ok := r.deliveries[id]; ok {
+		return *d
+	}
+	return domain.WebhookDelivery{}
+}
+
+// WebhookAttempts are the recorded attempts of the webhook deliveries
+func (r *Repository) WebhookAttempts() []domain.WebhookAttempt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]domain.WebhookAttempt(nil), r.attempts...)
+}
+
+// Enqueued are the events enqueued to the webhooks
+func (r *Repository) Enqueued() []domain.MarketEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]domain.MarketEvent(nil), r.enqueued...)
+}
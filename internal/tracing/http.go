@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/semconv"
+)
+
+// Middleware starts a server span for every request
+// the span continues the trace of the W3C traceparent header of the request
+func Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		req := ctx.Request()
+		parent := global.TextMapPropagator().Extract(req.Context(), req.Header)
+
+		route := ctx.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		spanCtx, span := global.Tracer(serviceName).Start(parent, req.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest(serviceName, route, req)...),
+		)
+		defer span.End()
+
+		ctx.SetRequest(req.WithContext(spanCtx))
+
+		// the caller can join its logs to the trace
+		global.TextMapPropagator().Inject(spanCtx, ctx.Response().Header())
+
+		err := next(ctx)
+
+		status := ctx.Response().Status
+		if err != nil {
+			span.RecordError(spanCtx, err)
+
+			var httpErr *echo.HTTPError
+			if errors.As(err, &httpErr) {
+				status = httpErr.Code
+			} else {
+				status = http.StatusInternalServerError
+			}
+		}
+
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(status))
+
+		return err
+	}
+}
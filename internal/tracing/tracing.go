@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/stdout"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/propagators"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+
+	"wager/config"
+)
+
+const (
+	serviceName = "wager"
+)
+
+// Setup installs the tracer provider of the configured exporter and the W3C trace context propagator
+// the returned func flushes the pending spans and closes the exporter
+func Setup(cfg config.Tracing) (func(context.Context) error, error) {
+	global.SetTextMapPropagator(otel.NewCompositeTextMapPropagator(propagators.TraceContext{}, propagators.Baggage{}))
+
+	exporter, closer, err := newExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	processor := sdktrace.NewBatchSpanProcessor(exporter)
+	global.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithConfig(sdktrace.Config{
+			// a trace started by the caller is recorded as the caller decided
+			DefaultSampler: sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio)),
+		}),
+		sdktrace.WithResource(resource.New(semconv.ServiceNameKey.String(serviceName))),
+		sdktrace.WithSpanProcessor(processor),
+	))
+
+	return func(ctx context.Context) error {
+		processor.Shutdown()
+		if err := exporter.Shutdown(ctx); err != nil {
+			return err
+		}
+
+		if closer != nil {
+			return closer.Close()
+		}
+
+		return nil
+	}, nil
+}
+
+// newExporter returns nil when the tracing is off, the closer is the file of the file exporter
+func newExporter(cfg config.Tracing) (export.SpanExporter, io.Closer, error) {
+	switch cfg.Exporter {
+	case config.TracingExporterStdout:
+		exporter, err := stdout.NewExporter(stdout.WithWriter(os.Stdout), stdout.WithoutMetricExport())
+		return exporter, nil, err
+	case config.TracingExporterFile:
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		exporter, err := stdout.NewExporter(stdout.WithWriter(f), stdout.WithoutMetricExport())
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return exporter, f, nil
+	case config.TracingExporterOTLP:
+		exporter, err := otlp.NewExporter(otlp.WithInsecure(), otlp.WithAddress(cfg.Endpoint))
+		return exporter, nil, err
+	default:
+		return nil, nil, nil
+	}
+}
+
+// Start a span named name as a child of the span in ctx
+func Start(ctx context.Context, name string, attrs ...label.KeyValue) (context.Context, trace.Span) {
+	return global.Tracer(serviceName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End the span, the span fails when err is not nil
+func End(ctx context.Context, span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(ctx, err, trace.WithErrorStatus(codes.Error))
+	}
+	span.End()
+}
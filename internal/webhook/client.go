@@ -0,0 +1,140 @@
+package webhook
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned when the url of a webhook is an address of the service's own network
+var ErrBlockedAddress = errors.New("address is blocked")
+
+// blockedNetworks are the loopback, private, link local and metadata addresses, a partner can not make
+// the dispatcher post to them
+var blockedNetworks = mustParseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+)
+
+// statusError is a response other than 2xx
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("response status %d", int(e))
+}
+
+// NewHTTPClient posts the deliveries with timeout, it does not connect to the blocked networks
+// unless they are in allowed. The address is checked once it is resolved, so a name which resolves
+// to a blocked address is blocked too, and the proxies of the environment are not used
+func NewHTTPClient(timeout time.Duration, allowed ...*net.IPNet) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			return checkAddress(address, allowed)
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// ParseNetworks parses the networks in CIDR notation
+func ParseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func mustParseNetworks(cidrs ...string) []*net.IPNet {
+	networks, err := ParseNetworks(cidrs)
+	if err != nil {
+		panic(err)
+	}
+
+	return networks
+}
+
+// checkAddress fails when the host of address is in a blocked network and not in an allowed one
+func checkAddress(address string, allowed []*net.IPNet) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%s: %w", host, ErrBlockedAddress)
+	}
+
+	for _, network := range allowed {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return fmt.Errorf("%s: %w", ip, ErrBlockedAddress)
+		}
+	}
+
+	return nil
+}
+
+// errorClass is what is stored of a failed attempt, the partner can read it so the details of the
+// transport are only logged
+func errorClass(err error) string {
+	var (
+		status     statusError
+		dnsErr     *net.DNSError
+		netErr     net.Error
+		certErr    x509.UnknownAuthorityError
+		hostErr    x509.HostnameError
+		invalidErr x509.CertificateInvalidError
+	)
+
+	switch {
+	case errors.As(err, &status):
+		return status.Error()
+	case errors.Is(err, ErrBlockedAddress):
+		return "blocked address"
+	case errors.As(err, &dnsErr):
+		return "dns lookup failed"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.As(err, &certErr), errors.As(err, &hostErr), errors.As(err, &invalidErr):
+		return "invalid certificate"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	default:
+		return "request failed"
+	}
+}
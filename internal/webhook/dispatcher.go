@@ -0,0 +1,269 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"wager/internal/domain"
+	"wager/internal/logging"
+	"wager/internal/metrics"
+)
+
+// defaults of the dispatcher
+const (
+	DefaultInterval    = time.Second
+	DefaultMaxBackoff  = time.Hour
+	DefaultMaxAttempts = 12
+	DefaultBatchSize   = 20
+	DefaultTimeout     = 10 * time.Second
+
+	// maxResponseBody is how much of a response is read, so the connection can be reused
+	maxResponseBody = 4 << 10
+	userAgent       = "wager-webhooks"
+)
+
+type (
+	// Store keeps the deliveries of the webhooks
+	Store interface {
+		// EnqueueWebhooks writes a delivery of every event to the webhooks which subscribe to it,
+		// an event which is enqueued again is ignored
+		EnqueueWebhooks(ctx context.Context, events ...domain.MarketEvent) error
+		// ClaimWebhookDeliveries takes the pending deliveries which are due for lease
+		ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]domain.WebhookDelivery, error)
+		// RecordWebhookAttempt writes the outcome of an attempt
+		RecordWebhookAttempt(ctx context.Context, attempt domain.WebhookAttempt) error
+	}
+
+	// Dispatcher enqueues the market events for the webhooks and posts them
+	// a failed delivery is retried with a backoff and is dead after max attempts
+	Dispatcher struct {
+		store       Store
+		client      *http.Client
+		logger      *zap.Logger
+		interval    time.Duration
+		maxBackoff  time.Duration
+		maxAttempts int
+		batchSize   int
+		wake        chan struct{}
+	}
+
+	// Option configures the dispatcher
+	Option func(d *Dispatcher)
+)
+
+// WithLogger logs the failed deliveries
+func WithLogger(logger *zap.Logger) Option {
+	return func(d *Dispatcher) {
+		d.logger = logger
+	}
+}
+
+// WithHTTPClient posts the deliveries with client, its timeout is the timeout of a delivery.
+// the client of NewHTTPClient is used by default, another client may post to any address
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.client = client
+	}
+}
+
+// WithInterval polls the deliveries every interval, a failed delivery is retried after interval
+// and then twice as late every time up to maxBackoff
+func WithInterval(interval, maxBackoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.interval = interval
+		d.maxBackoff = maxBackoff
+	}
+}
+
+// WithMaxAttempts is the number of attempts before a delivery is dead
+func WithMaxAttempts(n int) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts = n
+	}
+}
+
+// WithBatchSize posts up to n deliveries at once
+func WithBatchSize(n int) Option {
+	return func(d *Dispatcher) {
+		d.batchSize = n
+	}
+}
+
+// NewDispatcher of the deliveries of store
+func NewDispatcher(store Store, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		store:       store,
+		client:      NewHTTPClient(DefaultTimeout),
+		logger:      zap.NewNop(),
+		interval:    DefaultInterval,
+		maxBackoff:  DefaultMaxBackoff,
+		maxAttempts: DefaultMaxAttempts,
+		batchSize:   DefaultBatchSize,
+		wake:        make(chan struct{}, 1),
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// Publish enqueues the events for the webhooks, so the dispatcher is a publisher of the outbox relay
+func (d *Dispatcher) Publish(ctx context.Context, events ...domain.MarketEvent) error {
+	if err := d.store.EnqueueWebhooks(ctx, events...); err != nil {
+		return err
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Run posts the deliveries until ctx is done, it wakes up at once when events are enqueued
+func (d *Dispatcher) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-timer.C:
+		}
+
+		n, err := d.DispatchOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			d.logger.Error("Dispatch webhooks failed", logging.Error(err))
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if err == nil && n == d.batchSize {
+			timer.Reset(0)
+		} else {
+			timer.Reset(d.interval)
+		}
+	}
+}
+
+// DispatchOnce posts a batch of the due deliveries at once and returns its size
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	deliveries, err := d.store.ClaimWebhookDeliveries(ctx, d.batchSize, d.lease())
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery domain.WebhookDelivery) {
+			defer wg.Done()
+
+			attempt := d.send(ctx, delivery)
+			if err := d.store.RecordWebhookAttempt(ctx, attempt); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(delivery)
+	}
+	wg.Wait()
+
+	return len(deliveries), firstErr
+}
+
+// send posts a delivery signed with the secret of its webhook, a 2xx response is a success
+func (d *Dispatcher) send(ctx context.Context, delivery domain.WebhookDelivery) domain.WebhookAttempt {
+	attempt := domain.WebhookAttempt{DeliveryID: delivery.ID}
+
+	err := func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set(HeaderEvent, delivery.EventType)
+		req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+		req.Header.Set(HeaderSignature, Sign(delivery.Secret, time.Now(), delivery.Payload))
+
+		res, err := d.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, maxResponseBody))
+
+		attempt.ResponseStatus = res.StatusCode
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return statusError(res.StatusCode)
+		}
+
+		return nil
+	}()
+
+	outcome := metrics.WebhookDelivered
+	if err != nil {
+		attempt.Error = errorClass(err)
+		attempt.Dead = delivery.Attempts+1 >= d.maxAttempts
+		attempt.RetryAfter = d.backoff(delivery.Attempts + 1)
+
+		outcome = metrics.WebhookFailed
+		if attempt.Dead {
+			outcome = metrics.WebhookDead
+		}
+
+		d.logger.Warn("Deliver webhook failed", zap.Int64("delivery_id", delivery.ID),
+			zap.Int("webhook_id", delivery.WebhookID), zap.Int("attempts", delivery.Attempts+1),
+			zap.Bool("dead", attempt.Dead), logging.Error(err))
+	}
+	metrics.ObserveWebhook(outcome)
+
+	return attempt
+}
+
+// backoff doubles the interval with every failed attempt up to maxBackoff
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	b := d.interval
+	for i := 1; i < attempts && b < d.maxBackoff; i++ {
+		b *= 2
+	}
+
+	if b > d.maxBackoff {
+		b = d.maxBackoff
+	}
+
+	return b
+}
+
+// lease is long enough for a delivery to be posted and recorded
+func (d *Dispatcher) lease() time.Duration {
+	if d.client.Timeout > 0 {
+		return 2*d.client.Timeout + d.interval
+	}
+
+	return time.Minute
+}
@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"wager/internal/domain"
+	"wager/internal/testutil/memory"
+)
+
+func TestDispatch(t *testing.T) {
+	const secret = "0123456789abcdef"
+	payload := []byte(`{"id":"1-1","type":"sold_out","wager_id":1}`)
+
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		if err := Verify(secret, r.Header.Get(HeaderSignature), body, time.Minute, time.Now()); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		mu.Lock()
+		received = append(received, r.Header.Get(HeaderDelivery)+" "+r.Header.Get(HeaderEvent))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	delivery := func(id int64, path string, attempts int) domain.WebhookDelivery {
+		return domain.WebhookDelivery{
+			ID:        id,
+			WebhookID: 1,
+			EventID:   "1-1",
+			EventType: domain.MarketSoldOut,
+			Payload:   payload,
+			Status:    domain.WebhookDeliveryPending,
+			Attempts:  attempts,
+			URL:       srv.URL + path,
+			Secret:    secret,
+		}
+	}
+
+	store := memory.New(memory.WithDeliveries(
+		delivery(1, "/hooks", 0),
+		delivery(2, "/down", 0),
+		delivery(3, "/down", 2),
+	))
+	d := NewDispatcher(store, WithMaxAttempts(3), WithInterval(time.Second, time.Minute), WithHTTPClient(srv.Client()))
+
+	n, err := d.DispatchOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	assert.Equal(t, []string{"1 sold_out"}, received)
+	assert.Equal(t, domain.WebhookDeliveryDelivered, store.Delivery(1).Status)
+	assert.Equal(t, domain.WebhookDeliveryPending, store.Delivery(2).Status)
+	assert.Equal(t, domain.WebhookDeliveryDead, store.Delivery(3).Status)
+
+	for _, attempt := range store.WebhookAttempts() {
+		switch attempt.DeliveryID {
+		case 1:
+			assert.Equal(t, http.StatusNoContent, attempt.ResponseStatus)
+			assert.Empty(t, attempt.Error)
+		case 2:
+			assert.Equal(t, http.StatusServiceUnavailable, attempt.ResponseStatus)
+			assert.Equal(t, "response status 503", attempt.Error)
+			assert.Equal(t, time.Second, attempt.RetryAfter)
+			assert.False(t, attempt.Dead)
+		case 3:
+			assert.True(t, attempt.Dead)
+		}
+	}
+}
+
+func TestDispatcherBackoff(t *testing.T) {
+	d := NewDispatcher(memory.New(), WithInterval(time.Second, 10*time.Second))
+
+	assert.Equal(t, time.Second, d.backoff(1))
+	assert.Equal(t, 4*time.Second, d.backoff(3))
+	assert.Equal(t, 10*time.Second, d.backoff(5))
+}
+
+func TestDispatcherRun(t *testing.T) {
+	delivered := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer srv.Close()
+
+	store := memory.New()
+	d := NewDispatcher(store, WithInterval(time.Hour, time.Hour), WithHTTPClient(srv.Client()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// the first poll finds nothing, the published event wakes the dispatcher up before the interval
+	time.Sleep(10 * time.Millisecond)
+	store.AddDeliveries(domain.WebhookDelivery{ID: 1, Status: domain.WebhookDeliveryPending, URL: srv.URL})
+	require.NoError(t, d.Publish(context.Background(), domain.MarketEvent{ID: "1-1"}))
+
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Fatal("the delivery is not sent")
+	}
+	assert.Len(t, store.Enqueued(), 1)
+}
+
+func TestDispatchBlockedAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	loopback, err := ParseNetworks([]string{"127.0.0.0/8"})
+	require.NoError(t, err)
+
+	tcs := []struct {
+		name   string
+		client *http.Client
+		err    string
+	}{
+		{name: "blocked", client: NewHTTPClient(time.Second), err: "blocked address"},
+		{name: "allowed", client: NewHTTPClient(time.Second, loopback...)},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			store := memory.New(memory.WithDeliveries(domain.WebhookDelivery{ID: 1, Status: domain.WebhookDeliveryPending, URL: srv.URL}))
+			d := NewDispatcher(store, WithHTTPClient(tc.client))
+
+			_, err := d.DispatchOnce(context.Background())
+			require.NoError(t, err)
+			attempts := store.WebhookAttempts()
+			require.Len(t, attempts, 1)
+			assert.Equal(t, tc.err, attempts[0].Error)
+		})
+	}
+}
+
+func TestCheckAddress(t *testing.T) {
+	tcs := []struct {
+		address string
+		blocked bool
+	}{
+		{address: "93.184.216.34:443"},
+		{address: "[2606:2800:220:1:248:1893:25c8:1946]:443"},
+		{address: "127.0.0.1:80", blocked: true},
+		{address: "10.1.2.3:80", blocked: true},
+		{address: "172.16.0.1:80", blocked: true},
+		{address: "192.168.1.1:80", blocked: true},
+		{address: "169.254.169.254:80", blocked: true},
+		{address: "[::1]:80", blocked: true},
+		{address: "[::ffff:127.0.0.1]:80", blocked: true},
+		{address: "[fe80::1]:80", blocked: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.address, func(t *testing.T) {
+			err := checkAddress(tc.address, nil)
+			assert.Equal(t, tc.blocked, errors.Is(err, ErrBlockedAddress), err)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Package webhook posts the market events to the webhooks of the partners
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// headers of a delivery
+const (
+	// HeaderSignature is t=<unix time>,v1=<hex hmac-sha256 of "<unix time>.<body>" keyed by the secret>
+	HeaderSignature = "X-Wager-Signature"
+	HeaderEvent     = "X-Wager-Event"
+	HeaderDelivery  = "X-Wager-Delivery"
+)
+
+var (
+	// ErrInvalidSignature is returned when the signature header is malformed or does not match the body
+	ErrInvalidSignature = errors.New("webhook signature is invalid")
+	// ErrExpiredSignature is returned when the signature is older than the tolerance, it may be replayed
+	ErrExpiredSignature = errors.New("webhook signature is expired")
+)
+
+// NewSecret is a random secret of a webhook
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign the body sent at t, the time is signed too so a delivery can not be replayed later
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, computeSignature(secret, timestamp, body))
+}
+
+// Verify the signature header of a body, a signature older than tolerance is rejected
+// the partners do the same to check that a delivery is sent by the service
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return ErrInvalidSignature
+		}
+
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signature = kv[1]
+		}
+	}
+
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || signature == "" {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(computeSignature(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+
+	if tolerance > 0 && now.Sub(time.Unix(sec, 0)) > tolerance {
+		return ErrExpiredSignature
+	}
+
+	return nil
+}
+
+func computeSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,42 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignature(t *testing.T) {
+	secret, err := NewSecret()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(secret, "whsec_"))
+
+	now := time.Now()
+	body := []byte(`{"id":"1-1","type":"sold_out"}`)
+	header := Sign(secret, now, body)
+
+	tcs := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+		err    error
+	}{
+		{name: "valid", secret: secret, header: header, body: body, now: now},
+		{name: "other secret", secret: "whsec_other", header: header, body: body, now: now, err: ErrInvalidSignature},
+		{name: "changed body", secret: secret, header: header, body: []byte(`{}`), now: now, err: ErrInvalidSignature},
+		{name: "changed time", secret: secret, header: "t=1" + header[strings.Index(header, ","):], body: body, now: now, err: ErrInvalidSignature},
+		{name: "malformed", secret: secret, header: "v1", body: body, now: now, err: ErrInvalidSignature},
+		{name: "expired", secret: secret, header: header, body: body, now: now.Add(10 * time.Minute), err: ErrExpiredSignature},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.err, Verify(tc.secret, tc.header, tc.body, 5*time.Minute, tc.now))
+		})
+	}
+}
@@ -0,0 +1,260 @@
+// Package client is the Go client of the wager api
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// defaults of the client when it is not configured
+const (
+	defaultTimeout    = 10 * time.Second
+	defaultMaxRetries = 3
+	defaultBackoff    = 100 * time.Millisecond
+	maxBackoff        = 5 * time.Second
+)
+
+type (
+	// Client calls the wager api, it is safe for concurrent use
+	Client struct {
+		baseURL    string
+		http       *http.Client
+		maxRetries int
+		backoff    time.Duration
+		header     http.Header
+	}
+
+	// Option configures the client
+	Option func(c *Client)
+)
+
+// WithHTTPClient sends the requests with h instead of a client with a 10s timeout
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) {
+		c.http = h
+	}
+}
+
+// WithRetries retries a request at most maxRetries times, the wait starts at backoff and doubles on every retry
+// the network errors, 429 and the server errors are retried, the writes are retried with the same idempotency key
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.backoff = backoff
+	}
+}
+
+// WithHeader sends the header with every request, e.g. the api key or the claimed X-Actor of the audit trail
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Set(key, value)
+	}
+}
+
+// New client of the wager api at baseURL, e.g. http://localhost:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		http:       &http.Client{Timeout: defaultTimeout},
+		maxRetries: defaultMaxRetries,
+		backoff:    defaultBackoff,
+		header:     http.Header{},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+type idempotencyKeyCtxKey struct{}
+
+// WithIdempotencyKey sends key as the idempotency key of the write made with ctx,
+// so the caller can retry it on its own, otherwise every call gets a new key
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtxKey{}, key)
+}
+
+type placeWagerRequest struct {
+	TotalWagerValue   int             `json:"total_wager_value"`
+	Odds              int             `json:"odds"`
+	SellingPercentage int             `json:"selling_percentage"`
+	SellingPrice      decimal.Decimal `json:"selling_price"`
+}
+
+// PlaceWager places a wager, only the fields of the request are sent
+func (c *Client) PlaceWager(ctx context.Context, wager Wager) (Wager, error) {
+	req := placeWagerRequest{
+		TotalWagerValue:   wager.TotalWagerValue,
+		Odds:              wager.Odds,
+		SellingPercentage: wager.SellingPercentage,
+		SellingPrice:      wager.SellingPrice,
+	}
+
+	res := Wager{}
+	_, err := c.do(ctx, http.MethodPost, "/wagers", req, &res)
+
+	return res, err
+}
+
+type buyWagerRequest struct {
+	BuyingPrice decimal.Decimal `json:"buying_price"`
+}
+
+// BuyWager buys buyingPrice of a wager
+func (c *Client) BuyWager(ctx context.Context, wagerID int, buyingPrice decimal.Decimal) (Purchase, error) {
+	res := Purchase{}
+	_, err := c.do(ctx, http.MethodPost, "/buy/"+strconv.Itoa(wagerID), buyWagerRequest{BuyingPrice: buyingPrice}, &res)
+
+	return res, err
+}
+
+// GetWager gets a wager by id
+func (c *Client) GetWager(ctx context.Context, wagerID int) (Wager, error) {
+	res := Wager{}
+	_, err := c.do(ctx, http.MethodGet, "/wagers/"+strconv.Itoa(wagerID), nil, &res)
+
+	return res, err
+}
+
+// ListWagers lists at most limit wagers after the wager id page
+// next is the page of the next wagers, it is 0 on the last page
+func (c *Client) ListWagers(ctx context.Context, page, limit int) (wagers []Wager, next int, err error) {
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+	query.Set("limit", strconv.Itoa(limit))
+
+	header, err := c.do(ctx, http.MethodGet, "/wagers?"+query.Encode(), nil, &wagers)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if v := header.Get(HeaderNextPage); v != "" {
+		if next, err = strconv.Atoi(v); err != nil {
+			return nil, 0, fmt.Errorf("invalid %s header %q: %w", HeaderNextPage, v, err)
+		}
+	}
+
+	return wagers, next, nil
+}
+
+// do sends the request and decodes the response into res, the failed attempts are retried
+func (c *Client) do(ctx context.Context, method, path string, body, res interface{}) (http.Header, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	// every attempt of a write has the same key so the server makes it only once
+	key := ""
+	if method != http.MethodGet {
+		key, _ = ctx.Value(idempotencyKeyCtxKey{}).(string)
+		if key == "" {
+			key = newIdempotencyKey()
+		}
+	}
+
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		header, err := c.send(ctx, method, path, key, payload, res)
+		if err == nil || attempt >= c.maxRetries || !retryable(ctx, err) {
+			return header, err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, err
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// send makes a single attempt of the request
+func (c *Client) send(ctx context.Context, method, path, key string, payload []byte, res interface{}) (http.Header, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if key != "" {
+		req.Header.Set(HeaderIdempotencyKey, key)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return resp.Header, newError(resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return resp.Header, fmt.Errorf("decode %s %s response: %w", method, path, err)
+	}
+
+	// drain the body so the connection is reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	return resp.Header, nil
+}
+
+// retryable tells whether the attempt failed on the way and may succeed later
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests ||
+			(apiErr.StatusCode >= http.StatusInternalServerError && apiErr.StatusCode != http.StatusNotImplemented)
+	}
+
+	// the request did not get a response
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
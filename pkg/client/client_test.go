@@ -0,0 +1,413 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"wager/internal/app"
+	"wager/internal/domain"
+	"wager/internal/domain/mocks"
+)
+
+func newServer(t *testing.T, repo domain.WagerRepository, wrap func(http.Handler) http.Handler) *httptest.Server {
+	var handler http.Handler = app.New(repo, app.WithSpecValidation(true))
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestPlaceWager(t *testing.T) {
+	price := decimal.NewFromFloat(10.5)
+	placed := domain.Wager{
+		ID:                  1,
+		TotalWagerValue:     100,
+		Odds:                2,
+		SellingPercentage:   10,
+		SellingPrice:        price,
+		CurrentSellingPrice: price,
+		PlacedAt:            time.Now().UTC().Truncate(time.Second),
+		Status:              domain.WagerStatusOpen,
+	}
+
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Create", mock.Anything, mock.MatchedBy(func(w domain.Wager) bool {
+		return w.TotalWagerValue == 100 && w.Odds == 2 && w.SellingPercentage == 10 && w.SellingPrice.Equal(price)
+	})).Return(placed, nil).Once()
+
+	c := New(newServer(t, mockRepo, nil).URL)
+
+	res, err := c.PlaceWager(context.Background(), Wager{
+		TotalWagerValue:   100,
+		Odds:              2,
+		SellingPercentage: 10,
+		SellingPrice:      price,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, placed.ID, res.ID)
+	assert.True(t, placed.CurrentSellingPrice.Equal(res.CurrentSellingPrice))
+	assert.True(t, placed.PlacedAt.Equal(res.PlacedAt))
+
+	_, err = c.PlaceWager(context.Background(), Wager{TotalWagerValue: 100})
+	apiErr := &Error{}
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.True(t, apiErr.IsInvalid())
+	assert.NotEmpty(t, apiErr.RequestID)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestBuyWager(t *testing.T) {
+	price := decimal.NewFromFloat(1.5)
+
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Purchase", mock.Anything, 1, mock.Anything).
+		Return(domain.Purchase{ID: 7, WagerID: 1, BuyingPrice: price, BoughtAt: time.Now()}, nil)
+	mockRepo.On("Purchase", mock.Anything, 2, mock.Anything).
+		Return(domain.Purchase{}, fmt.Errorf("wager 2: %w", domain.ErrWagerNotFound))
+	mockRepo.On("Purchase", mock.Anything, 3, mock.Anything).
+		Return(domain.Purchase{}, fmt.Errorf("wager 3: %w", domain.ErrBuyingPriceTooHigh))
+	mockRepo.On("Purchase", mock.Anything, 4, mock.Anything).
+		Return(domain.Purchase{}, fmt.Errorf("wager 4: %w", domain.ErrWagerClosed))
+
+	c := New(newServer(t, mockRepo, nil).URL)
+
+	res, err := c.BuyWager(context.Background(), 1, price)
+	require.NoError(t, err)
+	assert.Equal(t, 7, res.ID)
+	assert.Equal(t, 1, res.WagerID)
+	assert.True(t, price.Equal(res.BuyingPrice))
+
+	tcs := []struct {
+		name       string
+		wagerID    int
+		statusCode int
+		err        error
+	}{
+		{name: "not found", wagerID: 2, statusCode: http.StatusNotFound, err: ErrWagerNotFound},
+		{name: "price too high", wagerID: 3, statusCode: http.StatusBadRequest, err: ErrBuyingPriceTooHigh},
+		{name: "closed", wagerID: 4, statusCode: http.StatusConflict, err: ErrWagerClosed},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := c.BuyWager(context.Background(), tc.wagerID, price)
+			assert.True(t, errors.Is(err, tc.err), err)
+
+			apiErr := &Error{}
+			require.True(t, errors.As(err, &apiErr))
+			assert.Equal(t, tc.statusCode, apiErr.StatusCode)
+			assert.False(t, apiErr.IsInvalid())
+		})
+	}
+}
+
+func TestGetWager(t *testing.T) {
+	wager := domain.Wager{
+		ID:                  1,
+		SellingPrice:        decimal.NewFromInt(1),
+		CurrentSellingPrice: decimal.NewFromInt(1),
+		PlacedAt:            time.Now(),
+		Status:              domain.WagerStatusOpen,
+	}
+
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Find", mock.Anything, 1).Return(wager, nil)
+	mockRepo.On("Find", mock.Anything, 2).Return(domain.Wager{}, fmt.Errorf("wager 2: %w", domain.ErrWagerNotFound))
+
+	actor := ""
+	srv := newServer(t, mockRepo, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actor = r.Header.Get("X-Actor")
+			next.ServeHTTP(w, r)
+		})
+	})
+	c := New(srv.URL, WithHeader("X-Actor", "tester"))
+
+	res, err := c.GetWager(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.ID)
+	assert.Equal(t, "tester", actor)
+
+	_, err = c.GetWager(context.Background(), 2)
+	assert.True(t, errors.Is(err, ErrWagerNotFound), err)
+
+	// a 404 which is not of a wager has no code, whatever its description is
+	notFound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"wager is not found"}`))
+	}))
+	defer notFound.Close()
+
+	_, err = New(notFound.URL).GetWager(context.Background(), 1)
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrWagerNotFound), err)
+}
+
+func TestWagers(t *testing.T) {
+	page := func(ids ...int) []domain.Wager {
+		wagers := make([]domain.Wager, 0, len(ids))
+		for _, id := range ids {
+			wagers = append(wagers, domain.Wager{
+				ID:                  id,
+				SellingPrice:        decimal.NewFromInt(1),
+				CurrentSellingPrice: decimal.NewFromInt(1),
+				PlacedAt:            time.Now(),
+				Status:              domain.WagerStatusOpen,
+			})
+		}
+		return wagers
+	}
+
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Get", mock.Anything, 1, 2).Return(page(2, 3), 3, nil).Once()
+	mockRepo.On("Get", mock.Anything, 3, 2).Return(page(4, 5), 5, nil).Once()
+	mockRepo.On("Get", mock.Anything, 5, 2).Return(page(6), 6, nil).Once()
+	mockRepo.On("Get", mock.Anything, 3, 2).Return(page(4, 5), 5, nil).Once()
+	mockRepo.On("Get", mock.Anything, 5, 2).Return(page(6), 6, nil).Once()
+
+	c := New(newServer(t, mockRepo, nil).URL)
+
+	ids := []int{}
+	it := c.Wagers(2)
+	for it.Next(context.Background()) {
+		ids = append(ids, it.Wager().ID)
+	}
+	require.NoError(t, it.Err())
+	assert.Equal(t, []int{2, 3, 4, 5, 6}, ids)
+	assert.False(t, it.Next(context.Background()))
+
+	// the iteration starts after a wager
+	ids = []int{}
+	it = c.WagersFrom(3, 2)
+	for it.Next(context.Background()) {
+		ids = append(ids, it.Wager().ID)
+	}
+	require.NoError(t, it.Err())
+	assert.Equal(t, []int{4, 5, 6}, ids)
+
+	// a page over the limit of the server stops the iteration
+	it = c.Wagers(1000)
+	assert.False(t, it.Next(context.Background()))
+	assert.Error(t, it.Err())
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRetries(t *testing.T) {
+	price := decimal.NewFromFloat(1.5)
+
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Purchase", mock.Anything, 1, mock.Anything).
+		Return(domain.Purchase{ID: 7, WagerID: 1, BuyingPrice: price, BoughtAt: time.Now()}, nil).Once()
+
+	// the first attempt is rejected, the second one is served but its response is lost
+	var mu sync.Mutex
+	keys := []string{}
+	srv := newServer(t, mockRepo, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			keys = append(keys, r.Header.Get(HeaderIdempotencyKey))
+			attempt := len(keys)
+			mu.Unlock()
+
+			switch attempt {
+			case 1:
+				w.WriteHeader(http.StatusServiceUnavailable)
+			case 2:
+				next.ServeHTTP(httptest.NewRecorder(), r)
+				w.WriteHeader(http.StatusBadGateway)
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	})
+
+	c := New(srv.URL, WithRetries(3, time.Millisecond))
+
+	res, err := c.BuyWager(context.Background(), 1, price)
+	require.NoError(t, err)
+	assert.Equal(t, 7, res.ID)
+
+	require.Len(t, keys, 3)
+	assert.NotEmpty(t, keys[0])
+	assert.Equal(t, keys[0], keys[1])
+	assert.Equal(t, keys[0], keys[2])
+
+	// the caller can give the key of a call
+	_, err = c.BuyWager(WithIdempotencyKey(context.Background(), keys[0]), 1, price)
+	require.NoError(t, err)
+	assert.Equal(t, keys[0], keys[3])
+
+	mockRepo.AssertNumberOfCalls(t, "Purchase", 1)
+
+	// the client errors are not retried
+	c = New(srv.URL, WithRetries(3, time.Millisecond))
+	_, err = c.BuyWager(context.Background(), 1, decimal.Zero)
+	assert.Error(t, err)
+	assert.Len(t, keys, 5)
+}
+
+// the client has its own copies of the codes and the types of the api, these tests keep them in step with the domain
+func TestErrorCodes(t *testing.T) {
+	// every domain error is sent by the server, err is the error of the client for it.
+	// the client does not manage the webhooks so their errors only keep their code
+	tcs := map[string]struct {
+		domainErr error
+		err       error
+	}{
+		domain.ErrorCodeWagerNotFound:           {domainErr: domain.ErrWagerNotFound, err: ErrWagerNotFound},
+		domain.ErrorCodeBuyingPriceTooHigh:      {domainErr: domain.ErrBuyingPriceTooHigh, err: ErrBuyingPriceTooHigh},
+		domain.ErrorCodeWagerClosed:             {domainErr: domain.ErrWagerClosed, err: ErrWagerClosed},
+		domain.ErrorCodeWebhookNotFound:         {domainErr: domain.ErrWebhookNotFound},
+		domain.ErrorCodeWebhookDeliveryNotFound: {domainErr: domain.ErrWebhookDeliveryNotFound},
+	}
+
+	codes := domain.ErrorCodes()
+	mockRepo := &mocks.WagerRepository{}
+	for i, code := range codes {
+		if tc, ok := tcs[code]; ok {
+			mockRepo.On("Find", mock.Anything, i+1).Return(domain.Wager{}, fmt.Errorf("wager %d: %w", i+1, tc.domainErr))
+		}
+	}
+	c := New(newServer(t, mockRepo, nil).URL)
+
+	for i, code := range codes {
+		t.Run(code, func(t *testing.T) {
+			tc, ok := tcs[code]
+			require.True(t, ok, "the client is not checked against the code %s", code)
+			require.Equal(t, code, domain.ErrorCode(tc.domainErr))
+
+			_, err := c.GetWager(context.Background(), i+1)
+			apiErr := &Error{}
+			require.True(t, errors.As(err, &apiErr), err)
+			assert.Equal(t, code, apiErr.Code)
+			assert.Equal(t, tc.err, apiErr.Unwrap())
+		})
+	}
+
+	// the codes of the client are the ones of the domain
+	assert.Equal(t, domain.ErrorCodeWagerNotFound, CodeWagerNotFound)
+	assert.Equal(t, domain.ErrorCodeBuyingPriceTooHigh, CodeBuyingPriceTooHigh)
+	assert.Equal(t, domain.ErrorCodeWagerClosed, CodeWagerClosed)
+}
+
+// the json of the server is read into the types of the client and written back unchanged
+func TestTypesRoundTrip(t *testing.T) {
+	sold := 4
+	percentage := 40
+	at := time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+	wager := domain.Wager{
+		ID:                  1,
+		TotalWagerValue:     10,
+		Odds:                2,
+		SellingPercentage:   50,
+		SellingPrice:        decimal.RequireFromString("10.50"),
+		CurrentSellingPrice: decimal.RequireFromString("9.25"),
+		PercentageSold:      &percentage,
+		AmountSold:          &sold,
+		PlacedAt:            at,
+		Status:              domain.WagerStatusOpen,
+		Version:             3,
+	}
+	purchase := domain.Purchase{ID: 7, WagerID: 1, BuyingPrice: decimal.RequireFromString("9.25"), BoughtAt: at}
+
+	mockRepo := &mocks.WagerRepository{}
+	mockRepo.On("Find", mock.Anything, 1).Return(wager, nil)
+	mockRepo.On("Purchase", mock.Anything, 1, mock.Anything).Return(purchase, nil)
+	c := New(newServer(t, mockRepo, nil).URL)
+
+	gotWager, err := c.GetWager(context.Background(), 1)
+	require.NoError(t, err)
+	assertSameJSON(t, wager, gotWager)
+
+	gotPurchase, err := c.BuyWager(context.Background(), 1, purchase.BuyingPrice)
+	require.NoError(t, err)
+	assertSameJSON(t, purchase, gotPurchase)
+}
+
+func assertSameJSON(t *testing.T, want, got interface{}) {
+	wantJSON, err := json.Marshal(want)
+	require.NoError(t, err)
+	gotJSON, err := json.Marshal(got)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(wantJSON), string(gotJSON))
+}
+
+func TestTypes(t *testing.T) {
+	tcs := []struct {
+		name   string
+		client interface{}
+		domain interface{}
+	}{
+		{name: "wager", client: Wager{}, domain: domain.Wager{}},
+		{name: "purchase", client: Purchase{}, domain: domain.Purchase{}},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, jsonFields(tc.domain), jsonFields(tc.client))
+		})
+	}
+}
+
+func TestSoldOut(t *testing.T) {
+	amount := func(v int) *int { return &v }
+
+	tcs := []struct {
+		name            string
+		totalWagerValue int
+		amountSold      *int
+		soldOut         bool
+	}{
+		{name: "not bought", totalWagerValue: 10},
+		{name: "bought", totalWagerValue: 10, amountSold: amount(9)},
+		{name: "sold out", totalWagerValue: 10, amountSold: amount(10), soldOut: true},
+		{name: "no value", amountSold: amount(1)},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			w := Wager{TotalWagerValue: tc.totalWagerValue, AmountSold: tc.amountSold}
+			d := domain.Wager{TotalWagerValue: tc.totalWagerValue, AmountSold: tc.amountSold}
+			assert.Equal(t, tc.soldOut, w.SoldOut())
+			assert.Equal(t, d.SoldOut(), w.SoldOut())
+		})
+	}
+}
+
+// jsonFields are the json names and the go types of the fields of v which are encoded
+func jsonFields(v interface{}) map[string]string {
+	fields := map[string]string{}
+
+	typ := reflect.TypeOf(v)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		fields[name] = field.Type.String()
+	}
+
+	return fields
+}
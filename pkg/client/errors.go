@@ -0,0 +1,86 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBody is the most of an error response which is read
+const maxErrorBody = 1 << 16
+
+// codes of the errors of the api
+const (
+	CodeWagerNotFound      = "wager_not_found"
+	CodeBuyingPriceTooHigh = "buying_price_too_high"
+	CodeWagerClosed        = "wager_closed"
+)
+
+var (
+	// ErrWagerNotFound is returned when the wager does not exist
+	ErrWagerNotFound = errors.New("wager is not found")
+	// ErrBuyingPriceTooHigh is returned when the buying price is greater than the current selling price
+	ErrBuyingPriceTooHigh = errors.New("buying price is greater than the current selling price")
+	// ErrWagerClosed is returned when a wager which is cancelled or settled is bought
+	ErrWagerClosed = errors.New("wager is not open")
+)
+
+// Error is a response of the api with an error status
+// it unwraps to the error of its code, so errors.Is(err, ErrWagerNotFound) works
+type Error struct {
+	StatusCode int
+	// Code is the code of the error, it is empty when the error has none
+	Code        string
+	Description string
+	RequestID   string
+}
+
+// errorResponse is the body of an error response
+type errorResponse struct {
+	Code        string `json:"code"`
+	Description string `json:"error"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("wager api: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Description)
+}
+
+// Unwrap returns the error of the code of the response, nil when there is none
+func (e *Error) Unwrap() error {
+	switch e.Code {
+	case CodeWagerNotFound:
+		return ErrWagerNotFound
+	case CodeBuyingPriceTooHigh:
+		return ErrBuyingPriceTooHigh
+	case CodeWagerClosed:
+		return ErrWagerClosed
+	default:
+		return nil
+	}
+}
+
+// IsInvalid tells whether the request is rejected because it is not valid
+func (e *Error) IsInvalid() bool {
+	return e.StatusCode == http.StatusBadRequest && e.Code == ""
+}
+
+// newError decodes the error response of resp, a body which is not one is kept as the description
+func newError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+	res := errorResponse{}
+	if err := json.Unmarshal(body, &res); err != nil || res.Description == "" {
+		res.Description = strings.TrimSpace(string(body))
+	}
+
+	return &Error{
+		StatusCode:  resp.StatusCode,
+		Code:        res.Code,
+		Description: res.Description,
+		RequestID:   resp.Header.Get(HeaderRequestID),
+	}
+}
@@ -0,0 +1,69 @@
+package client
+
+import "context"
+
+// WagerIterator lists the wagers page by page, following the next page of every response
+//
+//	it := c.Wagers(20)
+//	for it.Next(ctx) {
+//		wager := it.Wager()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type WagerIterator struct {
+	client *Client
+	limit  int
+	page   int
+
+	wagers []Wager
+	wager  Wager
+	last   bool
+	err    error
+}
+
+// firstPage is the page the iteration starts from
+const firstPage = 1
+
+// Wagers iterates over all the wagers, limit wagers are fetched at once
+func (c *Client) Wagers(limit int) *WagerIterator {
+	return c.WagersFrom(firstPage, limit)
+}
+
+// WagersFrom iterates over the wagers after the wager id page, limit wagers are fetched at once
+func (c *Client) WagersFrom(page, limit int) *WagerIterator {
+	return &WagerIterator{client: c, limit: limit, page: page}
+}
+
+// Next moves to the next wager, it fetches the next page when the current one is done
+// it returns false at the end of the wagers or on an error
+func (it *WagerIterator) Next(ctx context.Context) bool {
+	for len(it.wagers) == 0 {
+		if it.last || it.err != nil {
+			return false
+		}
+
+		wagers, next, err := it.client.ListWagers(ctx, it.page, it.limit)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.wagers = wagers
+		it.page = next
+		it.last = next == 0
+	}
+
+	it.wager, it.wagers = it.wagers[0], it.wagers[1:]
+	return true
+}
+
+// Wager is the current wager
+func (it *WagerIterator) Wager() Wager {
+	return it.wager
+}
+
+// Err is the error which stopped the iteration
+func (it *WagerIterator) Err() error {
+	return it.err
+}
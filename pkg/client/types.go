@@ -0,0 +1,42 @@
+package client
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// headers of the api
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	HeaderNextPage       = "X-Next-Page"
+	HeaderRequestID      = "X-Request-Id"
+)
+
+type (
+	// Wager of the api, PercentageSold and AmountSold are nil until the wager is bought
+	Wager struct {
+		ID                  int             `json:"id"`
+		TotalWagerValue     int             `json:"total_wager_value"`
+		Odds                int             `json:"odds"`
+		SellingPercentage   int             `json:"selling_percentage"`
+		SellingPrice        decimal.Decimal `json:"selling_price"`
+		CurrentSellingPrice decimal.Decimal `json:"current_selling_price"`
+		PercentageSold      *int            `json:"percentage_sold"`
+		AmountSold          *int            `json:"amount_sold"`
+		PlacedAt            time.Time       `json:"placed_at"`
+	}
+
+	// Purchase of a wager
+	Purchase struct {
+		ID          int             `json:"id"`
+		WagerID     int             `json:"wager_id"`
+		BuyingPrice decimal.Decimal `json:"buying_price"`
+		BoughtAt    time.Time       `json:"bought_at"`
+	}
+)
+
+// SoldOut tells whether every unit of the wager is sold, by the same rule as the api
+func (w *Wager) SoldOut() bool {
+	return w.AmountSold != nil && w.TotalWagerValue > 0 && *w.AmountSold >= w.TotalWagerValue
+}
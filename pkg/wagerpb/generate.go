@@ -0,0 +1,4 @@
+// Package wagerpb is the generated gRPC api of the wagers, see api/wager.proto
+package wagerpb
+
+//go:generate protoc -I ../../api --go_out=../.. --go_opt=module=wager --go-grpc_out=../.. --go-grpc_opt=module=wager wager.proto